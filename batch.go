@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/batch"
+)
+
+type batchFlags struct {
+	Manifest    string `arg:"" help:"YAML file listing the jobs to execute" type:"existingfile"`
+	Concurrency int    `help:"Number of jobs to execute concurrently, overrides the manifest" short:"j"`
+	Timeout     int    `help:"Timeout of every job, in seconds" default:"120"`
+	Force       bool   `help:"Overwrite existing output files"`
+}
+
+var errBatchFailed = errors.New("batch failed")
+
+// runBatch executes the jobs listed in a manifest file, printing the status
+// of every job as it finishes, and a summary table at the end. Returns an
+// error if any job failed.
+func runBatch(aiac *libaiac.Aiac, cli batchFlags) error {
+	manifest, err := batch.LoadManifest(cli.Manifest)
+	if err != nil {
+		return err
+	}
+
+	concurrency := cli.Concurrency
+	if concurrency <= 0 {
+		concurrency = manifest.Concurrency
+	}
+
+	var (
+		mu   sync.Mutex
+		done int
+	)
+
+	runner := batch.New(aiac, &batch.Options{
+		Concurrency: concurrency,
+		Timeout:     time.Duration(cli.Timeout) * time.Second,
+		Overwrite:   cli.Force,
+		OnDone: func(res batch.Result) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			done++
+			progress := fmt.Sprintf("[%d/%d]", done, len(manifest.Jobs))
+
+			if res.Succeeded() {
+				fmt.Fprintf(
+					os.Stderr, "%s %s %s (%s)\n",
+					progress, color.GreenString("done"), res.Job.Name,
+					res.Duration.Round(time.Millisecond),
+				)
+			} else {
+				fmt.Fprintf(
+					os.Stderr, "%s %s %s: %s\n",
+					progress, color.RedString("failed"), res.Job.Name, res.Err,
+				)
+			}
+		},
+	})
+
+	results := runner.Run(context.Background(), manifest.Jobs)
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint: gomnd
+	fmt.Fprintln(w, "\nJOB\tBACKEND\tMODEL\tSTATUS\tTOKENS\tDURATION\tOUTPUT")
+	for _, res := range results {
+		status, output := "ok", res.Job.Output
+		if !res.Succeeded() {
+			status, output = "failed", res.Err.Error()
+			failed++
+		}
+
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			res.Job.Name, dash(res.Response.Backend), dash(res.Response.Model),
+			status, res.Response.TokensUsed,
+			res.Duration.Round(time.Millisecond), dash(output),
+		)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d job(s) failed", errBatchFailed, failed, len(results))
+	}
+
+	return nil
+}
+
+// dash returns the provided string, or a dash if it is empty, for display in
+// tables.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/report"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+type compareFlags struct {
+	Backend   []string `help:"Backend to compare, optionally with a model as backend:model (may be repeated)" short:"b" required:"" sep:"none"` //nolint: lll
+	What      []string `arg:"" help:"Which IaC template to generate"`
+	OutputDir string   `help:"Directory to save the code generated by every model to, instead of printing it" type:"path"` //nolint: lll
+	Validate  bool     `help:"Validate and run security checks on every result, and score it"`
+	Width     int      `help:"Width of the side-by-side output, defaults to the terminal width"`
+	Timeout   int      `help:"Timeout to generate code, in seconds" default:"120"`
+	Force     bool     `help:"Overwrite existing files in the output directory"`
+}
+
+// defaultWidth is the width of the side-by-side output when the terminal's
+// width is unknown.
+const defaultWidth = 120
+
+var errCompareFailed = errors.New("all backends failed")
+
+// compareTarget is a backend and model to compare, and the results of
+// sending the prompt to it.
+type compareTarget struct {
+	name     string
+	backend  string
+	model    string
+	res      types.Response
+	err      error
+	duration time.Duration
+	report   *report.Report
+}
+
+// label returns the name of the target, including the model used if it was
+// not explicitly selected.
+func (target *compareTarget) label() string {
+	if target.model == "" && target.res.Model != "" {
+		return fmt.Sprintf("%s:%s", target.backend, target.res.Model)
+	}
+
+	return target.name
+}
+
+// runCompare sends the same prompt to multiple backends and models
+// concurrently, and prints the generated code side by side (or saves it to
+// files), followed by a summary of every result.
+func runCompare(aiac *libaiac.Aiac, cli compareFlags) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cli.Timeout)*time.Second)
+	defer cancel()
+
+	prompt := codePrompt(cli.What, false)
+
+	targets := make([]*compareTarget, len(cli.Backend))
+	for i, ref := range cli.Backend {
+		backend, model, _ := strings.Cut(ref, ":")
+		targets[i] = &compareTarget{name: ref, backend: backend, model: model}
+	}
+
+	fmt.Fprintf(os.Stderr, "Comparing %d backends ...\n", len(targets))
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *compareTarget) {
+			defer wg.Done()
+
+			started := time.Now()
+			defer func() {
+				target.duration = time.Since(started)
+			}()
+
+			chat, err := aiac.Chat(ctx, target.backend, target.model)
+			if err != nil {
+				target.err = fmt.Errorf("failed starting chat: %w", err)
+				return
+			}
+
+			target.res, target.err = chat.Send(ctx, prompt)
+		}(target)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, target := range targets {
+		if target.err != nil {
+			failed++
+		} else if cli.Validate {
+			target.report = report.New(target.res, &report.Options{Prompt: prompt})
+		}
+	}
+
+	if cli.OutputDir != "" {
+		if err := saveComparison(cli.OutputDir, targets, cli.Force); err != nil {
+			return err
+		}
+	} else {
+		printColumns(targets, outputWidth(cli.Width))
+	}
+
+	printComparison(targets, cli.Validate)
+
+	if failed == len(targets) {
+		return errCompareFailed
+	}
+
+	return nil
+}
+
+// outputWidth returns the width of the side-by-side output: the provided
+// width, or the terminal's width based on the COLUMNS environment variable,
+// or defaultWidth.
+func outputWidth(width int) int {
+	if width > 0 {
+		return width
+	}
+
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+
+	return defaultWidth
+}
+
+// printColumns prints the code generated by every target side by side, in
+// columns that fit the provided width. Long lines are wrapped.
+func printColumns(targets []*compareTarget, width int) {
+	const sep = " │ "
+
+	colWidth := (width - len([]rune(sep))*(len(targets)-1)) / len(targets)
+	if colWidth < 20 { //nolint: gomnd
+		colWidth = 20
+	}
+
+	columns := make([][]string, len(targets))
+	rows := 0
+	for i, target := range targets {
+		text := target.res.Code
+		if target.err != nil {
+			text = "Error: " + target.err.Error()
+		}
+
+		columns[i] = append(
+			[]string{target.label(), strings.Repeat("─", colWidth)},
+			wrapLines(text, colWidth)...,
+		)
+
+		if len(columns[i]) > rows {
+			rows = len(columns[i])
+		}
+	}
+
+	bold := color.New(color.Bold)
+	for row := 0; row < rows; row++ {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cell := ""
+			if row < len(column) {
+				cell = column[row]
+			}
+
+			cell += strings.Repeat(" ", colWidth-utf8.RuneCountInString(cell))
+			if row == 0 {
+				cell = bold.Sprint(cell)
+			}
+
+			cells[i] = cell
+		}
+
+		fmt.Fprintln(os.Stdout, strings.TrimRight(strings.Join(cells, sep), " "))
+	}
+
+	fmt.Fprintln(os.Stdout)
+}
+
+// wrapLines splits text into lines no longer than width runes, expanding tabs
+// to spaces.
+func wrapLines(text string, width int) (lines []string) {
+	text = strings.ReplaceAll(text, "\t", "    ")
+
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		for len(runes) > width {
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+
+		lines = append(lines, string(runes))
+	}
+
+	return lines
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// saveComparison saves the code generated by every target to a separate file
+// in the provided directory, named after the target. Unless force is true,
+// nothing is saved if any of the files already exists.
+func saveComparison(dir string, targets []*compareTarget, force bool) error {
+	paths := make(map[*compareTarget]string, len(targets))
+	for _, target := range targets {
+		if target.err != nil {
+			continue
+		}
+
+		ext := ".txt"
+		if len(target.res.Files) > 0 {
+			ext = types.FileExtension(target.res.Files[0].Language)
+		}
+
+		path := filepath.Join(dir, unsafeChars.ReplaceAllString(target.label(), "_")+ext)
+		if _, err := os.Stat(path); err == nil && !force {
+			return fmt.Errorf("%w: %s (use --force to overwrite)", types.ErrFileExists, path)
+		}
+
+		paths[target] = path
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed creating directory %s: %w", dir, err)
+	}
+
+	for _, target := range targets {
+		path, ok := paths[target]
+		if !ok {
+			continue
+		}
+
+		err = os.WriteFile(path, []byte(target.res.Code+"\n"), 0o644) //nolint: gosec
+		if err != nil {
+			return fmt.Errorf("failed saving %s: %w", path, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Code generated by %s saved to %s\n", target.label(), path)
+	}
+
+	return nil
+}
+
+// printComparison prints a table summarizing the result of every target,
+// including its score if results were validated.
+func printComparison(targets []*compareTarget, validated bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint: gomnd
+
+	header := "TARGET\tLATENCY\tTOKENS\tSTOP REASON\tLINES"
+	if validated {
+		header += "\tPROBLEMS\tSCORE"
+	}
+	fmt.Fprintln(w, header)
+
+	for _, target := range targets {
+		if target.err != nil {
+			fmt.Fprintf(
+				w, "%s\t%s\t-\tfailed\t-\n",
+				target.label(), target.duration.Round(time.Millisecond),
+			)
+			continue
+		}
+
+		fmt.Fprintf(
+			w, "%s\t%s\t%d\t%s\t%d",
+			target.label(), target.duration.Round(time.Millisecond),
+			target.res.TokensUsed, dash(target.res.StopReason),
+			strings.Count(target.res.Code, "\n")+1,
+		)
+
+		if target.report != nil {
+			fmt.Fprintf(w, "\t%d\t%d", len(target.report.Findings), target.report.Score())
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	w.Flush()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/manifoldco/promptui"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// writeFile writes content to a file. If the file already exists, a copy of
+// its original contents is kept with a ".bak" suffix, and if confirm is true,
+// a diff of the changes is printed and the user is asked to confirm them
+// before the file is overwritten. If dryRun is true, the diff is printed and
+// the file is not modified. Returns whether the file was written.
+func writeFile(path, content string, confirm, dryRun bool) (written bool, err error) {
+	perm := os.FileMode(0o644) //nolint: gomnd
+
+	orig, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("failed reading %s: %w", path, err)
+	}
+
+	if exists && string(orig) == content {
+		fmt.Fprintf(os.Stderr, "No changes to %s\n", path)
+		return false, nil
+	}
+
+	if dryRun {
+		printDiff(os.Stdout, unifiedDiff(path, string(orig), content, exists))
+		return false, nil
+	}
+
+	if exists {
+		if confirm {
+			printDiff(os.Stdout, unifiedDiff(path, string(orig), content, exists))
+
+			input := promptui.Prompt{
+				Label:     fmt.Sprintf("Overwrite %s", path),
+				IsConfirm: true,
+			}
+
+			if _, err := input.Run(); err != nil {
+				if errors.Is(err, promptui.ErrAbort) {
+					fmt.Fprintf(os.Stderr, "Changes to %s discarded.\n", path)
+					return false, nil
+				}
+
+				return false, fmt.Errorf("prompt failed: %w", err)
+			}
+		}
+
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+
+		err = os.WriteFile(path+".bak", orig, perm)
+		if err != nil {
+			return false, fmt.Errorf("failed backing up %s: %w", path, err)
+		}
+	}
+
+	err = os.WriteFile(path, []byte(content), perm)
+	if err != nil {
+		return false, fmt.Errorf("failed saving %s: %w", path, err)
+	}
+
+	return true, nil
+}
+
+// hasContent returns true if the file at path exists and contains exactly
+// the provided content.
+func hasContent(path, content string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && string(data) == content
+}
+
+// unifiedDiff returns a unified diff between the original and revised
+// contents of a file. If the file did not exist, the diff is against
+// /dev/null.
+func unifiedDiff(path, orig, revised string, exists bool) string {
+	fromFile := path
+	if !exists {
+		fromFile = os.DevNull
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(orig),
+		B:        splitLines(revised),
+		FromFile: fromFile,
+		ToFile:   path,
+		Context:  3, //nolint: gomnd
+	})
+	if err != nil {
+		// difflib only fails when writing to its buffer, which can't happen
+		return ""
+	}
+
+	return diff
+}
+
+// splitLines splits text into lines for diffing, keeping the line breaks. A
+// line break is added to the last line if it has none.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+
+	return lines
+}
+
+// printDiff prints a unified diff to w, with removed lines in red, added
+// lines in green and hunk headers in cyan.
+func printDiff(w io.Writer, diff string) {
+	var (
+		header  = color.New(color.Bold)
+		hunk    = color.New(color.FgCyan)
+		added   = color.New(color.FgGreen)
+		removed = color.New(color.FgRed)
+	)
+
+	inHeader := true
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case line == "":
+		case inHeader && (strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++")):
+			header.Fprint(w, line)
+		case strings.HasPrefix(line, "@@"):
+			inHeader = false
+			hunk.Fprint(w, line)
+		case strings.HasPrefix(line, "+"):
+			added.Fprint(w, line)
+		case strings.HasPrefix(line, "-"):
+			removed.Fprint(w, line)
+		default:
+			fmt.Fprint(w, line)
+		}
+	}
+}
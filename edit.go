@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/fatih/color"
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+type editFlags struct {
+	File      string   `arg:"" help:"File to modify"`
+	What      []string `arg:"" help:"Changes to make to the file"`
+	Backend   string   `help:"Backend to use" short:"b"`
+	Model     string   `help:"Model to use" short:"m"`
+	System    string   `help:"System prompt to send to the model, overrides the backend's system_prompt"`                               //nolint: lll
+	Context   []string `help:"Additional file, directory or glob pattern to include as context (may be repeated)" short:"i" sep:"none"` //nolint: lll
+	Quiet     bool     `help:"Non-interactive mode, save the changes without confirmation and exit" short:"q"`
+	Sensitive bool     `help:"Allow sending files that may contain secrets (e.g. .tfvars, .tfstate and .env files)" name:"include-sensitive"` //nolint: lll
+	DryRun    bool     `help:"Print a diff of the changes without modifying the file"`
+	Timeout   int      `help:"Timeout to generate changes, in seconds" default:"60"`
+}
+
+var errSensitiveFile = errors.New("refusing to send sensitive file")
+
+// editPrompt is appended to the requested changes, asking the model to return
+// the entire file rather than just the modified parts.
+const editPrompt = "Respond with the complete revised contents of %s in a " +
+	"single code block. Do not omit any parts of the file, even if unchanged."
+
+// editFile asks the model to modify an existing file, shows the user a diff
+// of the changes, and writes them back to the file on confirmation, keeping a
+// backup of the original (see writeFile).
+func editFile(aiac *libaiac.Aiac, cli editFlags) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cli.Timeout)*time.Second)
+	defer cancel()
+
+	orig, err := os.ReadFile(cli.File)
+	if err != nil {
+		return fmt.Errorf("failed reading %s: %w", cli.File, err)
+	}
+
+	msg, files, err := aiac.ContextMessage(
+		joinPrompt(
+			strings.Join(cli.What, " "),
+			fmt.Sprintf(editPrompt, filepath.ToSlash(cli.File)),
+		),
+		libaiac.ContextOptions{
+			Files:            append([]string{cli.File}, cli.Context...),
+			IncludeSensitive: cli.Sensitive,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed loading context: %w", err)
+	}
+
+	for _, file := range files {
+		if !file.Skipped {
+			continue
+		}
+
+		if file.Path == filepath.Clean(cli.File) {
+			return fmt.Errorf(
+				"%w: %s may contain secrets, use --include-sensitive to send it to the model",
+				errSensitiveFile, cli.File,
+			)
+		}
+
+		color.New(color.FgYellow).Fprintf(
+			os.Stderr,
+			"Context file %s was skipped as it may contain secrets (use --include-sensitive to include it)\n",
+			file.Path,
+		)
+	}
+
+	chat, err := aiac.ChatWithOptions(ctx, cli.Backend, cli.Model, libaiac.ChatOptions{
+		SystemPrompt: cli.System,
+	})
+	if err != nil {
+		return fmt.Errorf("failed starting chat: %w", err)
+	}
+
+	spin := spinner.New(
+		spinner.CharSets[11],
+		100*time.Millisecond, //nolint: gomnd
+		spinner.WithWriter(color.Error),
+		spinner.WithSuffix("\tGenerating changes ..."))
+
+	spin.Start()
+	res, err := chat.Send(ctx, msg)
+	spin.Stop()
+
+	if err != nil {
+		return fmt.Errorf("failed generating changes: %w", err)
+	}
+
+	if types.IsTruncated(res.StopReason) {
+		return fmt.Errorf(
+			"the response was truncated (%s), refusing to modify %s",
+			res.StopReason, cli.File,
+		)
+	}
+
+	block, ok := revisedFile(cli.File, res.Files)
+	if !ok {
+		return types.ErrNoCodeBlocks
+	}
+
+	revised := block.Code
+	if strings.HasSuffix(string(orig), "\n") && !strings.HasSuffix(revised, "\n") {
+		revised += "\n"
+	}
+
+	written, err := writeFile(cli.File, revised, !cli.Quiet, cli.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if written {
+		fmt.Fprintf(os.Stderr, "Changes saved to %s (original kept in %s.bak)\n", cli.File, cli.File)
+	}
+
+	return nil
+}
+
+// revisedFile returns the code block containing the revised contents of a
+// file, which is the block whose file name matches the file, or the first
+// block if none does.
+func revisedFile(path string, blocks []types.CodeBlock) (block types.CodeBlock, ok bool) {
+	if len(blocks) == 0 {
+		return block, false
+	}
+
+	for _, block := range blocks {
+		if block.Filename == "" {
+			continue
+		}
+
+		name := filepath.FromSlash(block.Filename)
+		if filepath.Clean(name) == filepath.Clean(path) || name == filepath.Base(path) {
+			return block, true
+		}
+	}
+
+	return blocks[0], true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/eval"
+)
+
+type evalFlags struct {
+	Suite       string   `arg:"" help:"YAML file defining the suite to evaluate" type:"existingfile"`
+	Backend     []string `help:"Backend to evaluate, optionally with a model as backend:model (may be repeated), overrides the suite's targets" short:"b" sep:"none"` //nolint: lll
+	JSONFile    string   `help:"File to write the scorecard to as JSON" name:"json-file" type:"path"`
+	MDFile      string   `help:"File to write the scorecard to as Markdown, instead of printing it" name:"markdown-file" type:"path"` //nolint: lll
+	MinPassRate float64  `help:"Exit with an error if the overall pass rate (0-100) is lower than this" default:"0"`                  //nolint: lll
+	Concurrency int      `help:"Number of cases to evaluate concurrently" short:"j" default:"4"`
+	Timeout     int      `help:"Timeout of every case, in seconds" default:"120"`
+}
+
+var errPassRate = errors.New("pass rate too low")
+
+// runEval evaluates a suite, printing the result of every case as it
+// finishes, and the scorecard in Markdown format at the end (or writing it to
+// files).
+func runEval(aiac *libaiac.Aiac, cli evalFlags) error {
+	suite, err := eval.LoadSuite(cli.Suite)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+
+	runner := eval.New(aiac, &eval.Options{
+		Targets:     cli.Backend,
+		Concurrency: cli.Concurrency,
+		Timeout:     time.Duration(cli.Timeout) * time.Second,
+		OnResult: func(res eval.CaseResult) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			target := res.Target
+			if target == "" {
+				target = "default"
+			}
+
+			status := color.GreenString("pass")
+			if !res.Passed {
+				status = color.RedString("fail")
+			}
+
+			fmt.Fprintf(os.Stderr, "%s %s / %s\n", status, target, res.Case)
+		},
+	})
+
+	card := runner.Run(context.Background(), suite)
+
+	if cli.JSONFile != "" {
+		if err := writeScorecard(cli.JSONFile, card.WriteJSON); err != nil {
+			return err
+		}
+	}
+
+	if cli.MDFile != "" {
+		if err := writeScorecard(cli.MDFile, card.WriteMarkdown); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(os.Stderr)
+		if err := card.WriteMarkdown(os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if rate := card.PassRate() * 100; rate < cli.MinPassRate { //nolint: gomnd
+		return fmt.Errorf("%w: %.1f%%, the minimum is %.1f%%", errPassRate, rate, cli.MinPassRate)
+	}
+
+	return nil
+}
+
+func writeScorecard(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed creating %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed writing %s: %w", path, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Scorecard saved to %s\n", path)
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/ido50/requests"
+)
+
+const (
+	// DefaultAPIURL is the default URL for the Anthropic API
+	DefaultAPIURL = "https://api.anthropic.com/v1"
+
+	// DefaultAPIVersion is the default version of the Anthropic API to use,
+	// sent in the anthropic-version header
+	DefaultAPIVersion = "2023-06-01"
+
+	// DefaultMaxTokens is the maximum number of tokens to generate in a
+	// response. The Anthropic API requires this value in every request.
+	DefaultMaxTokens = 4096
+)
+
+// Anthropic is a structure used to continuously generate IaC code via the
+// Anthropic Messages API
+type Anthropic struct {
+	*requests.HTTPClient
+	url        string
+	headers    map[string]string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// APIKey is the Anthropic API key to use for requests. Required.
+	APIKey string
+
+	// URL is the Anthropic API URL to use. Optional, defaults to
+	// DefaultAPIURL.
+	URL string
+
+	// APIVersion is the version of the Anthropic API to use. Optional,
+	// defaults to DefaultAPIVersion.
+	APIVersion string
+
+	// ExtraHeaders are extra HTTP headers to send with every request to the
+	// provider.
+	ExtraHeaders map[string]string
+}
+
+// New creates a new instance of the Anthropic struct, with the provided input
+// options. The Anthropic API is not yet contacted at this point.
+func New(opts *Options) *Anthropic {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.URL == "" {
+		opts.URL = DefaultAPIURL
+	}
+
+	if opts.APIVersion == "" {
+		opts.APIVersion = DefaultAPIVersion
+	}
+
+	backend := &Anthropic{
+		url: strings.TrimSuffix(opts.URL, "/"),
+		headers: map[string]string{
+			"x-api-key":         opts.APIKey,
+			"anthropic-version": opts.APIVersion,
+		},
+		apiKey: opts.APIKey,
+	}
+
+	for header, value := range opts.ExtraHeaders {
+		backend.headers[header] = value
+	}
+
+	backend.HTTPClient = requests.NewClient(opts.URL).
+		Accept("application/json").
+		ErrorHandler(handleError)
+
+	for header, value := range backend.headers {
+		backend.HTTPClient.Header(header, value)
+	}
+
+	// The same HTTP client is used for regular and streamed requests
+	backend.httpClient = &http.Client{}
+	backend.HTTPClient.CustomHTTPClient(backend.httpClient)
+
+	return backend
+}
+
+// handleError creates the error returned when the Anthropic API responds with
+// an unsuccessful status code.
+func handleError(
+	httpStatus int,
+	contentType string,
+	body io.Reader,
+) error {
+	var res errorResponse
+
+	err := json.NewDecoder(body).Decode(&res)
+	if err != nil || res.Error.Message == "" {
+		err = fmt.Errorf(
+			"%w %s",
+			types.ErrUnexpectedStatus,
+			http.StatusText(httpStatus),
+		)
+	} else {
+		err = res.err()
+	}
+
+	if types.IsRetryableStatus(httpStatus) {
+		return &types.RetryableError{Err: err}
+	}
+
+	return err
+}
+
+type errorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (res errorResponse) err() error {
+	return fmt.Errorf(
+		"%w: [%s]: %s",
+		types.ErrRequestFailed,
+		res.Error.Type,
+		res.Error.Message,
+	)
+}
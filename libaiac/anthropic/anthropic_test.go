@@ -0,0 +1,287 @@
+package anthropic_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/anthropic"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// request is a request received by the test server.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newServer starts a test server that records every request it receives and
+// responds with the provided handler.
+func newServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *[]request) {
+	t.Helper()
+
+	var requests []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, path: r.URL.Path, header: r.Header}
+
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			t.Errorf("request body is not valid JSON: %s", err)
+		}
+
+		requests = append(requests, req)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func newBackend(url string) *anthropic.Anthropic {
+	return anthropic.New(&anthropic.Options{
+		APIKey:       "sk-test",
+		URL:          url,
+		ExtraHeaders: map[string]string{"X-Backend": "yes"},
+	})
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name          string
+		stopReason    string
+		wantTruncated bool
+	}{
+		{name: "complete", stopReason: "end_turn"},
+		{name: "truncated", stopReason: "max_tokens", wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{
+					"content": [{"type": "text", "text": "Here:\n`+"```hcl\\nresource {}\\n```"+`"}],
+					"stop_reason": %q,
+					"usage": {"input_tokens": 10, "output_tokens": 5}
+				}`, tt.stopReason)
+			})
+
+			conv := newBackend(srv.URL).Chat(
+				"claude-test",
+				types.Message{Role: "system", Content: "be terse"},
+			)
+			conv.AddHeader("X-Conversation", "yes")
+
+			maxTokens := 100
+			conv.SetInferenceParams(types.InferenceParams{MaxTokens: &maxTokens})
+
+			res, err := conv.Send(context.Background(), "generate terraform")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(*requests))
+			}
+
+			req := (*requests)[0]
+			if req.method != http.MethodPost || req.path != "/messages" {
+				t.Errorf("unexpected request %s %s", req.method, req.path)
+			}
+
+			for header, want := range map[string]string{
+				"X-Api-Key":         "sk-test",
+				"Anthropic-Version": anthropic.DefaultAPIVersion,
+				"X-Backend":         "yes",
+				"X-Conversation":    "yes",
+			} {
+				if got := req.header.Get(header); got != want {
+					t.Errorf("expected header %s to be %q, got %q", header, want, got)
+				}
+			}
+
+			if req.body["model"] != "claude-test" || req.body["system"] != "be terse" {
+				t.Errorf("unexpected model or system prompt in %v", req.body)
+			}
+
+			if req.body["max_tokens"] != float64(100) {
+				t.Errorf("expected max_tokens 100, got %v", req.body["max_tokens"])
+			}
+
+			if _, ok := req.body["stream"]; ok {
+				t.Errorf("expected no stream field, got %v", req.body["stream"])
+			}
+
+			msgs, _ := req.body["messages"].([]interface{})
+			if len(msgs) != 1 {
+				t.Fatalf("expected 1 message (system prompt excluded), got %v", req.body["messages"])
+			}
+
+			if res.Code != "resource {}" {
+				t.Errorf("unexpected code %q", res.Code)
+			}
+
+			if res.TokensUsed != 15 {
+				t.Errorf("expected 15 tokens used, got %d", res.TokensUsed)
+			}
+
+			if res.StopReason != tt.stopReason {
+				t.Errorf("expected stop reason %q, got %q", tt.stopReason, res.StopReason)
+			}
+
+			if got := types.IsTruncated(res.StopReason); got != tt.wantTruncated {
+				t.Errorf("expected truncated to be %t, got %t", tt.wantTruncated, got)
+			}
+
+			if got := len(conv.Messages()); got != 3 {
+				t.Errorf("expected 3 messages in conversation, got %d", got)
+			}
+		})
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, event := range []string{
+			`{"type": "message_start", "message": {"usage": {"input_tokens": 10}}}`,
+			`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": "resource "}}`,
+			`{"type": "ping"}`,
+			`{"type": "content_block_delta", "delta": {"type": "text_delta", "text": "{}"}}`,
+			`{"type": "message_delta", "delta": {"stop_reason": "max_tokens"}, "usage": {"output_tokens": 7}}`,
+			`{"type": "message_stop"}`,
+		} {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+		}
+	})
+
+	var chunks []string
+
+	res, err := newBackend(srv.URL).Chat("claude-test").SendStream(
+		context.Background(),
+		"generate terraform",
+		func(chunk string) { chunks = append(chunks, chunk) },
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	if req.path != "/messages" || req.body["stream"] != true {
+		t.Errorf("expected a streaming request to /messages, got %s %v", req.path, req.body)
+	}
+
+	if req.header.Get("X-Api-Key") != "sk-test" {
+		t.Errorf("expected API key header, got %v", req.header)
+	}
+
+	if strings.Join(chunks, "|") != "resource |{}" {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+
+	if res.FullOutput != "resource {}" || res.TokensUsed != 17 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if !types.IsTruncated(res.StopReason) {
+		t.Errorf("expected response to be truncated, got stop reason %q", res.StopReason)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		retryAfter     string
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+		wantErr        error
+	}{
+		{
+			name:           "rate limited",
+			status:         http.StatusTooManyRequests,
+			body:           `{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`,
+			retryAfter:     "3",
+			wantRetryable:  true,
+			wantRetryAfter: 3 * time.Second,
+			wantErr:        types.ErrRequestFailed,
+		},
+		{
+			name:          "overloaded",
+			status:        529,
+			body:          `{"type": "error", "error": {"type": "overloaded_error", "message": "overloaded"}}`,
+			wantRetryable: true,
+			wantErr:       types.ErrRequestFailed,
+		},
+		{
+			name:          "unavailable without body",
+			status:        http.StatusServiceUnavailable,
+			wantRetryable: true,
+			wantErr:       types.ErrUnexpectedStatus,
+		},
+		{
+			name:    "invalid request",
+			status:  http.StatusBadRequest,
+			body:    `{"type": "error", "error": {"type": "invalid_request_error", "message": "bad"}}`,
+			wantErr: types.ErrRequestFailed,
+		},
+		{
+			name:    "unauthorized",
+			status:  http.StatusUnauthorized,
+			wantErr: types.ErrUnexpectedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%t", tt.name, stream), func(t *testing.T) {
+				srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				})
+
+				conv := newBackend(srv.URL).Chat("claude-test")
+
+				var err error
+				if stream {
+					_, err = conv.SendStream(context.Background(), "prompt", func(string) {})
+				} else {
+					_, err = conv.Send(context.Background(), "prompt")
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error wrapping %q, got %v", tt.wantErr, err)
+				}
+
+				var retryable *types.RetryableError
+				if got := errors.As(err, &retryable); got != tt.wantRetryable {
+					t.Fatalf("expected retryable to be %t, got %t", tt.wantRetryable, got)
+				}
+
+				if retryable != nil && retryable.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("expected retry after %s, got %s", tt.wantRetryAfter, retryable.RetryAfter)
+				}
+
+				if got := len(conv.Messages()); got != 0 {
+					t.Errorf("expected failed request not to be recorded, got %d messages", got)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/ido50/requests"
+)
+
+// Conversation is a struct used to converse with an Anthropic chat model. It
+// maintains all messages sent/received in order to maintain context.
+type Conversation struct {
+	backend      *Anthropic
+	model        string
+	system       string
+	messages     []types.Message
+	extraHeaders map[string]string
+	params       types.InferenceParams
+}
+
+type chatResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      usage  `json:"usage"`
+}
+
+type usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+type streamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage usage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage usage `json:"usage"`
+	errorResponse
+}
+
+// Chat initiates a conversation with an Anthropic chat model. A conversation
+// maintains context, allowing to send further instructions to modify the output
+// from previous requests. The name of the model to use must be provided. Users
+// can also supply zero or more "previous messages" that may have been exchanged
+// in the past. This practically allows "loading" previous conversations and
+// continuing them. As the Messages API does not accept system messages as part
+// of the conversation, any messages with the "system" role are sent as the
+// system prompt instead.
+func (backend *Anthropic) Chat(model string, msgs ...types.Message) types.Conversation {
+	conv := &Conversation{
+		backend: backend,
+		model:   model,
+	}
+
+	for _, msg := range msgs {
+		if msg.Role == "system" {
+			conv.system = msg.Content
+			continue
+		}
+
+		conv.messages = append(conv.messages, msg)
+	}
+
+	return conv
+}
+
+// Send sends the provided message to the API and returns a Response object.
+// To maintain context, all previous messages (whether from you to the API or
+// vice-versa) are sent as well, allowing you to ask the API to modify the
+// code it already generated.
+func (conv *Conversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	var (
+		answer     chatResponse
+		retryAfter string
+	)
+
+	err = conv.newRequest(prompt).
+		Into(&answer).
+		HeaderInto("Retry-After", &retryAfter).
+		RunContext(ctx)
+	if err != nil {
+		return res, fmt.Errorf(
+			"failed sending prompt: %w",
+			types.WithRetryAfter(err, retryAfter),
+		)
+	}
+
+	var content strings.Builder
+	for _, block := range answer.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	if content.Len() == 0 {
+		return res, types.ErrNoResults
+	}
+
+	return conv.finish(
+		prompt,
+		content.String(),
+		answer.Usage.InputTokens+answer.Usage.OutputTokens,
+		answer.StopReason,
+	), nil
+}
+
+// SendStream is the same as Send, but streams the response via server-sent
+// events. The provided function is called with every chunk of text as it
+// is received from the API.
+func (conv *Conversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	stream, err := types.OpenStream(ctx, types.StreamRequest{
+		Client:       conv.backend.httpClient,
+		URL:          conv.backend.url + "/messages",
+		Headers:      conv.backend.headers,
+		ExtraHeaders: conv.extraHeaders,
+		Body:         conv.requestBody(prompt, true),
+		ErrorHandler: handleError,
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", err)
+	}
+	defer stream.Close()
+
+	var (
+		content    strings.Builder
+		tokensUsed int64
+		stopReason string
+	)
+
+	for stream.Scan() {
+		line := stream.Bytes()
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+
+		var event streamEvent
+		err = json.Unmarshal(bytes.TrimPrefix(line, []byte("data:")), &event)
+		if err != nil {
+			return res, fmt.Errorf("failed decoding stream: %w", err)
+		}
+
+		switch event.Type {
+		case "error":
+			return res, event.err()
+		case "message_start":
+			tokensUsed += event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Text != "" {
+				content.WriteString(event.Delta.Text)
+				fn(event.Delta.Text)
+			}
+		case "message_delta":
+			stopReason = event.Delta.StopReason
+			tokensUsed += event.Usage.OutputTokens
+		}
+
+		if event.Type == "message_stop" {
+			break
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return res, fmt.Errorf("failed reading stream: %w", err)
+	}
+
+	if content.Len() == 0 {
+		return res, types.ErrNoResults
+	}
+
+	return conv.finish(prompt, content.String(), tokensUsed, stopReason), nil
+}
+
+// newRequest creates a request to the Messages API for the conversation,
+// including all messages exchanged so far and the new prompt.
+func (conv *Conversation) newRequest(prompt string) *requests.HTTPRequest {
+	req := conv.backend.
+		NewRequest("POST", "/messages").
+		JSONBody(conv.requestBody(prompt, false))
+
+	for key, val := range conv.extraHeaders {
+		req.Header(key, val)
+	}
+
+	return req
+}
+
+// requestBody returns the body of a request to the Messages API for the
+// conversation, including all messages exchanged so far and the new prompt.
+func (conv *Conversation) requestBody(prompt string, stream bool) map[string]interface{} {
+	messages := append(
+		conv.messages[:len(conv.messages):len(conv.messages)],
+		types.Message{Role: "user", Content: prompt},
+	)
+
+	maxTokens := DefaultMaxTokens
+	if conv.params.MaxTokens != nil {
+		maxTokens = *conv.params.MaxTokens
+	}
+
+	body := map[string]interface{}{
+		"model":       conv.model,
+		"messages":    messages,
+		"max_tokens":  maxTokens,
+		"temperature": conv.params.GetTemperature(),
+	}
+
+	if conv.params.TopP != nil {
+		body["top_p"] = *conv.params.TopP
+	}
+
+	if len(conv.params.StopSequences) > 0 {
+		body["stop_sequences"] = conv.params.StopSequences
+	}
+
+	if conv.system != "" {
+		body["system"] = conv.system
+	}
+
+	if stream {
+		body["stream"] = true
+	}
+
+	return body
+}
+
+// finish records the user's prompt and the assistant's response in the
+// conversation and creates the Response object returned to the caller. The
+// conversation is only updated once a response is received, so that failed
+// requests can be retried without duplicating the user's prompt.
+func (conv *Conversation) finish(
+	prompt string,
+	output string,
+	tokensUsed int64,
+	stopReason string,
+) (res types.Response) {
+	conv.messages = append(
+		conv.messages,
+		types.Message{Role: "user", Content: prompt},
+		types.Message{Role: "assistant", Content: output},
+	)
+
+	res.FullOutput = strings.TrimSpace(output)
+	res.APIKeyUsed = conv.backend.apiKey
+	res.TokensUsed = tokensUsed
+	res.StopReason = stopReason
+
+	var ok bool
+	if res.Code, ok = types.ExtractCode(res.FullOutput); !ok {
+		res.Code = res.FullOutput
+	}
+
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res
+}
+
+// Messages returns all the messages that have been exchanged between the user
+// and the assistant up to this point. If the conversation has a system prompt,
+// it is returned as the first message, with the "system" role.
+func (conv *Conversation) Messages() []types.Message {
+	if conv.system == "" {
+		return conv.messages
+	}
+
+	return append(
+		[]types.Message{{Role: "system", Content: conv.system}},
+		conv.messages...,
+	)
+}
+
+// AddHeader adds an extra HTTP header that will be added to every HTTP
+// request issued as part of this conversation. Any headers added will be in
+// addition to any extra headers defined for the backend itself, and will
+// take precedence over them.
+func (conv *Conversation) AddHeader(key, val string) {
+	if conv.extraHeaders == nil {
+		conv.extraHeaders = make(map[string]string)
+	}
+	conv.extraHeaders[key] = val
+}
+
+// SetInferenceParams sets the parameters that control how the model
+// generates responses for all subsequent messages in this conversation.
+func (conv *Conversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = params
+}
@@ -0,0 +1,65 @@
+package anthropic
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// ListModels returns a list of all the models supported by this backend.
+func (backend *Anthropic) ListModels(ctx context.Context) (
+	models []string,
+	err error,
+) {
+	var afterID string
+
+	for {
+		var retryAfter string
+
+		var answer struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+		}
+
+		req := backend.
+			NewRequest("GET", "/models").
+			QueryParam("limit", "1000").
+			Into(&answer).
+			HeaderInto("Retry-After", &retryAfter)
+
+		if afterID != "" {
+			req.QueryParam("after_id", afterID)
+		}
+
+		err = req.RunContext(ctx)
+		if err != nil {
+			return models, fmt.Errorf(
+				"failed listing models: %w",
+				types.WithRetryAfter(err, retryAfter),
+			)
+		}
+
+		for i := range answer.Data {
+			models = append(models, answer.Data[i].ID)
+		}
+
+		if !answer.HasMore || answer.LastID == "" {
+			break
+		}
+
+		afterID = answer.LastID
+	}
+
+	if len(models) == 0 {
+		return models, types.ErrNoResults
+	}
+
+	sort.Strings(models)
+
+	return models, nil
+}
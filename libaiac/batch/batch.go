@@ -0,0 +1,297 @@
+// Package batch implements generation of code for multiple prompts, read from
+// a manifest file, by a bounded pool of concurrent workers sharing a single
+// libaiac.Aiac instance.
+package batch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConcurrency is the default number of jobs executed concurrently.
+const DefaultConcurrency = 4
+
+// DefaultTimeout is the default maximum duration of a single job.
+const DefaultTimeout = 2 * time.Minute
+
+// Job is a single code generation job.
+type Job struct {
+	// Name identifies the job in results. Defaults to the output path.
+	Name string `yaml:"name"`
+
+	// Prompt is the prompt sent to the model, as-is. Either Prompt or
+	// Template must be provided.
+	Prompt string `yaml:"prompt"`
+
+	// Template is the name of a prompt template to render the prompt from,
+	// with the variables in Vars (see Aiac.Templates).
+	Template string `yaml:"template"`
+
+	// Vars are the variables used to render Template.
+	Vars map[string]string `yaml:"vars"`
+
+	// Backend is the name of the backend to use. Defaults to the default
+	// backend of the configuration.
+	Backend string `yaml:"backend"`
+
+	// Model is the name of the model to use. Defaults to the backend's
+	// default model.
+	Model string `yaml:"model"`
+
+	// Output is the path of the file the generated code is saved to. If
+	// empty, the code is not saved, and is only available in the job's
+	// result.
+	Output string `yaml:"output"`
+}
+
+// Manifest is a list of jobs, usually loaded from a YAML file.
+type Manifest struct {
+	// Concurrency is the number of jobs to execute concurrently. Optional.
+	Concurrency int `yaml:"concurrency"`
+
+	// Defaults are default values for the backend and model of jobs that do
+	// not select them. Optional.
+	Defaults struct {
+		Backend string `yaml:"backend"`
+		Model   string `yaml:"model"`
+	} `yaml:"defaults"`
+
+	// Jobs are the jobs to execute.
+	Jobs []Job `yaml:"jobs"`
+}
+
+// LoadManifest loads a manifest from a YAML file. Relative output paths are
+// resolved relative to the directory of the manifest file, and the defaults
+// are applied to the jobs.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading manifest: %w", err)
+	}
+
+	manifest := &Manifest{}
+	err = yaml.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding manifest: %w", err)
+	}
+
+	if len(manifest.Jobs) == 0 {
+		return nil, fmt.Errorf("%w: no jobs defined", types.ErrInvalidManifest)
+	}
+
+	for i := range manifest.Jobs {
+		job := &manifest.Jobs[i]
+
+		if job.Prompt == "" && job.Template == "" {
+			return nil, fmt.Errorf(
+				"%w: job %d has neither a prompt nor a template",
+				types.ErrInvalidManifest, i+1,
+			)
+		}
+
+		if job.Output != "" && !filepath.IsAbs(job.Output) {
+			job.Output = filepath.Join(filepath.Dir(path), job.Output)
+		}
+
+		if job.Backend == "" {
+			job.Backend = manifest.Defaults.Backend
+		}
+
+		if job.Model == "" {
+			job.Model = manifest.Defaults.Model
+		}
+	}
+
+	return manifest, nil
+}
+
+// Result is the result of a job.
+type Result struct {
+	// Job is the job that was executed. Its Name is always set.
+	Job Job
+
+	// Response is the response generated for the job, if any.
+	Response types.Response
+
+	// Err is the error that caused the job to fail, or nil if it succeeded.
+	Err error
+
+	// Duration is the time it took to execute the job.
+	Duration time.Duration
+}
+
+// Succeeded returns true if the job succeeded.
+func (res Result) Succeeded() bool {
+	return res.Err == nil
+}
+
+// Runner executes batches of jobs.
+type Runner struct {
+	aiac *libaiac.Aiac
+	opts Options
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Concurrency is the maximum number of jobs executed concurrently.
+	// Defaults to DefaultConcurrency.
+	Concurrency int
+
+	// Timeout is the maximum duration of a single job. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// Overwrite allows jobs to overwrite existing output files. Otherwise,
+	// jobs whose output file already exists fail with an error wrapping
+	// types.ErrFileExists, before the prompt is sent.
+	Overwrite bool
+
+	// OnDone, if provided, is called whenever a job finishes, with its
+	// result. It may be called concurrently from multiple goroutines.
+	OnDone func(Result)
+}
+
+// New creates a new instance of the Runner struct, executing jobs with the
+// provided Aiac instance. opts may be nil.
+func New(aiac *libaiac.Aiac, opts *Options) *Runner {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	runner := &Runner{aiac: aiac, opts: *opts}
+
+	if runner.opts.Concurrency <= 0 {
+		runner.opts.Concurrency = DefaultConcurrency
+	}
+
+	if runner.opts.Timeout <= 0 {
+		runner.opts.Timeout = DefaultTimeout
+	}
+
+	return runner
+}
+
+// Run executes the provided jobs, and returns their results in the same order
+// as the jobs. Jobs without a name are named after their output path, or
+// their position. Jobs that did not start before the context was canceled
+// fail with the context's error.
+func (runner *Runner) Run(ctx context.Context, jobs []Job) []Result {
+	jobs = append([]Job(nil), jobs...)
+	for i := range jobs {
+		if jobs[i].Name == "" {
+			jobs[i].Name = jobs[i].Output
+		}
+		if jobs[i].Name == "" {
+			jobs[i].Name = fmt.Sprintf("job %d", i+1)
+		}
+	}
+
+	results := make([]Result, len(jobs))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runner.opts.Concurrency && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = runner.runJob(ctx, jobs[i])
+				if runner.opts.OnDone != nil {
+					runner.opts.OnDone(results[i])
+				}
+			}
+		}()
+	}
+
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+
+	wg.Wait()
+
+	return results
+}
+
+func (runner *Runner) runJob(ctx context.Context, job Job) (res Result) {
+	res.Job = job
+	started := time.Now()
+	defer func() {
+		res.Duration = time.Since(started)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		res.Err = err
+		return res
+	}
+
+	if job.Output != "" && !runner.opts.Overwrite {
+		if _, err := os.Stat(job.Output); err == nil {
+			res.Err = fmt.Errorf("%w: %s", types.ErrFileExists, job.Output)
+			return res
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runner.opts.Timeout)
+	defer cancel()
+
+	prompt := job.Prompt
+	if job.Template != "" {
+		var err error
+		prompt, err = runner.aiac.Templates().Render(job.Template, job.Vars)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+	}
+
+	chat, err := runner.aiac.ChatWithOptions(ctx, job.Backend, job.Model, libaiac.ChatOptions{})
+	if err != nil {
+		res.Err = fmt.Errorf("failed starting chat: %w", err)
+		return res
+	}
+
+	res.Response, err = chat.Send(ctx, prompt)
+	if err != nil {
+		res.Err = fmt.Errorf("failed generating code: %w", err)
+		return res
+	}
+
+	switch {
+	case types.IsTruncated(res.Response.StopReason):
+		res.Err = fmt.Errorf("%w (%s)", types.ErrResponseTruncated, res.Response.StopReason)
+		return res
+	case len(res.Response.Files) == 0:
+		res.Err = types.ErrNoCodeBlocks
+		return res
+	}
+
+	if job.Output != "" {
+		res.Err = saveCode(job.Output, res.Response.Code)
+	}
+
+	return res
+}
+
+func saveCode(path, code string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed creating directory for %s: %w", path, err)
+	}
+
+	err = os.WriteFile(path, []byte(code+"\n"), 0o644) //nolint: gosec
+	if err != nil {
+		return fmt.Errorf("failed saving %s: %w", path, err)
+	}
+
+	return nil
+}
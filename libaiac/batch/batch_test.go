@@ -0,0 +1,261 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/batch"
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestLoadManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []batch.Job
+		wantErr  error
+	}{
+		{
+			name: "valid",
+			manifest: `
+concurrency: 2
+defaults:
+  backend: mock
+  model: small
+jobs:
+  - prompt: generate terraform for an s3 bucket
+    output: infra/s3.tf
+  - template: tf-module
+    vars: {cloud: aws}
+    backend: other
+    model: large
+    output: /abs/module.tf
+`,
+			want: []batch.Job{
+				{
+					Prompt:  "generate terraform for an s3 bucket",
+					Backend: "mock",
+					Model:   "small",
+					Output:  "infra/s3.tf",
+				},
+				{
+					Template: "tf-module",
+					Vars:     map[string]string{"cloud": "aws"},
+					Backend:  "other",
+					Model:    "large",
+					Output:   "/abs/module.tf",
+				},
+			},
+		},
+		{
+			name:     "no jobs",
+			manifest: "concurrency: 2\n",
+			wantErr:  types.ErrInvalidManifest,
+		},
+		{
+			name:     "no prompt",
+			manifest: "jobs:\n  - output: main.tf\n",
+			wantErr:  types.ErrInvalidManifest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "manifest.yaml")
+			if err := os.WriteFile(path, []byte(tt.manifest), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := batch.LoadManifest(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(manifest.Jobs) != len(tt.want) {
+				t.Fatalf("expected %d jobs, got %d", len(tt.want), len(manifest.Jobs))
+			}
+
+			for i, job := range manifest.Jobs {
+				want := tt.want[i]
+				if !filepath.IsAbs(want.Output) {
+					want.Output = filepath.Join(dir, want.Output)
+				}
+
+				if job.Prompt != want.Prompt || job.Template != want.Template ||
+					job.Backend != want.Backend || job.Model != want.Model ||
+					job.Output != want.Output || len(job.Vars) != len(want.Vars) {
+					t.Errorf("expected job %d to be %+v, got %+v", i+1, want, job)
+				}
+			}
+		})
+	}
+}
+
+// newAiac creates an Aiac object with a single mock backend with the provided
+// fixtures.
+func newAiac(t *testing.T, fixtures ...mock.Fixture) (*libaiac.Aiac, *mock.Mock) {
+	t.Helper()
+
+	backend, err := mock.New(&mock.Options{Fixtures: fixtures})
+	if err != nil {
+		t.Fatalf("failed creating mock backend: %s", err)
+	}
+
+	aiac := &libaiac.Aiac{
+		Conf: libaiac.Config{
+			DefaultBackend: "mock",
+			Backends: map[string]libaiac.BackendConfig{
+				"mock": {Type: libaiac.BackendMock, DefaultModel: "mock-model"},
+			},
+			Templates: map[string]string{
+				"bucket": `generate terraform for a {{ required "cloud" }} bucket`,
+			},
+			TemplatesDir: t.TempDir(),
+		},
+		Backends: map[string]types.Backend{"mock": backend},
+	}
+
+	return aiac, backend
+}
+
+func TestRun(t *testing.T) {
+	aiac, backend := newAiac(t,
+		mock.Fixture{Prompt: "s3", Response: "```hcl\nresource \"aws_s3_bucket\" \"b\" {}\n```"},
+		mock.Fixture{
+			Prompt:   "generate terraform for a gcp bucket",
+			Response: "```hcl\nresource \"google_storage_bucket\" \"b\" {}\n```",
+		},
+		mock.Fixture{Prompt: "long", Response: "```hcl\nresource", StopReason: "length"},
+		mock.Fixture{Prompt: "chatty", Response: "I'd rather not."},
+		mock.Fixture{Prompt: "invalid", Error: "bad request"},
+	)
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.tf")
+	if err := os.WriteFile(existing, []byte("# keep me\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := []batch.Job{
+		{Prompt: "s3", Output: filepath.Join(dir, "nested", "s3.tf")},
+		{Name: "gcs", Template: "bucket", Vars: map[string]string{"cloud": "gcp"}},
+		{Prompt: "long"},
+		{Prompt: "chatty"},
+		{Prompt: "invalid"},
+		{Template: "bucket"},
+		{Prompt: "s3", Output: existing},
+		{Prompt: "s3", Backend: "missing"},
+	}
+
+	var mu sync.Mutex
+	var done int
+
+	results := batch.New(aiac, &batch.Options{
+		Concurrency: 3,
+		OnDone: func(batch.Result) {
+			mu.Lock()
+			done++
+			mu.Unlock()
+		},
+	}).Run(context.Background(), jobs)
+
+	want := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{name: filepath.Join(dir, "nested", "s3.tf"), code: `resource "aws_s3_bucket" "b" {}`},
+		{name: "gcs", code: `resource "google_storage_bucket" "b" {}`},
+		{name: "job 3", err: types.ErrResponseTruncated},
+		{name: "job 4", err: types.ErrNoCodeBlocks},
+		{name: "job 5", err: types.ErrRequestFailed},
+		{name: "job 6", err: types.ErrMissingVariable},
+		{name: existing, err: types.ErrFileExists},
+		{name: "job 8", err: types.ErrNoSuchBackend},
+	}
+
+	if len(results) != len(want) || done != len(want) {
+		t.Fatalf("expected %d results, got %d (%d reported)", len(want), len(results), done)
+	}
+
+	for i, res := range results {
+		if res.Job.Name != want[i].name {
+			t.Errorf("expected job %d to be named %q, got %q", i+1, want[i].name, res.Job.Name)
+		}
+
+		if !errors.Is(res.Err, want[i].err) || res.Succeeded() != (want[i].err == nil) {
+			t.Errorf("expected job %s to fail with %v, got %v", res.Job.Name, want[i].err, res.Err)
+		}
+
+		if want[i].code != "" && res.Response.Code != want[i].code {
+			t.Errorf("expected job %s to generate %q, got %q", res.Job.Name, want[i].code, res.Response.Code)
+		}
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, "nested", "s3.tf"))
+	if err != nil || string(saved) != "resource \"aws_s3_bucket\" \"b\" {}\n" {
+		t.Errorf("unexpected saved code %q (%v)", saved, err)
+	}
+
+	kept, _ := os.ReadFile(existing)
+	if string(kept) != "# keep me\n" {
+		t.Errorf("expected existing file to be kept, got %q", kept)
+	}
+
+	// jobs whose output exists, or whose prompt can't be rendered, don't
+	// send requests
+	if got := len(backend.Requests()); got != 5 {
+		t.Errorf("expected 5 requests, got %d", got)
+	}
+}
+
+func TestRunOverwrite(t *testing.T) {
+	aiac, _ := newAiac(t, mock.Fixture{Response: "```hcl\nlocals {}\n```"})
+
+	output := filepath.Join(t.TempDir(), "main.tf")
+	if err := os.WriteFile(output, []byte("# old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	results := batch.New(aiac, &batch.Options{Overwrite: true}).
+		Run(context.Background(), []batch.Job{{Prompt: "prompt", Output: output}})
+
+	if results[0].Err != nil {
+		t.Fatalf("unexpected error: %s", results[0].Err)
+	}
+
+	saved, _ := os.ReadFile(output)
+	if string(saved) != "locals {}\n" {
+		t.Errorf("expected file to be overwritten, got %q", saved)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	aiac, backend := newAiac(t, mock.Fixture{Response: "```hcl\nlocals {}\n```"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := batch.New(aiac, nil).Run(ctx, []batch.Job{{Prompt: "a"}, {Prompt: "b"}})
+
+	for _, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("expected job %s to be canceled, got %v", res.Job.Name, res.Err)
+		}
+	}
+
+	if got := len(backend.Requests()); got != 0 {
+		t.Errorf("expected no requests, got %d", got)
+	}
+}
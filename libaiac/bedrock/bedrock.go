@@ -1,9 +1,14 @@
 package bedrock
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrock"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/smithy-go"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
 )
 
 // Bedrock is the struct that implements libaiac's Backend interface.
@@ -22,6 +27,48 @@ const (
 	DefaultAWSProfile = "default"
 )
 
+// retryableErrorCodes are the codes of errors returned by Bedrock for
+// requests that may succeed if retried.
+var retryableErrorCodes = map[string]bool{
+	"ThrottlingException":         true,
+	"ServiceUnavailableException": true,
+	"ModelNotReadyException":      true,
+	"ModelTimeoutException":       true,
+	"InternalServerException":     true,
+}
+
+// invalidRequestErrorCodes are the codes of errors returned by Bedrock for
+// requests that are invalid and should not be retried.
+var invalidRequestErrorCodes = map[string]bool{
+	"ValidationException":       true,
+	"AccessDeniedException":     true,
+	"ResourceNotFoundException": true,
+}
+
+// wrapError translates errors returned by the AWS SDK into libaiac's errors:
+// temporary errors are wrapped in a types.RetryableError, and invalid
+// requests are reported as types.ErrRequestFailed.
+func wrapError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch {
+	case retryableErrorCodes[apiErr.ErrorCode()]:
+		return &types.RetryableError{Err: err}
+	case invalidRequestErrorCodes[apiErr.ErrorCode()]:
+		return fmt.Errorf(
+			"%w: [%s]: %s",
+			types.ErrRequestFailed,
+			apiErr.ErrorCode(),
+			apiErr.ErrorMessage(),
+		)
+	default:
+		return err
+	}
+}
+
 // New constructs a new Bedrock object. It receives a standard aws.Config
 // object.
 func New(cfg aws.Config) *Bedrock {
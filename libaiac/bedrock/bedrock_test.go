@@ -0,0 +1,248 @@
+package bedrock_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/gofireflyio/aiac/v5/libaiac/bedrock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// request is a request received by the test server.
+type request struct {
+	path string
+	body map[string]interface{}
+}
+
+// newServer starts a test server that records every request it receives and
+// responds with the provided handler, and returns a Bedrock backend that
+// sends its requests to the server.
+func newServer(t *testing.T, handler http.HandlerFunc) (*bedrock.Bedrock, *[]request) {
+	t.Helper()
+
+	var requests []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{path: r.URL.Path}
+
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			t.Errorf("request body is not valid JSON: %s", err)
+		}
+
+		requests = append(requests, req)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return bedrock.New(aws.Config{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}),
+		RetryMaxAttempts: 1,
+	}), &requests
+}
+
+// event is a message in a Bedrock event stream.
+type event struct {
+	messageType string
+	eventType   string
+	payload     string
+}
+
+// writeEvents writes the provided events as an AWS event stream.
+func writeEvents(t *testing.T, w http.ResponseWriter, events ...event) {
+	w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+
+	encoder := eventstream.NewEncoder()
+
+	for _, e := range events {
+		msg := eventstream.Message{Payload: []byte(e.payload)}
+		msg.Headers.Set(":message-type", eventstream.StringValue(e.messageType))
+		msg.Headers.Set(":content-type", eventstream.StringValue("application/json"))
+		if e.messageType == "exception" {
+			msg.Headers.Set(":exception-type", eventstream.StringValue(e.eventType))
+		} else {
+			msg.Headers.Set(":event-type", eventstream.StringValue(e.eventType))
+		}
+
+		if err := encoder.Encode(w, msg); err != nil {
+			t.Errorf("failed encoding event: %s", err)
+		}
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestSend(t *testing.T) {
+	backend, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"output": {"message": {"role": "assistant", "content": [{"text": "`+"```hcl\\nresource {}\\n```"+`"}]}},
+			"stopReason": "end_turn",
+			"usage": {"inputTokens": 10, "outputTokens": 5, "totalTokens": 15}
+		}`)
+	})
+
+	conv := backend.Chat("anthropic.claude-test", types.Message{Role: "system", Content: "be terse"})
+
+	maxTokens := 100
+	conv.SetInferenceParams(types.InferenceParams{MaxTokens: &maxTokens})
+
+	res, err := conv.Send(context.Background(), "generate terraform")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	if req.path != "/model/anthropic.claude-test/converse" {
+		t.Errorf("unexpected request path %s", req.path)
+	}
+
+	if _, ok := req.body["system"]; !ok {
+		t.Errorf("expected a system prompt in %v", req.body)
+	}
+
+	config, _ := req.body["inferenceConfig"].(map[string]interface{})
+	if config["maxTokens"] != float64(100) {
+		t.Errorf("expected maxTokens 100, got %v", req.body["inferenceConfig"])
+	}
+
+	if res.Code != "resource {}" || res.TokensUsed != 15 || res.StopReason != "end_turn" {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if got := len(conv.Messages()); got != 3 {
+		t.Errorf("expected 3 messages in conversation, got %d", got)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	backend, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w,
+			event{"event", "messageStart", `{"role": "assistant"}`},
+			event{"event", "contentBlockDelta", `{"contentBlockIndex": 0, "delta": {"text": "resource "}}`},
+			event{"event", "contentBlockDelta", `{"contentBlockIndex": 0, "delta": {"text": "{}"}}`},
+			event{"event", "contentBlockStop", `{"contentBlockIndex": 0}`},
+			event{"event", "messageStop", `{"stopReason": "max_tokens"}`},
+			event{"event", "metadata", `{"usage": {"inputTokens": 10, "outputTokens": 7, "totalTokens": 17}, "metrics": {"latencyMs": 1}}`},
+		)
+	})
+
+	conv := backend.Chat("anthropic.claude-test")
+
+	var chunks []string
+	res, err := conv.SendStream(context.Background(), "generate terraform", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if path := (*requests)[0].path; path != "/model/anthropic.claude-test/converse-stream" {
+		t.Errorf("unexpected request path %s", path)
+	}
+
+	if strings.Join(chunks, "|") != "resource |{}" {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+
+	if res.FullOutput != "resource {}" || res.TokensUsed != 17 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if !types.IsTruncated(res.StopReason) {
+		t.Errorf("expected response to be truncated, got stop reason %q", res.StopReason)
+	}
+
+	if got := len(conv.Messages()); got != 2 {
+		t.Errorf("expected 2 messages in conversation, got %d", got)
+	}
+}
+
+func TestSendStreamError(t *testing.T) {
+	backend, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w,
+			event{"event", "messageStart", `{"role": "assistant"}`},
+			event{"event", "contentBlockDelta", `{"contentBlockIndex": 0, "delta": {"text": "resource "}}`},
+			event{"exception", "throttlingException", `{"message": "slow down"}`},
+		)
+	})
+
+	conv := backend.Chat("anthropic.claude-test")
+
+	_, err := conv.SendStream(context.Background(), "prompt", func(string) {})
+
+	var retryable *types.RetryableError
+	if !errors.As(err, &retryable) || !strings.Contains(err.Error(), "slow down") {
+		t.Fatalf("expected a retryable throttling error, got %v", err)
+	}
+
+	if got := len(conv.Messages()); got != 0 {
+		t.Errorf("expected failed request not to be recorded, got %d messages", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		errorType     string
+		wantRetryable bool
+		wantErr       error
+	}{
+		{
+			name:          "throttled",
+			status:        http.StatusTooManyRequests,
+			errorType:     "ThrottlingException",
+			wantRetryable: true,
+		},
+		{
+			name:      "invalid request",
+			status:    http.StatusBadRequest,
+			errorType: "ValidationException",
+			wantErr:   types.ErrRequestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%t", tt.name, stream), func(t *testing.T) {
+				backend, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("X-Amzn-Errortype", tt.errorType)
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, `{"message": "request failed"}`)
+				})
+
+				conv := backend.Chat("anthropic.claude-test")
+
+				var err error
+				if stream {
+					_, err = conv.SendStream(context.Background(), "prompt", func(string) {})
+				} else {
+					_, err = conv.Send(context.Background(), "prompt")
+				}
+
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("expected error wrapping %v, got %v", tt.wantErr, err)
+				}
+
+				var retryable *types.RetryableError
+				if got := errors.As(err, &retryable); got != tt.wantRetryable {
+					t.Errorf("expected retryable to be %t, got %t", tt.wantRetryable, got)
+				}
+			})
+		}
+	}
+}
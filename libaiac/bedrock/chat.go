@@ -3,6 +3,7 @@ package bedrock
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
@@ -15,7 +16,9 @@ import (
 type Conversation struct {
 	backend  *Bedrock
 	model    string
+	system   []bedrocktypes.SystemContentBlock
 	messages []bedrocktypes.Message
+	params   types.InferenceParams
 }
 
 // Chat initiates a conversation with a Bedrock chat model. A conversation
@@ -23,28 +26,34 @@ type Conversation struct {
 // from previous requests. The name of the model to use must be provided. Users
 // can also supply zero or more "previous messages" that may have been exchanged
 // in the past. This practically allows "loading" previous conversations and
-// continuing them.
+// continuing them. Messages with the "system" role are sent to Bedrock as
+// system prompts rather than as part of the conversation.
 func (backend *Bedrock) Chat(model string, msgs ...types.Message) types.Conversation {
 	conv := &Conversation{
 		backend: backend,
 		model:   model,
 	}
 
-	if len(msgs) > 0 {
-		conv.messages = make([]bedrocktypes.Message, len(msgs))
-		for i := range msgs {
-			role := bedrocktypes.ConversationRoleUser
-			if msgs[i].Role == "assistant" {
-				role = bedrocktypes.ConversationRoleAssistant
-			}
+	for i := range msgs {
+		if msgs[i].Role == "system" {
+			conv.system = append(
+				conv.system,
+				&bedrocktypes.SystemContentBlockMemberText{Value: msgs[i].Content},
+			)
+			continue
+		}
 
-			conv.messages[i] = bedrocktypes.Message{
-				Role: role,
-				Content: []bedrocktypes.ContentBlock{
-					&bedrocktypes.ContentBlockMemberText{Value: msgs[i].Content},
-				},
-			}
+		role := bedrocktypes.ConversationRoleUser
+		if msgs[i].Role == "assistant" {
+			role = bedrocktypes.ConversationRoleAssistant
 		}
+
+		conv.messages = append(conv.messages, bedrocktypes.Message{
+			Role: role,
+			Content: []bedrocktypes.ContentBlock{
+				&bedrocktypes.ContentBlockMemberText{Value: msgs[i].Content},
+			},
+		})
 	}
 
 	return conv
@@ -58,24 +67,16 @@ func (conv *Conversation) Send(ctx context.Context, prompt string) (
 	res types.Response,
 	err error,
 ) {
-	conv.messages = append(conv.messages, bedrocktypes.Message{
-		Role: bedrocktypes.ConversationRoleUser,
-		Content: []bedrocktypes.ContentBlock{
-			&bedrocktypes.ContentBlockMemberText{Value: prompt},
-		},
-	})
-
 	input := bedrockruntime.ConverseInput{
-		ModelId:  aws.String(conv.model),
-		Messages: conv.messages,
-		InferenceConfig: &bedrocktypes.InferenceConfiguration{
-			Temperature: aws.Float32(0.2),
-		},
+		ModelId:         aws.String(conv.model),
+		Messages:        conv.pendingMessages(prompt),
+		System:          conv.system,
+		InferenceConfig: conv.inferenceConfig(),
 	}
 
 	output, err := conv.backend.runtime.Converse(ctx, &input)
 	if err != nil {
-		return res, fmt.Errorf("failed sending prompt: %w", err)
+		return res, fmt.Errorf("failed sending prompt: %w", wrapError(err))
 	}
 
 	outputMsgMember, ok := output.Output.(*bedrocktypes.ConverseOutputMemberMessage)
@@ -94,32 +95,167 @@ func (conv *Conversation) Send(ctx context.Context, prompt string) (
 		return res, fmt.Errorf("Bedrock return an unexpected response")
 	}
 
-	res.FullOutput = outputTxt.Value
-	res.TokensUsed = int64(*output.Usage.TotalTokens)
-	res.StopReason = string(output.StopReason)
+	var tokensUsed int64
+	if output.Usage != nil {
+		tokensUsed = int64(*output.Usage.TotalTokens)
+	}
+
+	return conv.finish(prompt, outputTxt.Value, tokensUsed, output.StopReason), nil
+}
+
+// SendStream is the same as Send, but uses Bedrock's ConverseStream API to
+// stream the response. The provided function is called with every chunk of
+// text as it is received.
+func (conv *Conversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	input := bedrockruntime.ConverseStreamInput{
+		ModelId:         aws.String(conv.model),
+		Messages:        conv.pendingMessages(prompt),
+		System:          conv.system,
+		InferenceConfig: conv.inferenceConfig(),
+	}
+
+	output, err := conv.backend.runtime.ConverseStream(ctx, &input)
+	if err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", wrapError(err))
+	}
+
+	stream := output.GetStream()
+	defer stream.Close()
+
+	var (
+		content    strings.Builder
+		tokensUsed int64
+		stopReason bedrocktypes.StopReason
+	)
+
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *bedrocktypes.ConverseStreamOutputMemberContentBlockDelta:
+			delta, ok := e.Value.Delta.(*bedrocktypes.ContentBlockDeltaMemberText)
+			if ok && delta.Value != "" {
+				content.WriteString(delta.Value)
+				fn(delta.Value)
+			}
+		case *bedrocktypes.ConverseStreamOutputMemberMessageStop:
+			stopReason = e.Value.StopReason
+		case *bedrocktypes.ConverseStreamOutputMemberMetadata:
+			if e.Value.Usage != nil && e.Value.Usage.TotalTokens != nil {
+				tokensUsed = int64(*e.Value.Usage.TotalTokens)
+			}
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return res, fmt.Errorf("failed reading stream: %w", wrapError(err))
+	}
+
+	if content.Len() == 0 {
+		return res, fmt.Errorf("Bedrock didn't return any message")
+	}
+
+	return conv.finish(prompt, content.String(), tokensUsed, stopReason), nil
+}
+
+// inferenceConfig translates the conversation's inference parameters into
+// Bedrock's InferenceConfiguration. Bedrock does not support seeds, so that
+// parameter is ignored.
+func (conv *Conversation) inferenceConfig() *bedrocktypes.InferenceConfiguration {
+	config := &bedrocktypes.InferenceConfiguration{
+		Temperature:   aws.Float32(float32(conv.params.GetTemperature())),
+		StopSequences: conv.params.StopSequences,
+	}
+
+	if conv.params.MaxTokens != nil {
+		config.MaxTokens = aws.Int32(int32(*conv.params.MaxTokens))
+	}
+
+	if conv.params.TopP != nil {
+		config.TopP = aws.Float32(float32(*conv.params.TopP))
+	}
+
+	return config
+}
+
+// pendingMessages returns all messages exchanged so far, plus the new prompt.
+// The conversation itself is only updated once a response is received.
+func (conv *Conversation) pendingMessages(prompt string) []bedrocktypes.Message {
+	return append(
+		conv.messages[:len(conv.messages):len(conv.messages)],
+		bedrocktypes.Message{
+			Role: bedrocktypes.ConversationRoleUser,
+			Content: []bedrocktypes.ContentBlock{
+				&bedrocktypes.ContentBlockMemberText{Value: prompt},
+			},
+		},
+	)
+}
+
+// finish records the user's prompt and the assistant's response in the
+// conversation and creates the Response object returned to the caller. The
+// conversation is only updated once a response is received, so that failed
+// requests can be retried without duplicating the user's prompt.
+func (conv *Conversation) finish(
+	prompt string,
+	output string,
+	tokensUsed int64,
+	stopReason bedrocktypes.StopReason,
+) (res types.Response) {
+	conv.messages = append(
+		conv.pendingMessages(prompt),
+		bedrocktypes.Message{
+			Role: bedrocktypes.ConversationRoleAssistant,
+			Content: []bedrocktypes.ContentBlock{
+				&bedrocktypes.ContentBlockMemberText{Value: output},
+			},
+		},
+	)
 
-	conv.messages = append(conv.messages, outputMsg)
+	res.FullOutput = output
+	res.TokensUsed = tokensUsed
+	res.StopReason = string(stopReason)
 
+	var ok bool
 	if res.Code, ok = types.ExtractCode(res.FullOutput); !ok {
 		res.Code = res.FullOutput
 	}
 
-	return res, nil
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res
 }
 
 // Messages returns all the messages that have been exchanged between the user
-// and the assistant up to this point.
+// and the assistant up to this point. System prompts, if any, are returned
+// first, with the "system" role.
 func (conv *Conversation) Messages() []types.Message {
-	msgs := make([]types.Message, len(conv.messages))
-	for i, m := range conv.messages {
+	msgs := make([]types.Message, 0, len(conv.system)+len(conv.messages))
+	for _, s := range conv.system {
+		if content, ok := s.(*bedrocktypes.SystemContentBlockMemberText); ok {
+			msgs = append(msgs, types.Message{
+				Role:    "system",
+				Content: content.Value,
+			})
+		}
+	}
+	for _, m := range conv.messages {
 		content, _ := m.Content[0].(*bedrocktypes.ContentBlockMemberText)
-		msgs[i] = types.Message{
+		msgs = append(msgs, types.Message{
 			Role:    string(m.Role),
 			Content: content.Value,
-		}
+		})
 	}
 	return msgs
 }
 
 // AddHeader is a noop for the bedrock implementation
 func (conv *Conversation) AddHeader(_ string, _ string) {}
+
+// SetInferenceParams sets the parameters that control how the model
+// generates responses for all subsequent messages in this conversation.
+func (conv *Conversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = params
+}
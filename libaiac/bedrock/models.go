@@ -15,7 +15,7 @@ func (backend *Bedrock) ListModels(ctx context.Context) (models []string, err er
 		ByOutputModality: types.ModelModalityText,
 	})
 	if err != nil {
-		return models, fmt.Errorf("failed listing base models: %w", err)
+		return models, fmt.Errorf("failed listing base models: %w", wrapError(err))
 	}
 
 	models = make([]string, len(output.ModelSummaries))
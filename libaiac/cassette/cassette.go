@@ -0,0 +1,389 @@
+// Package cassette implements recording and replaying of HTTP exchanges with
+// LLM providers. In record mode, every request sent to a provider and its
+// response are written to a cassette file, with API keys and authorization
+// headers redacted. In replay mode, responses are served from a cassette file
+// without network access, which makes bug reports and regression tests
+// reproducible.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// Mode is a const type used for identifying the mode of a cassette.
+type Mode string
+
+const (
+	// ModeRecord sends requests to the provider, and records them and their
+	// responses in the cassette file, which is overwritten.
+	ModeRecord Mode = "record"
+
+	// ModeReplay serves responses from the cassette file, without network
+	// access.
+	ModeReplay Mode = "replay"
+)
+
+// Redacted is the value that replaces secrets in recorded exchanges.
+const Redacted = "REDACTED"
+
+// sensitiveHeaders are headers whose values are always redacted.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Api-Key",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// Cassette records or replays HTTP exchanges. It implements the
+// http.RoundTripper interface, and is safe for concurrent use by multiple
+// backends and conversations.
+type Cassette struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu           sync.Mutex
+	secrets      []string
+	interactions []Interaction
+	used         []bool
+}
+
+// Interaction is a single HTTP exchange, i.e. a request and its response.
+type Interaction struct {
+	// Request is the request sent to the provider.
+	Request Request `json:"request"`
+
+	// Response is the response received from the provider.
+	Response Response `json:"response"`
+
+	// RecordedAt is the time the exchange was recorded.
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Path is the path of the cassette file. Required.
+	Path string
+
+	// Mode is the mode of the cassette. Required.
+	Mode Mode
+
+	// Secrets are values (e.g. API keys) that are redacted wherever they
+	// appear in recorded exchanges, in addition to the values of
+	// authorization headers. More secrets can be added with AddSecret.
+	Secrets []string
+
+	// Transport is used to send requests in record mode. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// New creates a new instance of the Cassette struct, with the provided input
+// options. In record mode, the cassette file is created (or truncated)
+// immediately. In replay mode, it is loaded, and an error is returned if it
+// cannot be.
+func New(opts *Options) (*Cassette, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	c := &Cassette{
+		path:      opts.Path,
+		mode:      opts.Mode,
+		transport: opts.Transport,
+	}
+
+	if c.transport == nil {
+		c.transport = http.DefaultTransport
+	}
+
+	for _, secret := range opts.Secrets {
+		c.AddSecret(secret)
+	}
+
+	switch c.mode {
+	case ModeRecord:
+		if err := c.save(); err != nil {
+			return nil, err
+		}
+	case ModeReplay:
+		data, err := os.ReadFile(c.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading cassette: %w", err)
+		}
+
+		var file cassetteFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%w: %s", types.ErrInvalidCassette, err)
+		}
+
+		c.interactions = file.Interactions
+		c.used = make([]bool, len(c.interactions))
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", types.ErrInvalidCassette, c.mode)
+	}
+
+	return c, nil
+}
+
+// Mode returns the mode of the cassette.
+func (c *Cassette) Mode() Mode {
+	return c.mode
+}
+
+// AddSecret adds a value (e.g. an API key) that is redacted wherever it
+// appears in recorded exchanges. Backends add their API keys automatically.
+func (c *Cassette) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.secrets = append(c.secrets, secret)
+}
+
+// Client returns an HTTP client that sends requests through the cassette.
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+// RoundTrip sends a request through the cassette. In record mode, the request
+// is sent to the provider, and the exchange is recorded once the response
+// body has been read or closed (which allows streamed responses to be
+// consumed as they arrive). In replay mode, the first unused interaction with
+// the same method, URL and body is served; if there is none, an error
+// wrapping types.ErrNoInteraction is returned.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed reading request body: %w", err)
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	recorded := Request{
+		Method:  req.Method,
+		URL:     c.redact(req.URL.String()),
+		Headers: c.redactHeaders(req.Header),
+		Body:    c.redact(string(body)),
+	}
+
+	if c.mode == ModeReplay {
+		return c.replay(req, recorded)
+	}
+
+	res, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = &recordingBody{
+		ReadCloser: res.Body,
+		done: func(resBody []byte) {
+			c.record(Interaction{
+				Request: recorded,
+				Response: Response{
+					Status:  res.StatusCode,
+					Headers: c.redactHeaders(res.Header),
+					Body:    c.redact(string(resBody)),
+				},
+				RecordedAt: time.Now().UTC(),
+			})
+		},
+	}
+
+	return res, nil
+}
+
+func (c *Cassette) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, interaction := range c.interactions {
+		if c.used[i] ||
+			interaction.Request.Method != recorded.Method ||
+			interaction.Request.URL != recorded.URL ||
+			interaction.Request.Body != recorded.Body {
+			continue
+		}
+
+		c.used[i] = true
+
+		res := interaction.Response
+		header := res.Headers.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", res.Status, http.StatusText(res.Status)),
+			StatusCode:    res.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(res.Body)),
+			ContentLength: int64(len(res.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf(
+		"%w: %s %s",
+		types.ErrNoInteraction,
+		recorded.Method,
+		recorded.URL,
+	)
+}
+
+func (c *Cassette) record(interaction Interaction) {
+	c.mu.Lock()
+	c.interactions = append(c.interactions, interaction)
+	c.mu.Unlock()
+
+	// Errors cannot be returned from here, as the response has already been
+	// handed to the caller; they will resurface when the next interaction is
+	// saved, or were already reported when the cassette was created.
+	_ = c.save()
+}
+
+// save writes the cassette file. It is rewritten after every recorded
+// interaction, so that it is complete even if the program exits abruptly.
+func (c *Cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	file := cassetteFile{Interactions: c.interactions}
+	if file.Interactions == nil {
+		file.Interactions = []Interaction{}
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding cassette: %w", err)
+	}
+
+	err = os.WriteFile(c.path, append(data, '\n'), 0o600)
+	if err != nil {
+		return fmt.Errorf("failed writing cassette: %w", err)
+	}
+
+	return nil
+}
+
+// redact replaces all secrets in the provided string.
+func (c *Cassette) redact(s string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, secret := range c.secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+
+	return s
+}
+
+// redactHeaders returns a copy of the provided headers, with the values of
+// sensitive headers, and all secrets, redacted.
+func (c *Cassette) redactHeaders(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+
+	res := make(http.Header, len(header))
+	for key, values := range header {
+		redacted := make([]string, len(values))
+		for i, val := range values {
+			if isSensitiveHeader(key) {
+				redacted[i] = Redacted
+			} else {
+				redacted[i] = c.redact(val)
+			}
+		}
+
+		res[key] = redacted
+	}
+
+	return res
+}
+
+func isSensitiveHeader(key string) bool {
+	for _, header := range sensitiveHeaders {
+		if strings.EqualFold(header, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordingBody wraps a response body, keeping a copy of everything read from
+// it. Once the body is fully read or closed, the copy is passed to done.
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func([]byte)
+}
+
+func (body *recordingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.buf.Write(p[:n])
+
+	if err == io.EOF {
+		body.finish()
+	}
+
+	return n, err
+}
+
+func (body *recordingBody) Close() error {
+	body.finish()
+	return body.ReadCloser.Close()
+}
+
+func (body *recordingBody) finish() {
+	body.once.Do(func() {
+		body.done(body.buf.Bytes())
+	})
+}
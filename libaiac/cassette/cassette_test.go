@@ -0,0 +1,192 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/cassette"
+	"github.com/gofireflyio/aiac/v5/libaiac/openai"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+const apiKey = "sk-test-secret"
+
+// newServer starts a test server that behaves like the OpenAI API, and counts
+// the requests it receives.
+func newServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+
+	var count int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{"resource ", "{}"} {
+				fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}], \"usage\": {\"total_tokens\": 9}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		fmt.Fprintf(w, `{
+			"choices": [{"message": {"role": "assistant", "content": "echo: %s"}, "finish_reason": "stop"}],
+			"usage": {"total_tokens": 12}
+		}`, apiKey)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &count
+}
+
+// chat sends a regular and a streamed prompt through an OpenAI backend using
+// the provided cassette, and returns the responses.
+func chat(t *testing.T, url string, c *cassette.Cassette) (res, streamed types.Response) {
+	t.Helper()
+
+	backend, err := openai.New(&openai.Options{ApiKey: apiKey, URL: url, Cassette: c})
+	if err != nil {
+		t.Fatalf("failed creating backend: %s", err)
+	}
+
+	conv := backend.Chat("gpt-test")
+
+	res, err = conv.Send(context.Background(), "generate terraform")
+	if err != nil {
+		t.Fatalf("failed sending prompt: %s", err)
+	}
+
+	streamed, err = conv.SendStream(context.Background(), "and again", func(string) {})
+	if err != nil {
+		t.Fatalf("failed streaming prompt: %s", err)
+	}
+
+	return res, streamed
+}
+
+func TestRoundTrip(t *testing.T) {
+	srv, count := newServer(t)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := cassette.New(&cassette.Options{Path: path, Mode: cassette.ModeRecord})
+	if err != nil {
+		t.Fatalf("failed creating cassette: %s", err)
+	}
+
+	if recorder.Mode() != cassette.ModeRecord {
+		t.Errorf("expected record mode, got %s", recorder.Mode())
+	}
+
+	recordedRes, recordedStream := chat(t, srv.URL, recorder)
+
+	if *count != 2 {
+		t.Fatalf("expected 2 requests to be sent, got %d", *count)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed reading cassette: %s", err)
+	}
+
+	if strings.Contains(string(data), apiKey) || strings.Contains(string(data), "session=abc") {
+		t.Errorf("expected secrets to be redacted from cassette:\n%s", data)
+	}
+
+	if strings.Count(string(data), `"recorded_at"`) != 2 {
+		t.Errorf("expected 2 interactions in cassette:\n%s", data)
+	}
+
+	// replay without the server
+	srv.Close()
+
+	player, err := cassette.New(&cassette.Options{Path: path, Mode: cassette.ModeReplay})
+	if err != nil {
+		t.Fatalf("failed loading cassette: %s", err)
+	}
+
+	replayedRes, replayedStream := chat(t, srv.URL, player)
+
+	if *count != 2 {
+		t.Errorf("expected no requests during replay, got %d", *count-2)
+	}
+
+	// the API key is redacted in the recorded response
+	if want := "echo: " + cassette.Redacted; replayedRes.FullOutput != want {
+		t.Errorf("expected replayed output %q, got %q", want, replayedRes.FullOutput)
+	}
+
+	if replayedRes.TokensUsed != recordedRes.TokensUsed ||
+		replayedRes.StopReason != recordedRes.StopReason {
+		t.Errorf("expected replayed response %+v to match recorded %+v", replayedRes, recordedRes)
+	}
+
+	if replayedStream.FullOutput != recordedStream.FullOutput ||
+		replayedStream.FullOutput != "resource {}" ||
+		replayedStream.TokensUsed != 9 {
+		t.Errorf("expected replayed stream %+v to match recorded %+v", replayedStream, recordedStream)
+	}
+
+	// every interaction is served only once
+	backend, _ := openai.New(&openai.Options{ApiKey: apiKey, URL: srv.URL, Cassette: player})
+	_, err = backend.Chat("gpt-test").Send(context.Background(), "generate terraform")
+	if !errors.Is(err, types.ErrNoInteraction) {
+		t.Errorf("expected error %q, got %v", types.ErrNoInteraction, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    *cassette.Options
+		wantErr error
+	}{
+		{
+			name:    "unknown mode",
+			opts:    &cassette.Options{Path: filepath.Join(dir, "c.json"), Mode: "rewind"},
+			wantErr: types.ErrInvalidCassette,
+		},
+		{
+			name:    "invalid cassette",
+			opts:    &cassette.Options{Path: invalid, Mode: cassette.ModeReplay},
+			wantErr: types.ErrInvalidCassette,
+		},
+		{
+			name:    "missing cassette",
+			opts:    &cassette.Options{Path: filepath.Join(dir, "missing.json"), Mode: cassette.ModeReplay},
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name: "record",
+			opts: &cassette.Options{Path: filepath.Join(dir, "new.json"), Mode: cassette.ModeRecord},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cassette.New(tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
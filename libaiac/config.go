@@ -6,6 +6,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/adrg/xdg"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
 )
 
 // BackendType is a const type used for identifying backends, a.k.a LLM providers.
@@ -20,6 +21,16 @@ const (
 
 	// BackendOllama represents the Ollama LLM provider.
 	BackendOllama BackendType = "ollama"
+
+	// BackendAnthropic represents the Anthropic LLM provider.
+	BackendAnthropic BackendType = "anthropic"
+
+	// BackendGemini represents the Google Gemini LLM provider.
+	BackendGemini BackendType = "gemini"
+
+	// BackendMock represents a mock backend that replays scripted responses
+	// from a fixtures file, useful for testing (see the mock package).
+	BackendMock BackendType = "mock"
 )
 
 // Config holds the configuration for aiac.
@@ -31,6 +42,29 @@ type Config struct {
 	// DefaultBackend is the name of the default backend to use when one is
 	// not specifically selected.
 	DefaultBackend string `toml:"default_backend"`
+
+	// Fallback is an ordered list of backends to fall back to when a backend
+	// fails with an error not caused by the user (e.g. the provider is down).
+	// Entries are backend names, optionally followed by a colon and a model
+	// name (e.g. "local-ollama:llama3"); if a model is not provided, the
+	// backend's default model is used. The chain starts with the default
+	// backend (if it isn't already listed), and is only used when a backend is
+	// not explicitly selected.
+	Fallback []string `toml:"fallback"`
+
+	// MaxContextSize is the maximum total size, in bytes, of the contents of
+	// the files included as context in messages (see Aiac.ContextMessage).
+	// Defaults to DefaultMaxContextSize.
+	MaxContextSize int `toml:"max_context_size"`
+
+	// TemplatesDir is the directory in which prompt template files are
+	// stored. Defaults to "aiac/templates" under the XDG configuration
+	// directory (see templates.Options).
+	TemplatesDir string `toml:"templates_dir"`
+
+	// Templates is a map of prompt template names to template texts, which
+	// take precedence over template files of the same name.
+	Templates map[string]string `toml:"templates"`
 }
 
 // BackendConfig holds backend-specific configuration.
@@ -47,24 +81,43 @@ type BackendConfig struct {
 	AWSRegion string `toml:"aws_region"`
 
 	// APIKey is an API key used for authentication. It is used by backends such
-	// as OpenAI.
+	// as OpenAI, Anthropic and Gemini.
 	APIKey string `toml:"api_key"`
 
 	// APIVersion allows setting a specific API version to use. It is accepted
-	// by the OpenAI backend.
+	// by the OpenAI, Anthropic and Gemini backends.
 	APIVersion string `toml:"api_version"`
 
 	// URL allows setting a custom URL for a backend's API. It is accepted by
-	// backends such as OpenAI and Ollama.
+	// backends such as OpenAI, Anthropic, Gemini and Ollama.
 	URL string `toml:"url"`
 
 	// DefaultModel is the name of the model to use by default when a specific
 	// one is not selected.
 	DefaultModel string `toml:"default_model"`
 
+	// SystemPrompt is a system prompt sent to the model at the beginning of
+	// every conversation, allowing to enforce conventions on all generated
+	// code. It can be overridden when starting a conversation.
+	SystemPrompt string `toml:"system_prompt"`
+
+	// Inference holds parameters that control how models of this backend
+	// generate responses, such as temperature and maximum tokens. They can be
+	// overridden when starting a conversation.
+	Inference types.InferenceParams `toml:"inference"`
+
+	// Retry controls how requests that fail due to temporary errors (such as
+	// rate limiting) are retried. Unset values are taken from
+	// DefaultRetryPolicy.
+	Retry RetryPolicy `toml:"retry"`
+
 	// ExtraHeaders allows setting extra HTTP headers whenever aiac sends
 	// requests to the backend. Bedrock backends do not support this setting.
 	ExtraHeaders map[string]string `toml:"extra_headers"`
+
+	// Fixtures is used by the mock backend. It is the path of the fixtures
+	// file containing the scripted responses to replay.
+	Fixtures string `toml:"fixtures"`
 }
 
 // LoadConfig loads an aiac configuration file from the provided path, which
@@ -118,6 +171,10 @@ func replaceEnvVars(conf Config) Config {
 			backendConfig.APIVersion = replaceEnvVar(backendConfig.APIVersion)
 		}
 
+		if backendConfig.Fixtures != "" {
+			backendConfig.Fixtures = replaceEnvVar(backendConfig.Fixtures)
+		}
+
 		conf.Backends[backendName] = backendConfig
 	}
 
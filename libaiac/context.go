@@ -0,0 +1,353 @@
+package libaiac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// DefaultMaxContextSize is the default maximum total size, in bytes, of the
+// contents of files included as context in a message. Only file contents are
+// counted, not the delimiters around them or the prompt, so the message is
+// somewhat larger. For typical code, this amounts to about 25,000 tokens.
+const DefaultMaxContextSize = 100 * 1024
+
+// sniffSize is the number of bytes read from the beginning of a file to
+// determine whether it is a binary file.
+const sniffSize = 8000
+
+// skippedDirs are directories that are never included when a directory is
+// provided as context, as they contain version control data, dependencies
+// or generated files rather than code the user works on.
+var skippedDirs = map[string]bool{
+	".git":              true,
+	".terraform":        true,
+	".terragrunt-cache": true,
+	"node_modules":      true,
+	"vendor":            true,
+}
+
+// sensitiveFiles are patterns of files that commonly contain secrets, such as
+// Terraform state and variable files, and are skipped unless
+// ContextOptions.IncludeSensitive is true.
+var sensitiveFiles = []string{
+	"*.tfstate",
+	"*.tfstate.backup",
+	"*.tfvars",
+	"*.tfvars.json",
+	".env",
+	".env.*",
+}
+
+// ContextOptions contains the parameters accepted by Aiac.ContextMessage.
+type ContextOptions struct {
+	// Files are the files to include as context. Each item may be the path
+	// of a file, a glob pattern (e.g. "modules/*/main.tf"), or the path of a
+	// directory, in which case all text files in the directory and its
+	// subdirectories are included.
+	Files []string
+
+	// MaxSize is the maximum total size, in bytes, of the files' contents.
+	// The delimiters around them and the prompt are not counted. Defaults to
+	// the MaxContextSize configuration option, or DefaultMaxContextSize if
+	// not configured.
+	MaxSize int
+
+	// Truncate controls what happens when the files exceed MaxSize. By
+	// default, an error wrapping types.ErrContextTooLarge is returned. If
+	// Truncate is true, the file that crosses the limit is truncated, and
+	// any following files are omitted.
+	Truncate bool
+
+	// IncludeSensitive includes files that commonly contain secrets (e.g.
+	// terraform.tfstate, *.tfvars and .env files), which are skipped by
+	// default.
+	IncludeSensitive bool
+}
+
+// ContextFile describes a file included as context in a message.
+type ContextFile struct {
+	// Path is the path of the file, as matched.
+	Path string
+
+	// Size is the size of the file, in bytes.
+	Size int
+
+	// Included is the number of bytes of the file that were included in the
+	// message. This is smaller than Size if the file was truncated, and zero
+	// if it was omitted.
+	Included int
+
+	// Skipped is true if the file was not included because it may contain
+	// secrets (see ContextOptions.IncludeSensitive). Sensitive files are only
+	// returned if they were named explicitly, rather than matched by a glob
+	// pattern or found in a directory, so that callers can warn about them.
+	Skipped bool
+}
+
+// ContextMessage builds a message that includes the contents of local files
+// as context for the provided prompt, e.g. for requests to modify existing
+// code. The contents of every file are delimited by lines containing its
+// path, and followed by the prompt. Binary files, and files that may contain
+// secrets, are skipped. File sizes are checked before any file is read, so
+// that selecting too many files fails quickly. Returns the message, and the
+// files that were found.
+func (aiac *Aiac) ContextMessage(prompt string, opts ContextOptions) (
+	msg string,
+	files []ContextFile,
+	err error,
+) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = aiac.Conf.MaxContextSize
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxContextSize
+	}
+
+	paths, explicit, err := expandContextFiles(opts.Files)
+	if err != nil {
+		return msg, files, err
+	}
+
+	var total int
+
+	for _, path := range paths {
+		if !opts.IncludeSensitive && isSensitive(path) {
+			if explicit[path] {
+				files = append(files, ContextFile{Path: path, Skipped: true})
+			}
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return msg, files, fmt.Errorf("failed reading %s: %w", path, err)
+		}
+
+		binary, err := isBinaryFile(path)
+		if err != nil {
+			return msg, files, fmt.Errorf("failed reading %s: %w", path, err)
+		}
+
+		if binary {
+			continue
+		}
+
+		files = append(files, ContextFile{Path: path, Size: int(info.Size())})
+		total += int(info.Size())
+	}
+
+	if total > maxSize && !opts.Truncate {
+		return msg, files, fmt.Errorf(
+			"%w: %d bytes in %d files, the maximum is %d bytes",
+			types.ErrContextTooLarge, total, len(files)-countSkipped(files), maxSize,
+		)
+	}
+
+	var b strings.Builder
+	b.WriteString("The following existing files are provided as context:\n\n")
+
+	remaining := maxSize
+	for i := range files {
+		if files[i].Skipped {
+			continue
+		}
+
+		// read one more byte than remaining to find out if the file fits
+		data, err := readFileUpTo(files[i].Path, remaining+1)
+		if err != nil {
+			return msg, files, fmt.Errorf("failed reading %s: %w", files[i].Path, err)
+		}
+
+		if len(data) > remaining {
+			data = truncateText(data, remaining)
+		}
+		remaining -= len(data)
+
+		files[i].Included = len(data)
+		if files[i].Included == 0 && files[i].Size > 0 {
+			// omitted, listed below
+			continue
+		}
+
+		fmt.Fprintf(&b, "--- BEGIN FILE: %s ---\n", filepath.ToSlash(files[i].Path))
+		b.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+		if files[i].Included < files[i].Size {
+			b.WriteString("[... truncated ...]\n")
+		}
+		fmt.Fprintf(&b, "--- END FILE: %s ---\n\n", filepath.ToSlash(files[i].Path))
+	}
+
+	var omitted []string
+	for _, file := range files {
+		if file.Included == 0 && file.Size > 0 {
+			omitted = append(omitted, filepath.ToSlash(file.Path))
+		}
+	}
+
+	if len(omitted) > 0 {
+		fmt.Fprintf(
+			&b,
+			"The following files were omitted due to their size: %s\n\n",
+			strings.Join(omitted, ", "),
+		)
+	}
+
+	b.WriteString(prompt)
+
+	return b.String(), files, nil
+}
+
+// expandContextFiles expands the provided paths, glob patterns and
+// directories into a list of file paths. Files matched by more than one item
+// are only returned once. Also returns the set of files that were named
+// explicitly, i.e. by a path that is not a glob pattern or directory.
+func expandContextFiles(patterns []string) (
+	paths []string,
+	explicit map[string]bool,
+	err error,
+) {
+	seen := make(map[string]bool)
+	explicit = make(map[string]bool)
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, nil, fmt.Errorf("%w: %s", types.ErrNoContextFiles, pattern)
+		}
+
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed reading %s: %w", match, err)
+			}
+
+			if !info.IsDir() {
+				add(match)
+				if match == pattern {
+					explicit[filepath.Clean(match)] = true
+				}
+				continue
+			}
+
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				switch {
+				case err != nil:
+					return err
+				case entry.IsDir() && path != match && skippedDirs[entry.Name()]:
+					return filepath.SkipDir
+				case entry.Type().IsRegular():
+					add(path)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed reading %s: %w", match, err)
+			}
+		}
+	}
+
+	return paths, explicit, nil
+}
+
+// isSensitive returns true if the file at the provided path commonly contains
+// secrets (see sensitiveFiles).
+func isSensitive(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range sensitiveFiles {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countSkipped returns the number of skipped files in the provided list.
+func countSkipped(files []ContextFile) (count int) {
+	for _, file := range files {
+		if file.Skipped {
+			count++
+		}
+	}
+
+	return count
+}
+
+// isBinaryFile returns true if the beginning of the file at the provided path
+// does not look like text (see isBinary).
+func isBinaryFile(path string) (bool, error) {
+	data, err := readFileUpTo(path, sniffSize)
+	if err != nil {
+		return false, err
+	}
+
+	if len(data) == sniffSize {
+		// don't mistake a UTF-8 sequence cut at the end for invalid text
+		for i := 1; i < utf8.UTFMax && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+
+	return isBinary(data), nil
+}
+
+// readFileUpTo reads at most maxSize bytes from the beginning of the file at
+// the provided path.
+func readFileUpTo(path string, maxSize int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, int64(maxSize)))
+}
+
+// isBinary returns true if the provided data does not look like text, i.e. it
+// contains NUL bytes or is not valid UTF-8.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+// truncateText truncates text to at most maxSize bytes, at the end of the last
+// complete line if possible.
+func truncateText(data []byte, maxSize int) []byte {
+	data = data[:maxSize]
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		return data[:i+1]
+	}
+
+	// no complete line fits, make sure not to cut a UTF-8 sequence
+	for len(data) > 0 && !utf8.Valid(data) {
+		data = data[:len(data)-1]
+	}
+
+	return data
+}
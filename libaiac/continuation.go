@@ -0,0 +1,109 @@
+package libaiac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// ContinuationPrompt is the message sent to a model when asking it to
+// continue a response that was truncated due to the token limit.
+var ContinuationPrompt = "Your previous response was cut off. Continue " +
+	"exactly where you left off. Do not repeat any previous output, and do " +
+	"not add any introduction or explanation."
+
+// continuingConversation wraps a Conversation, automatically asking the model
+// to continue whenever a response is truncated due to the token limit, up to
+// a maximum number of rounds. The fragments are stitched together into a
+// single response.
+type continuingConversation struct {
+	types.Conversation
+	maxRounds int
+}
+
+// Send sends the provided message to the model, continuing truncated
+// responses as necessary.
+func (conv *continuingConversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	return conv.send(ctx, prompt, conv.Conversation.Send)
+}
+
+// SendStream is the same as Send, but streams the response. Chunks from
+// continuation rounds are streamed as well, so the provided function receives
+// the complete, stitched output.
+func (conv *continuingConversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	return conv.send(ctx, prompt, func(ctx context.Context, prompt string) (
+		types.Response,
+		error,
+	) {
+		return conv.Conversation.SendStream(ctx, prompt, fn)
+	})
+}
+
+func (conv *continuingConversation) send(
+	ctx context.Context,
+	prompt string,
+	send func(context.Context, string) (types.Response, error),
+) (res types.Response, err error) {
+	res, err = send(ctx, prompt)
+	if err != nil {
+		return res, err
+	}
+
+	if !types.IsTruncated(res.StopReason) {
+		return res, nil
+	}
+
+	// Backends trim the output returned in the response, so we use the
+	// messages recorded in the conversation to stitch fragments together,
+	// otherwise whitespace at the boundaries would be lost.
+	var output strings.Builder
+	output.WriteString(conv.lastOutput())
+
+	tokensUsed := res.TokensUsed
+
+	for round := 1; round <= conv.maxRounds && types.IsTruncated(res.StopReason); round++ {
+		res, err = send(ctx, ContinuationPrompt)
+		if err != nil {
+			return res, fmt.Errorf(
+				"failed continuing truncated response (round %d): %w",
+				round, err,
+			)
+		}
+
+		output.WriteString(conv.lastOutput())
+		tokensUsed += res.TokensUsed
+		res.Continuations = round
+	}
+
+	res.FullOutput = strings.TrimSpace(output.String())
+	res.TokensUsed = tokensUsed
+
+	var ok bool
+	if res.Code, ok = types.ExtractCode(res.FullOutput); !ok {
+		res.Code = res.FullOutput
+	}
+
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res, nil
+}
+
+// lastOutput returns the content of the last message in the conversation,
+// which is expected to be the assistant's latest response.
+func (conv *continuingConversation) lastOutput() string {
+	msgs := conv.Messages()
+	if len(msgs) == 0 {
+		return ""
+	}
+
+	return msgs[len(msgs)-1].Content
+}
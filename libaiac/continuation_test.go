@@ -0,0 +1,192 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// truncated is a fixture for a response truncated due to the token limit.
+var truncated = mock.Fixture{
+	Prompt:     "prompt",
+	Response:   "```hcl\nresource \"aws_s3_bucket\" \"b\" {\n",
+	StopReason: "length",
+	TokensUsed: 10,
+}
+
+const (
+	continuedOutput = "```hcl\nresource \"aws_s3_bucket\" \"b\" {\n  bucket = \"b\"\n}\n```"
+	continuedCode   = "resource \"aws_s3_bucket\" \"b\" {\n  bucket = \"b\"\n}"
+)
+
+func TestContinuation(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			truncated,
+			{Prompt: ContinuationPrompt, Response: "  bucket = ", StopReason: "length", TokensUsed: 3, Times: 1},
+			{Prompt: ContinuationPrompt, Response: "\"b\"\n}\n```", TokensUsed: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxContinuations: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != continuedOutput || res.Code != continuedCode {
+		t.Errorf("unexpected output %q and code %q", res.FullOutput, res.Code)
+	}
+
+	if res.Continuations != 2 || res.TokensUsed != 17 {
+		t.Errorf(
+			"expected 2 continuations and 17 tokens, got %d and %d",
+			res.Continuations, res.TokensUsed,
+		)
+	}
+
+	if types.IsTruncated(res.StopReason) {
+		t.Errorf("expected response not to be truncated, got stop reason %q", res.StopReason)
+	}
+
+	if got := len(backend.Requests()); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestContinuationStream(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			truncated,
+			{Prompt: ContinuationPrompt, Response: "  bucket = \"b\"\n}\n```", TokensUsed: 7},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxContinuations: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var streamed strings.Builder
+	res, err := chat.SendStream(context.Background(), "prompt", func(chunk string) {
+		streamed.WriteString(chunk)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != continuedOutput || res.Continuations != 1 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if got := strings.TrimSpace(streamed.String()); got != continuedOutput {
+		t.Errorf("expected streamed output %q, got %q", continuedOutput, got)
+	}
+}
+
+func TestContinuationNotNeeded(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Response: "```hcl\nlocals {}\n```"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxContinuations: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Code != "locals {}" || res.Continuations != 0 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if got := len(backend.Requests()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
+
+func TestContinuationRoundsExhausted(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			truncated,
+			{Prompt: ContinuationPrompt, Response: "  bucket = ", StopReason: "length", TokensUsed: 3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxContinuations: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := "```hcl\nresource \"aws_s3_bucket\" \"b\" {\n  bucket ="
+	if res.FullOutput != want {
+		t.Errorf("expected output %q, got %q", want, res.FullOutput)
+	}
+
+	if !types.IsTruncated(res.StopReason) {
+		t.Errorf("expected response to be truncated, got stop reason %q", res.StopReason)
+	}
+
+	if res.Continuations != 1 || res.TokensUsed != 13 {
+		t.Errorf(
+			"expected 1 continuation and 13 tokens, got %d and %d",
+			res.Continuations, res.TokensUsed,
+		)
+	}
+}
+
+func TestContinuationFails(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			truncated,
+			{Prompt: ContinuationPrompt, Status: http.StatusBadRequest},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxContinuations: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = chat.Send(context.Background(), "prompt")
+	if !errors.Is(err, types.ErrUnexpectedStatus) {
+		t.Fatalf("expected error %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+}
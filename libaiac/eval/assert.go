@@ -0,0 +1,268 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/security"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported assertion types.
+const (
+	// AssertCode checks that at least one code block was extracted from the
+	// response.
+	AssertCode = "code"
+
+	// AssertContains checks that the code matches a regular expression.
+	AssertContains = "contains"
+
+	// AssertNotContains checks that the code does not match a regular
+	// expression.
+	AssertNotContains = "not_contains"
+
+	// AssertParses checks that the code blocks in a format ("hcl", "yaml" or
+	// "json") parse successfully. Blocks in other languages are ignored, but
+	// at least one block must be in the format.
+	AssertParses = "parses"
+
+	// AssertValid checks that the code passes validation without errors
+	// (see validation.Validate).
+	AssertValid = "valid"
+
+	// AssertNoFindings checks that security checks find no problems of the
+	// provided severity or higher (defaults to "low", i.e. no problems at
+	// all).
+	AssertNoFindings = "no_findings"
+
+	// AssertComplete checks that the response was not truncated.
+	AssertComplete = "complete"
+)
+
+// languageAliases maps the formats supported by AssertParses to the code
+// block languages that are considered to be in that format.
+var languageAliases = map[string][]string{
+	"hcl":  {"hcl", "terraform", "tf"},
+	"yaml": {"yaml", "yml"},
+	"json": {"json"},
+}
+
+// Assertion is a check applied to a response. In suite files, assertions are
+// written as a type and value (e.g. {type: contains, value: aws_s3_bucket}),
+// or in short form, as a map from the type to the value (e.g. "contains:
+// aws_s3_bucket"), or just the type for assertions without a value (e.g.
+// "code").
+type Assertion struct {
+	// Type is the type of the assertion, e.g. AssertContains.
+	Type string `yaml:"type" json:"type"`
+
+	// Value is the parameter of the assertion, e.g. the regular expression
+	// for AssertContains.
+	Value string `yaml:"value" json:"value,omitempty"`
+}
+
+// UnmarshalYAML decodes an assertion from YAML, supporting the short forms.
+func (assertion *Assertion) UnmarshalYAML(node *yaml.Node) error {
+	switch {
+	case node.Kind == yaml.ScalarNode:
+		assertion.Type = node.Value
+		return nil
+	case node.Kind == yaml.MappingNode && len(node.Content) == 2 && node.Content[0].Value != "type":
+		assertion.Type = node.Content[0].Value
+		return node.Content[1].Decode(&assertion.Value)
+	}
+
+	type plain Assertion
+	return node.Decode((*plain)(assertion))
+}
+
+// String returns a textual representation of the assertion.
+func (assertion Assertion) String() string {
+	if assertion.Value == "" {
+		return assertion.Type
+	}
+
+	return fmt.Sprintf("%s %q", assertion.Type, assertion.Value)
+}
+
+var errUnknownAssertion = errors.New("unknown assertion type")
+
+func (assertion Assertion) validate() error {
+	switch assertion.Type {
+	case AssertCode, AssertValid, AssertComplete:
+		return nil
+	case AssertContains, AssertNotContains:
+		if _, err := regexp.Compile(assertion.Value); err != nil {
+			return fmt.Errorf("invalid regular expression in %s: %w", assertion, err)
+		}
+		return nil
+	case AssertParses:
+		if _, ok := languageAliases[strings.ToLower(assertion.Value)]; !ok {
+			return fmt.Errorf("unsupported format in %s, use hcl, yaml or json", assertion)
+		}
+		return nil
+	case AssertNoFindings:
+		if assertion.Value == "" {
+			return nil
+		}
+		_, err := security.ParseSeverity(assertion.Value)
+		return err
+	default:
+		return fmt.Errorf("%w %q", errUnknownAssertion, assertion.Type)
+	}
+}
+
+// AssertionResult is the result of applying an assertion to a response.
+type AssertionResult struct {
+	Assertion
+
+	// Passed is true if the response satisfied the assertion.
+	Passed bool `json:"passed"`
+
+	// Message explains why the assertion failed. Empty if it passed.
+	Message string `json:"message,omitempty"`
+}
+
+// Check applies the assertion to a response.
+func (assertion Assertion) Check(res types.Response) AssertionResult {
+	msg := assertion.check(res)
+	return AssertionResult{
+		Assertion: assertion,
+		Passed:    msg == "",
+		Message:   msg,
+	}
+}
+
+// check applies the assertion to a response, returning a message explaining
+// why it failed, or an empty string if it passed.
+func (assertion Assertion) check(res types.Response) string {
+	switch assertion.Type {
+	case AssertCode:
+		if len(res.Files) == 0 {
+			return "no code block found in the response"
+		}
+	case AssertContains, AssertNotContains:
+		re, err := regexp.Compile(assertion.Value)
+		if err != nil {
+			return err.Error()
+		}
+
+		found := re.MatchString(code(res))
+		if assertion.Type == AssertContains && !found {
+			return fmt.Sprintf("code does not match %q", assertion.Value)
+		} else if assertion.Type == AssertNotContains && found {
+			return fmt.Sprintf("code matches %q", assertion.Value)
+		}
+	case AssertParses:
+		return checkParses(res, strings.ToLower(assertion.Value))
+	case AssertValid:
+		for _, diag := range validation.Validate(res) {
+			if diag.Severity == validation.SeverityError {
+				return diag.String()
+			}
+		}
+	case AssertNoFindings:
+		sev := security.SeverityLow
+		if assertion.Value != "" {
+			parsed, err := security.ParseSeverity(assertion.Value)
+			if err != nil {
+				return err.Error()
+			}
+			sev = parsed
+		}
+
+		if findings := security.AtLeast(security.Scan(res), sev); len(findings) > 0 {
+			return fmt.Sprintf("%d security finding(s), first: %s", len(findings), findings[0])
+		}
+	case AssertComplete:
+		if types.IsTruncated(res.StopReason) {
+			return fmt.Sprintf("the response was truncated (%s)", res.StopReason)
+		}
+	default:
+		return fmt.Sprintf("%s %q", errUnknownAssertion, assertion.Type)
+	}
+
+	return ""
+}
+
+// code returns all the code extracted from a response, or the full output if
+// no code blocks were found.
+func code(res types.Response) string {
+	if len(res.Files) == 0 {
+		return res.Code
+	}
+
+	blocks := make([]string, 0, len(res.Files))
+	for _, block := range res.Files {
+		blocks = append(blocks, block.Code)
+	}
+
+	return strings.Join(blocks, "\n")
+}
+
+// checkParses checks that all code blocks in the provided format parse
+// successfully. Blocks without a language are assumed to be in the format.
+func checkParses(res types.Response, format string) string {
+	checked := 0
+	for i, block := range res.Files {
+		lang := strings.ToLower(block.Language)
+		if lang != "" && !inList(languageAliases[format], lang) {
+			continue
+		}
+
+		checked++
+		if err := parse(format, block.Code); err != nil {
+			return fmt.Sprintf("code block %d is not valid %s: %s", i+1, strings.ToUpper(format), err)
+		}
+	}
+
+	if checked == 0 {
+		return fmt.Sprintf("no %s code block found in the response", strings.ToUpper(format))
+	}
+
+	return ""
+}
+
+func parse(format, code string) error {
+	switch format {
+	case "hcl":
+		_, diags := hclsyntax.ParseConfig([]byte(code), "main.tf", hcl.InitialPos)
+		if diags.HasErrors() {
+			return diags
+		}
+	case "yaml":
+		decoder := yaml.NewDecoder(strings.NewReader(code))
+		for {
+			var doc interface{}
+			err := decoder.Decode(&doc)
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+	case "json":
+		var doc interface{}
+		return json.Unmarshal([]byte(code), &doc)
+	}
+
+	return nil
+}
+
+func inList(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,136 @@
+package eval_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/eval"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAssertionUnmarshalYAML(t *testing.T) {
+	var assertions []eval.Assertion
+
+	err := yaml.Unmarshal([]byte(`
+- code
+- contains: aws_s3_bucket
+- {type: not_contains, value: "0\\.0\\.0\\.0/0"}
+- no_findings: high
+`), &assertions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []eval.Assertion{
+		{Type: eval.AssertCode},
+		{Type: eval.AssertContains, Value: "aws_s3_bucket"},
+		{Type: eval.AssertNotContains, Value: `0\.0\.0\.0/0`},
+		{Type: eval.AssertNoFindings, Value: "high"},
+	}
+
+	if len(assertions) != len(want) {
+		t.Fatalf("expected %d assertions, got %v", len(want), assertions)
+	}
+
+	for i := range want {
+		if assertions[i] != want[i] {
+			t.Errorf("expected assertion %d to be %+v, got %+v", i+1, want[i], assertions[i])
+		}
+	}
+}
+
+func TestAssertionCheck(t *testing.T) {
+	response := func(output, stopReason string) types.Response {
+		res := types.Response{FullOutput: output, StopReason: stopReason, Code: output}
+		res.Files = types.ExtractFiles(output)
+		if code, ok := types.ExtractCode(output); ok {
+			res.Code = code
+		}
+		return res
+	}
+
+	bucket := response("```hcl\nresource \"aws_s3_bucket\" \"b\" {\n  acl = \"public-read\"\n}\n```", "stop")
+	broken := response("```hcl\nresource \"aws_s3_bucket\" {\n```", "length")
+	manifest := response("```yaml\nkey: [1, 2]\n```\n```json\n{\"key\": 1}\n```", "stop")
+	prose := response("I cannot do that.", "stop")
+
+	tests := []struct {
+		name        string
+		assertion   eval.Assertion
+		res         types.Response
+		wantMessage string
+	}{
+		{name: "code", assertion: eval.Assertion{Type: eval.AssertCode}, res: bucket},
+		{
+			name:        "code missing",
+			assertion:   eval.Assertion{Type: eval.AssertCode},
+			res:         prose,
+			wantMessage: "no code block found in the response",
+		},
+		{name: "contains", assertion: eval.Assertion{Type: eval.AssertContains, Value: `aws_s3_\w+`}, res: bucket},
+		{
+			name:        "does not contain",
+			assertion:   eval.Assertion{Type: eval.AssertContains, Value: "google_"},
+			res:         bucket,
+			wantMessage: `code does not match "google_"`,
+		},
+		{name: "not contains", assertion: eval.Assertion{Type: eval.AssertNotContains, Value: "google_"}, res: bucket},
+		{
+			name:        "contains unwanted",
+			assertion:   eval.Assertion{Type: eval.AssertNotContains, Value: "public-read"},
+			res:         bucket,
+			wantMessage: `code matches "public-read"`,
+		},
+		{name: "parses hcl", assertion: eval.Assertion{Type: eval.AssertParses, Value: "hcl"}, res: bucket},
+		{
+			name:        "does not parse hcl",
+			assertion:   eval.Assertion{Type: eval.AssertParses, Value: "HCL"},
+			res:         broken,
+			wantMessage: "code block 1 is not valid HCL",
+		},
+		{name: "parses yaml", assertion: eval.Assertion{Type: eval.AssertParses, Value: "yaml"}, res: manifest},
+		{name: "parses json", assertion: eval.Assertion{Type: eval.AssertParses, Value: "json"}, res: manifest},
+		{
+			name:        "no block in format",
+			assertion:   eval.Assertion{Type: eval.AssertParses, Value: "json"},
+			res:         bucket,
+			wantMessage: "no JSON code block found in the response",
+		},
+		{name: "valid", assertion: eval.Assertion{Type: eval.AssertValid}, res: bucket},
+		{
+			name:        "invalid",
+			assertion:   eval.Assertion{Type: eval.AssertValid},
+			res:         broken,
+			wantMessage: "code block 1:1:26: error: Unclosed configuration block",
+		},
+		{name: "no critical findings", assertion: eval.Assertion{Type: eval.AssertNoFindings, Value: "critical"}, res: bucket},
+		{
+			name:        "findings",
+			assertion:   eval.Assertion{Type: eval.AssertNoFindings},
+			res:         bucket,
+			wantMessage: "1 security finding(s), first: code block 1:2: high",
+		},
+		{name: "complete", assertion: eval.Assertion{Type: eval.AssertComplete}, res: bucket},
+		{
+			name:        "truncated",
+			assertion:   eval.Assertion{Type: eval.AssertComplete},
+			res:         broken,
+			wantMessage: "the response was truncated (length)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.assertion.Check(tt.res)
+
+			if res.Passed != (tt.wantMessage == "") {
+				t.Fatalf("expected passed to be %t, got %t (%s)", tt.wantMessage == "", res.Passed, res.Message)
+			}
+
+			if !strings.HasPrefix(res.Message, tt.wantMessage) {
+				t.Errorf("expected message to start with %q, got %q", tt.wantMessage, res.Message)
+			}
+		})
+	}
+}
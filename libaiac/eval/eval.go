@@ -0,0 +1,269 @@
+// Package eval implements an evaluation harness for prompt suites: a set of
+// prompts is sent to one or more backend and model pairs, assertions are
+// applied to every response, and the results are summarized in a scorecard
+// with the pass rate of every pair. Suites can run against local stand-ins
+// (e.g. Ollama, or the mock backend) without network access.
+package eval
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConcurrency is the default number of cases evaluated concurrently.
+const DefaultConcurrency = 4
+
+// DefaultTimeout is the default maximum duration of a single case.
+const DefaultTimeout = 2 * time.Minute
+
+// Suite is a set of test cases evaluated against one or more targets.
+type Suite struct {
+	// Name is the name of the suite.
+	Name string `yaml:"name"`
+
+	// Targets are the backends and models to evaluate, in the format
+	// "backend" or "backend:model".
+	Targets []string `yaml:"targets"`
+
+	// SystemPrompt is a system prompt sent with every case, overriding the
+	// system prompt of the backend configuration. Optional.
+	SystemPrompt string `yaml:"system_prompt"`
+
+	// Cases are the test cases of the suite.
+	Cases []Case `yaml:"cases"`
+}
+
+// Case is a prompt, and the assertions its responses must satisfy.
+type Case struct {
+	// Name is the name of the case.
+	Name string `yaml:"name"`
+
+	// Prompt is the prompt sent to the model, as-is.
+	Prompt string `yaml:"prompt"`
+
+	// Assertions are the assertions applied to the response.
+	Assertions []Assertion `yaml:"assert"`
+}
+
+// LoadSuite loads a suite from a YAML file, and checks it is valid.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading suite: %w", err)
+	}
+
+	suite := &Suite{}
+	err = yaml.Unmarshal(data, suite)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding suite: %w", err)
+	}
+
+	if err := suite.Validate(); err != nil {
+		return nil, err
+	}
+
+	return suite, nil
+}
+
+// Validate checks that the suite is valid, returning an error wrapping
+// types.ErrInvalidSuite if it isn't. Unnamed cases are named after their
+// position.
+func (suite *Suite) Validate() error {
+	if len(suite.Cases) == 0 {
+		return fmt.Errorf("%w: no cases defined", types.ErrInvalidSuite)
+	}
+
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+
+		if c.Prompt == "" {
+			return fmt.Errorf("%w: %s has no prompt", types.ErrInvalidSuite, c.Name)
+		}
+
+		for _, assertion := range c.Assertions {
+			if err := assertion.validate(); err != nil {
+				return fmt.Errorf("%w: %s: %s", types.ErrInvalidSuite, c.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Runner evaluates suites.
+type Runner struct {
+	aiac *libaiac.Aiac
+	opts Options
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Targets override the targets of suites, if provided.
+	Targets []string
+
+	// Concurrency is the maximum number of cases evaluated concurrently.
+	// Defaults to DefaultConcurrency.
+	Concurrency int
+
+	// Timeout is the maximum duration of a single case. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// OnResult, if provided, is called whenever a case is evaluated against
+	// a target. It may be called concurrently from multiple goroutines.
+	OnResult func(CaseResult)
+}
+
+// New creates a new instance of the Runner struct, evaluating suites with the
+// provided Aiac instance. opts may be nil.
+func New(aiac *libaiac.Aiac, opts *Options) *Runner {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	runner := &Runner{aiac: aiac, opts: *opts}
+
+	if runner.opts.Concurrency <= 0 {
+		runner.opts.Concurrency = DefaultConcurrency
+	}
+
+	if runner.opts.Timeout <= 0 {
+		runner.opts.Timeout = DefaultTimeout
+	}
+
+	return runner
+}
+
+// Run evaluates every case of the suite against every target, and returns
+// a scorecard of the results. If neither the suite nor the runner's options
+// define targets, the default backend is evaluated.
+func (runner *Runner) Run(ctx context.Context, suite *Suite) *Scorecard {
+	targets := runner.opts.Targets
+	if len(targets) == 0 {
+		targets = suite.Targets
+	}
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+
+	card := &Scorecard{
+		Suite:     suite.Name,
+		CreatedAt: time.Now().UTC(),
+		Targets:   make([]TargetScore, len(targets)),
+	}
+
+	for i, target := range targets {
+		card.Targets[i] = TargetScore{
+			Target: target,
+			Cases:  make([]CaseResult, len(suite.Cases)),
+		}
+	}
+
+	type task struct {
+		target, c int
+	}
+
+	tasks := make(chan task)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runner.opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				res := runner.runCase(ctx, suite, targets[t.target], suite.Cases[t.c])
+				card.Targets[t.target].Cases[t.c] = res
+				if runner.opts.OnResult != nil {
+					runner.opts.OnResult(res)
+				}
+			}
+		}()
+	}
+
+	for i := range targets {
+		for c := range suite.Cases {
+			tasks <- task{target: i, c: c}
+		}
+	}
+	close(tasks)
+
+	wg.Wait()
+
+	for i := range card.Targets {
+		card.Targets[i].summarize()
+	}
+
+	return card
+}
+
+func (runner *Runner) runCase(
+	ctx context.Context,
+	suite *Suite,
+	target string,
+	c Case,
+) (res CaseResult) {
+	res.Case = c.Name
+	res.Target = target
+
+	started := time.Now()
+	defer func() {
+		res.Duration = time.Since(started)
+		res.Passed = res.Error == "" && allPassed(res.Assertions)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runner.opts.Timeout)
+	defer cancel()
+
+	backend, model, _ := strings.Cut(target, ":")
+
+	chat, err := runner.aiac.ChatWithOptions(ctx, backend, model, libaiac.ChatOptions{
+		SystemPrompt: suite.SystemPrompt,
+	})
+	if err != nil {
+		res.Error = fmt.Sprintf("failed starting chat: %s", err)
+		return res
+	}
+
+	resp, err := chat.Send(ctx, c.Prompt)
+	if err != nil {
+		res.Error = fmt.Sprintf("failed generating code: %s", err)
+		return res
+	}
+
+	res.Model = resp.Model
+	res.TokensUsed = resp.TokensUsed
+	res.StopReason = resp.StopReason
+
+	for _, assertion := range c.Assertions {
+		res.Assertions = append(res.Assertions, assertion.Check(resp))
+	}
+
+	return res
+}
+
+func allPassed(results []AssertionResult) bool {
+	for _, res := range results {
+		if !res.Passed {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,246 @@
+package eval_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/eval"
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestLoadSuite(t *testing.T) {
+	tests := []struct {
+		name      string
+		suite     string
+		wantCases []string
+		wantErr   error
+	}{
+		{
+			name: "valid",
+			suite: `
+name: buckets
+targets: [mock:good, mock:bad]
+cases:
+  - name: s3
+    prompt: generate terraform for an s3 bucket
+    assert: [code, {contains: aws_s3_bucket}]
+  - prompt: generate terraform for a gcs bucket
+`,
+			wantCases: []string{"s3", "case 2"},
+		},
+		{
+			name:    "no cases",
+			suite:   "name: empty\n",
+			wantErr: types.ErrInvalidSuite,
+		},
+		{
+			name:    "no prompt",
+			suite:   "cases:\n  - name: s3\n",
+			wantErr: types.ErrInvalidSuite,
+		},
+		{
+			name:    "unknown assertion",
+			suite:   "cases:\n  - prompt: p\n    assert: [compiles]\n",
+			wantErr: types.ErrInvalidSuite,
+		},
+		{
+			name:    "invalid regular expression",
+			suite:   "cases:\n  - prompt: p\n    assert: [{contains: \"(\"}]\n",
+			wantErr: types.ErrInvalidSuite,
+		},
+		{
+			name:    "unsupported format",
+			suite:   "cases:\n  - prompt: p\n    assert: [{parses: toml}]\n",
+			wantErr: types.ErrInvalidSuite,
+		},
+		{
+			name:    "invalid severity",
+			suite:   "cases:\n  - prompt: p\n    assert: [{no_findings: severe}]\n",
+			wantErr: types.ErrInvalidSuite,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suite.yaml")
+			if err := os.WriteFile(path, []byte(tt.suite), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			suite, err := eval.LoadSuite(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			var names []string
+			for _, c := range suite.Cases {
+				names = append(names, c.Name)
+			}
+
+			if strings.Join(names, ",") != strings.Join(tt.wantCases, ",") {
+				t.Errorf("expected cases %v, got %v", tt.wantCases, names)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	backend, err := mock.New(&mock.Options{Fixtures: []mock.Fixture{
+		{
+			Model:      "good",
+			Match:      "s3",
+			Response:   "```hcl\nresource \"aws_s3_bucket\" \"b\" {}\n```",
+			TokensUsed: 10,
+		},
+		{
+			Model:      "good",
+			Match:      "vpc",
+			Response:   "```hcl\nresource \"aws_vpc\" \"v\" {}\n```",
+			TokensUsed: 20,
+		},
+		{
+			Model:      "bad",
+			Match:      "s3",
+			Response:   "```hcl\nresource \"aws_s3_bucket\" {\n```",
+			StopReason: "length",
+			TokensUsed: 5,
+		},
+		{Model: "bad", Match: "vpc", Status: 500},
+	}})
+	if err != nil {
+		t.Fatalf("failed creating mock backend: %s", err)
+	}
+
+	aiac := &libaiac.Aiac{
+		Conf: libaiac.Config{
+			DefaultBackend: "mock",
+			Backends: map[string]libaiac.BackendConfig{
+				"mock": {Type: libaiac.BackendMock, DefaultModel: "good"},
+			},
+		},
+		Backends: map[string]types.Backend{"mock": backend},
+	}
+
+	suite := &eval.Suite{
+		Name:         "aws",
+		Targets:      []string{"mock:good", "mock:bad"},
+		SystemPrompt: "be terse",
+		Cases: []eval.Case{
+			{
+				Name:   "s3",
+				Prompt: "generate terraform for an s3 bucket",
+				Assertions: []eval.Assertion{
+					{Type: eval.AssertContains, Value: "aws_s3_bucket"},
+					{Type: eval.AssertValid},
+					{Type: eval.AssertComplete},
+				},
+			},
+			{
+				Name:       "vpc",
+				Prompt:     "generate terraform for a vpc",
+				Assertions: []eval.Assertion{{Type: eval.AssertCode}},
+			},
+		},
+	}
+
+	var reported int
+	card := eval.New(aiac, &eval.Options{
+		Concurrency: 1,
+		OnResult:    func(eval.CaseResult) { reported++ },
+	}).Run(context.Background(), suite)
+
+	if reported != 4 {
+		t.Errorf("expected 4 results to be reported, got %d", reported)
+	}
+
+	tests := []struct {
+		target     string
+		wantPassed []bool
+		wantTokens int64
+	}{
+		{target: "mock:good", wantPassed: []bool{true, true}, wantTokens: 30},
+		{target: "mock:bad", wantPassed: []bool{false, false}, wantTokens: 5},
+	}
+
+	for i, tt := range tests {
+		score := card.Targets[i]
+		if score.Target != tt.target {
+			t.Fatalf("expected target %d to be %s, got %s", i+1, tt.target, score.Target)
+		}
+
+		for c, want := range tt.wantPassed {
+			if got := score.Cases[c].Passed; got != want {
+				t.Errorf("expected %s/%s passed to be %t, got %t", tt.target, score.Cases[c].Case, want, got)
+			}
+		}
+
+		if score.TokensUsed != tt.wantTokens || score.Total != 2 {
+			t.Errorf("unexpected score for %s: %+v", tt.target, score)
+		}
+	}
+
+	bad := card.Targets[1]
+	var passed []bool
+	for _, res := range bad.Cases[0].Assertions {
+		passed = append(passed, res.Passed)
+	}
+
+	if len(passed) != 3 || !passed[0] || passed[1] || passed[2] {
+		t.Errorf("expected only the contains assertion to pass, got %+v", bad.Cases[0].Assertions)
+	}
+
+	if !strings.Contains(bad.Cases[1].Error, "failed generating code") {
+		t.Errorf("expected error for failed request, got %q", bad.Cases[1].Error)
+	}
+
+	if card.PassRate() != 0.5 {
+		t.Errorf("expected pass rate 0.5, got %v", card.PassRate())
+	}
+
+	for _, req := range backend.Requests() {
+		if req.Messages[0].Content != "be terse" {
+			t.Errorf("expected system prompt to be sent, got %v", req.Messages)
+		}
+	}
+
+	var md bytes.Buffer
+	if err := card.WriteMarkdown(&md); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, want := range []string{
+		"# Evaluation: aws",
+		"| mock:good | 2/2 | 100.0% | 30 |",
+		"| mock:bad | 0/2 | 0.0% | 5 |",
+		"| s3 | pass | **fail** |",
+		"- **mock:bad** / s3: `valid`: code block 1:1:26: error: Unclosed configuration block",
+		"- **mock:bad** / s3: `complete`: the response was truncated (length)",
+		"- **mock:bad** / vpc: failed generating code",
+	} {
+		if !strings.Contains(md.String(), want) {
+			t.Errorf("expected Markdown scorecard to contain %q:\n%s", want, md.String())
+		}
+	}
+
+	var decoded eval.Scorecard
+	var buf bytes.Buffer
+	if err := card.WriteJSON(&buf); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Targets) != 2 {
+		t.Errorf("failed decoding JSON scorecard: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Scorecard summarizes the results of evaluating a suite.
+type Scorecard struct {
+	// Suite is the name of the suite.
+	Suite string `json:"suite"`
+
+	// CreatedAt is the time the suite was evaluated.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Targets are the results of every target, in the order they were
+	// provided.
+	Targets []TargetScore `json:"targets"`
+}
+
+// TargetScore contains the results of evaluating a suite against a target.
+type TargetScore struct {
+	// Target is the backend and model evaluated, in the format "backend" or
+	// "backend:model". Empty for the default backend.
+	Target string `json:"target"`
+
+	// Passed is the number of cases that passed.
+	Passed int `json:"passed"`
+
+	// Total is the number of cases evaluated.
+	Total int `json:"total"`
+
+	// PassRate is the fraction of cases that passed, between 0 and 1.
+	PassRate float64 `json:"pass_rate"`
+
+	// TokensUsed is the total number of tokens used by all cases.
+	TokensUsed int64 `json:"tokens_used"`
+
+	// Duration is the total duration of all cases.
+	Duration time.Duration `json:"duration_ns"`
+
+	// Cases are the results of every case, in the order they are defined in
+	// the suite.
+	Cases []CaseResult `json:"cases"`
+}
+
+func (score *TargetScore) summarize() {
+	score.Passed, score.TokensUsed, score.Duration = 0, 0, 0
+	score.Total = len(score.Cases)
+
+	for _, res := range score.Cases {
+		if res.Passed {
+			score.Passed++
+		}
+
+		score.TokensUsed += res.TokensUsed
+		score.Duration += res.Duration
+	}
+
+	if score.Total > 0 {
+		score.PassRate = float64(score.Passed) / float64(score.Total)
+	}
+}
+
+// CaseResult is the result of evaluating a case against a target.
+type CaseResult struct {
+	// Case is the name of the case.
+	Case string `json:"case"`
+
+	// Target is the backend and model the case was evaluated against.
+	Target string `json:"target"`
+
+	// Model is the model that generated the response, if known.
+	Model string `json:"model,omitempty"`
+
+	// Passed is true if a response was generated and all assertions passed.
+	Passed bool `json:"passed"`
+
+	// Error is the error that prevented generating a response, if any.
+	Error string `json:"error,omitempty"`
+
+	// Assertions are the results of the case's assertions.
+	Assertions []AssertionResult `json:"assertions"`
+
+	// TokensUsed is the number of tokens used to generate the response.
+	TokensUsed int64 `json:"tokens_used"`
+
+	// StopReason is the reason the model stopped generating the response.
+	StopReason string `json:"stop_reason,omitempty"`
+
+	// Duration is the time it took to generate the response and check it.
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// PassRate returns the overall fraction of cases that passed, across all
+// targets.
+func (card *Scorecard) PassRate() float64 {
+	passed, total := 0, 0
+	for _, target := range card.Targets {
+		passed += target.Passed
+		total += target.Total
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(passed) / float64(total)
+}
+
+// WriteJSON writes the scorecard to w as JSON.
+func (card *Scorecard) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(card); err != nil {
+		return fmt.Errorf("failed encoding scorecard: %w", err)
+	}
+
+	return nil
+}
+
+// WriteMarkdown writes the scorecard to w as a Markdown document, with a
+// summary table of the pass rate of every target, a matrix of the results of
+// every case, and the reasons of all failures.
+func (card *Scorecard) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	title := "Evaluation"
+	if card.Suite != "" {
+		title += ": " + card.Suite
+	}
+
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "Evaluated at %s.\n\n", card.CreatedAt.Format(time.RFC3339))
+
+	b.WriteString("| Target | Passed | Pass rate | Tokens | Duration |\n")
+	b.WriteString("|---|---:|---:|---:|---:|\n")
+	for _, target := range card.Targets {
+		fmt.Fprintf(
+			&b, "| %s | %d/%d | %.1f%% | %d | %s |\n",
+			targetName(target.Target), target.Passed, target.Total,
+			target.PassRate*100, target.TokensUsed, //nolint: gomnd
+			target.Duration.Round(time.Millisecond),
+		)
+	}
+
+	if len(card.Targets) > 0 {
+		b.WriteString("\n## Cases\n\n| Case |")
+		for _, target := range card.Targets {
+			fmt.Fprintf(&b, " %s |", targetName(target.Target))
+		}
+
+		b.WriteString("\n|---|")
+		b.WriteString(strings.Repeat(":---:|", len(card.Targets)))
+		b.WriteString("\n")
+
+		for c, res := range card.Targets[0].Cases {
+			fmt.Fprintf(&b, "| %s |", escapeCell(res.Case))
+			for _, target := range card.Targets {
+				mark := "pass"
+				if !target.Cases[c].Passed {
+					mark = "**fail**"
+				}
+				fmt.Fprintf(&b, " %s |", mark)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	var failures []string
+	for _, target := range card.Targets {
+		for _, res := range target.Cases {
+			if res.Error != "" {
+				failures = append(failures, fmt.Sprintf(
+					"- **%s** / %s: %s",
+					targetName(target.Target), res.Case, res.Error,
+				))
+			}
+
+			for _, assertion := range res.Assertions {
+				if !assertion.Passed {
+					failures = append(failures, fmt.Sprintf(
+						"- **%s** / %s: `%s`: %s",
+						targetName(target.Target), res.Case, assertion.Assertion, assertion.Message,
+					))
+				}
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		fmt.Fprintf(&b, "\n## Failures\n\n%s\n", strings.Join(failures, "\n"))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func targetName(target string) string {
+	if target == "" {
+		return "default"
+	}
+
+	return target
+}
+
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
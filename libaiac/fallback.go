@@ -0,0 +1,222 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// backendRef references a backend by name, optionally with a specific model.
+type backendRef struct {
+	name  string
+	model string
+}
+
+// parseBackendRef parses a backend reference in the format "name" or
+// "name:model". As model names may include colons themselves (e.g.
+// "llama3:8b"), only the first colon is used as a separator.
+func parseBackendRef(ref string) backendRef {
+	name, model, _ := strings.Cut(ref, ":")
+	return backendRef{name: name, model: model}
+}
+
+// fallbackChain returns the chain of backends to use when the user did not
+// select a specific backend: the default backend (unless it is already part
+// of the fallback list), followed by the backends in the fallback list. If
+// model is not empty, it is used for the first backend in the chain.
+func (aiac *Aiac) fallbackChain(model string) (chain []backendRef) {
+	if aiac.Conf.DefaultBackend != "" {
+		listed := false
+		for _, entry := range aiac.Conf.Fallback {
+			if parseBackendRef(entry).name == aiac.Conf.DefaultBackend {
+				listed = true
+				break
+			}
+		}
+
+		if !listed {
+			chain = append(chain, backendRef{name: aiac.Conf.DefaultBackend})
+		}
+	}
+
+	for _, entry := range aiac.Conf.Fallback {
+		chain = append(chain, parseBackendRef(entry))
+	}
+
+	if len(chain) == 0 {
+		// no default backend and no fallbacks, this will fail with
+		// ErrNoDefaultBackend when the conversation is started
+		chain = append(chain, backendRef{})
+	}
+
+	if model != "" {
+		chain[0].model = model
+	}
+
+	return chain
+}
+
+// shouldFallback returns true if a request that failed with the provided error
+// may succeed with a different backend. Errors caused by invalid requests
+// (i.e. types.ErrRequestFailed) or by the context being canceled or expiring
+// will not be fixed by a different backend.
+func shouldFallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var retryable *types.RetryableError
+	if errors.As(err, &retryable) {
+		return true
+	}
+
+	return !errors.Is(err, types.ErrRequestFailed)
+}
+
+// fallbackConversation is a Conversation over a chain of backends. Messages are
+// sent to the current backend in the chain; if it fails, the conversation
+// moves to the next backend in the chain, carrying the message history with
+// it. A chain may consist of a single backend, in which case there is no
+// fallback. Responses report the backend and model that produced them, and
+// whether they were produced by a fallback backend.
+type fallbackConversation struct {
+	aiac    *Aiac
+	opts    ChatOptions
+	chain   []backendRef
+	current int
+	conv    types.Conversation
+	name    string
+	model   string
+	headers map[string]string
+	params  *types.InferenceParams
+}
+
+// start starts a conversation with the first backend in the chain, starting
+// from the provided index, that can be loaded successfully.
+func (conv *fallbackConversation) start(
+	ctx context.Context,
+	from int,
+	msgs []types.Message,
+) (err error) {
+	for i := from; i < len(conv.chain); i++ {
+		name, nameErr := conv.aiac.resolveBackendName(conv.chain[i].name)
+		if nameErr != nil {
+			err = nameErr
+			continue
+		}
+
+		chat, model, startErr := conv.aiac.startChat(
+			ctx,
+			name,
+			conv.chain[i].model,
+			conv.opts,
+			msgs,
+		)
+		if startErr != nil {
+			err = startErr
+			continue
+		}
+
+		for key, val := range conv.headers {
+			chat.AddHeader(key, val)
+		}
+
+		if conv.params != nil {
+			chat.SetInferenceParams(*conv.params)
+		}
+
+		conv.conv = chat
+		conv.current = i
+		conv.name = name
+		conv.model = model
+
+		return nil
+	}
+
+	return err
+}
+
+// Send sends the provided message to the current backend, moving to the next
+// backend in the chain if it fails.
+func (conv *fallbackConversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	return conv.send(ctx, func(chat types.Conversation) (types.Response, error) {
+		return chat.Send(ctx, prompt)
+	}, nil)
+}
+
+// SendStream is the same as Send, but streams the response. The conversation
+// only moves to the next backend if the current one failed before any output
+// was streamed, otherwise the caller would receive duplicate output.
+func (conv *fallbackConversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	var streamed bool
+
+	return conv.send(ctx, func(chat types.Conversation) (types.Response, error) {
+		return chat.SendStream(ctx, prompt, func(chunk string) {
+			streamed = true
+			fn(chunk)
+		})
+	}, &streamed)
+}
+
+func (conv *fallbackConversation) send(
+	ctx context.Context,
+	send func(types.Conversation) (types.Response, error),
+	streamed *bool,
+) (res types.Response, err error) {
+	for {
+		res, err = send(conv.conv)
+		if err == nil {
+			res.Backend = conv.name
+			res.Model = conv.model
+			res.Fallback = conv.current > 0
+			return res, nil
+		}
+
+		if conv.current == len(conv.chain)-1 ||
+			(streamed != nil && *streamed) ||
+			!shouldFallback(ctx, err) {
+			return res, err
+		}
+
+		failed := conv.name
+		if startErr := conv.start(ctx, conv.current+1, conv.conv.Messages()); startErr != nil {
+			return res, fmt.Errorf(
+				"backend %s failed and no fallback is available: %w",
+				failed, err,
+			)
+		}
+	}
+}
+
+// Messages returns all the messages that have been exchanged between the user
+// and the assistant up to this point, across all backends used.
+func (conv *fallbackConversation) Messages() []types.Message {
+	return conv.conv.Messages()
+}
+
+// AddHeader adds an extra HTTP header to every HTTP request issued as part of
+// this conversation, including with fallback backends.
+func (conv *fallbackConversation) AddHeader(key, val string) {
+	if conv.headers == nil {
+		conv.headers = make(map[string]string)
+	}
+	conv.headers[key] = val
+	conv.conv.AddHeader(key, val)
+}
+
+// SetInferenceParams sets the inference parameters for all subsequent
+// messages in this conversation, including with fallback backends.
+func (conv *fallbackConversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = &params
+	conv.conv.SetInferenceParams(params)
+}
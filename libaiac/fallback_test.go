@@ -0,0 +1,300 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestParseBackendRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want backendRef
+	}{
+		{ref: "openai", want: backendRef{name: "openai"}},
+		{ref: "openai:gpt-4o", want: backendRef{name: "openai", model: "gpt-4o"}},
+		{ref: "ollama:llama3:8b", want: backendRef{name: "ollama", model: "llama3:8b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			if got := parseBackendRef(tt.ref); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultBackend string
+		fallback       []string
+		model          string
+		want           []backendRef
+	}{
+		{
+			name: "nothing configured",
+			want: []backendRef{{}},
+		},
+		{
+			name:           "default backend only",
+			defaultBackend: "a",
+			model:          "m",
+			want:           []backendRef{{name: "a", model: "m"}},
+		},
+		{
+			name:           "default backend first",
+			defaultBackend: "a",
+			fallback:       []string{"b:x", "c"},
+			want:           []backendRef{{name: "a"}, {name: "b", model: "x"}, {name: "c"}},
+		},
+		{
+			name:           "default backend listed",
+			defaultBackend: "b",
+			fallback:       []string{"a", "b:x"},
+			model:          "m",
+			want:           []backendRef{{name: "a", model: "m"}, {name: "b", model: "x"}},
+		},
+		{
+			name:     "no default backend",
+			fallback: []string{"a", "b"},
+			want:     []backendRef{{name: "a"}, {name: "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aiac := &Aiac{Conf: Config{
+				DefaultBackend: tt.defaultBackend,
+				Fallback:       tt.fallback,
+			}}
+
+			if got := aiac.fallbackChain(tt.model); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fallbackAiac returns an Aiac object with two mock backends, "primary" and
+// "secondary", with the provided fallback chain. The primary backend is the
+// default one, and every backend's default model is named after it.
+func fallbackAiac(primary, secondary *mock.Mock, fallback ...string) *Aiac {
+	return &Aiac{
+		Conf: Config{
+			DefaultBackend: "primary",
+			Fallback:       fallback,
+			Backends: map[string]BackendConfig{
+				"primary":   {Type: BackendMock, DefaultModel: "primary-model"},
+				"secondary": {Type: BackendMock, DefaultModel: "secondary-model"},
+			},
+		},
+		Backends: map[string]types.Backend{
+			"primary":   primary,
+			"secondary": secondary,
+		},
+	}
+}
+
+// newMocks creates a mock backend for every list of fixtures provided.
+func newMocks(t *testing.T, fixtures ...[]mock.Fixture) (backends []*mock.Mock) {
+	t.Helper()
+
+	for _, list := range fixtures {
+		backend, err := mock.New(&mock.Options{Fixtures: list})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		backends = append(backends, backend)
+	}
+
+	return backends
+}
+
+func TestFallback(t *testing.T) {
+	backends := newMocks(t,
+		[]mock.Fixture{{Status: http.StatusServiceUnavailable}},
+		[]mock.Fixture{{Response: "ok"}},
+	)
+
+	chat, err := fallbackAiac(backends[0], backends[1], "secondary").
+		Chat(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Backend != "secondary" || res.Model != "secondary-model" || !res.Fallback {
+		t.Errorf(
+			"expected fallback response from secondary/secondary-model, got %s/%s (fallback %t)",
+			res.Backend, res.Model, res.Fallback,
+		)
+	}
+}
+
+func TestFallbackModel(t *testing.T) {
+	backends := newMocks(t,
+		[]mock.Fixture{{Status: http.StatusUnauthorized}},
+		[]mock.Fixture{{Response: "ok"}},
+	)
+
+	chat, err := fallbackAiac(backends[0], backends[1], "secondary:other").
+		Chat(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Model != "other" || backends[1].Requests()[0].Model != "other" {
+		t.Errorf("expected model other to be used, got %s", res.Model)
+	}
+}
+
+func TestFallbackNotNeeded(t *testing.T) {
+	backends := newMocks(t,
+		[]mock.Fixture{{Response: "ok"}},
+		[]mock.Fixture{{Response: "ok"}},
+	)
+
+	chat, err := fallbackAiac(backends[0], backends[1], "secondary").
+		Chat(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Backend != "primary" || res.Model != "primary-model" || res.Fallback {
+		t.Errorf(
+			"expected response from primary/primary-model, got %s/%s (fallback %t)",
+			res.Backend, res.Model, res.Fallback,
+		)
+	}
+
+	if got := len(backends[1].Requests()); got != 0 {
+		t.Errorf("expected no requests to secondary backend, got %d", got)
+	}
+}
+
+func TestFallbackNotAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		backendName string
+		fallback    []string
+		primary     mock.Fixture
+		secondary   mock.Fixture
+		wantErr     error
+	}{
+		{
+			name:      "invalid request",
+			fallback:  []string{"secondary"},
+			primary:   mock.Fixture{Error: "prompt too long"},
+			secondary: mock.Fixture{Response: "ok"},
+			wantErr:   types.ErrRequestFailed,
+		},
+		{
+			name:      "all backends fail",
+			fallback:  []string{"secondary"},
+			primary:   mock.Fixture{Status: http.StatusServiceUnavailable},
+			secondary: mock.Fixture{Status: http.StatusBadGateway},
+			wantErr:   types.ErrUnexpectedStatus,
+		},
+		{
+			name:        "backend selected",
+			backendName: "primary",
+			fallback:    []string{"secondary"},
+			primary:     mock.Fixture{Status: http.StatusServiceUnavailable},
+			secondary:   mock.Fixture{Response: "ok"},
+			wantErr:     types.ErrUnexpectedStatus,
+		},
+		{
+			name:      "no fallback configured",
+			primary:   mock.Fixture{Status: http.StatusServiceUnavailable},
+			secondary: mock.Fixture{Response: "ok"},
+			wantErr:   types.ErrUnexpectedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := newMocks(t,
+				[]mock.Fixture{tt.primary},
+				[]mock.Fixture{tt.secondary},
+			)
+
+			chat, err := fallbackAiac(backends[0], backends[1], tt.fallback...).
+				Chat(context.Background(), tt.backendName, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			_, err = chat.Send(context.Background(), "prompt")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFallbackCarriesHistory(t *testing.T) {
+	backends := newMocks(t,
+		[]mock.Fixture{
+			{Prompt: "first", Response: "one"},
+			{Status: http.StatusServiceUnavailable},
+		},
+		[]mock.Fixture{{Response: "two"}},
+	)
+
+	chat, err := fallbackAiac(backends[0], backends[1], "secondary").
+		Chat(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat.AddHeader("X-Test", "yes")
+
+	for _, prompt := range []string{"first", "second"} {
+		if _, err := chat.Send(context.Background(), prompt); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	reqs := backends[1].Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request to secondary backend, got %d", len(reqs))
+	}
+
+	want := []types.Message{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "one"},
+		{Role: "user", Content: "second"},
+	}
+	if !reflect.DeepEqual(reqs[0].Messages, want) {
+		t.Errorf("expected messages %v, got %v", want, reqs[0].Messages)
+	}
+
+	if reqs[0].Headers["X-Test"] != "yes" {
+		t.Errorf("expected headers to carry over, got %v", reqs[0].Headers)
+	}
+
+	if got := len(chat.Messages()); got != 4 {
+		t.Errorf("expected 4 messages in conversation, got %d", got)
+	}
+}
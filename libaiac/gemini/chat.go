@@ -0,0 +1,323 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/ido50/requests"
+)
+
+// Conversation is a struct used to converse with a Gemini chat model. It
+// maintains all messages sent/received in order to maintain context.
+type Conversation struct {
+	backend      *Gemini
+	model        string
+	system       string
+	messages     []types.Message
+	extraHeaders map[string]string
+	params       types.InferenceParams
+}
+
+type part struct {
+	Text string `json:"text"`
+}
+
+type content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+type chatResponse struct {
+	Candidates []struct {
+		Content      content `json:"content"`
+		FinishReason string  `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		TotalTokenCount int64 `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	errorResponse
+}
+
+// text returns the text of the first candidate in the response, if any.
+func (answer chatResponse) text() string {
+	if len(answer.Candidates) == 0 {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, p := range answer.Candidates[0].Content.Parts {
+		text.WriteString(p.Text)
+	}
+
+	return text.String()
+}
+
+// Chat initiates a conversation with a Gemini chat model. A conversation
+// maintains context, allowing to send further instructions to modify the output
+// from previous requests. The name of the model to use must be provided. Users
+// can also supply zero or more "previous messages" that may have been exchanged
+// in the past. This practically allows "loading" previous conversations and
+// continuing them. Messages with the "system" role are sent to Gemini as the
+// system instruction rather than as part of the conversation.
+func (backend *Gemini) Chat(model string, msgs ...types.Message) types.Conversation {
+	conv := &Conversation{
+		backend: backend,
+		model:   strings.TrimPrefix(model, "models/"),
+	}
+
+	for _, msg := range msgs {
+		if msg.Role == "system" {
+			conv.system = msg.Content
+			continue
+		}
+
+		conv.messages = append(conv.messages, msg)
+	}
+
+	return conv
+}
+
+// Send sends the provided message to the API and returns a Response object.
+// To maintain context, all previous messages (whether from you to the API or
+// vice-versa) are sent as well, allowing you to ask the API to modify the
+// code it already generated.
+func (conv *Conversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	var (
+		answer     chatResponse
+		retryAfter string
+	)
+
+	err = conv.newRequest(prompt).
+		Into(&answer).
+		HeaderInto("Retry-After", &retryAfter).
+		RunContext(ctx)
+	if err != nil {
+		return res, fmt.Errorf(
+			"failed sending prompt: %w",
+			types.WithRetryAfter(err, retryAfter),
+		)
+	}
+
+	output := answer.text()
+	if output == "" {
+		return res, types.ErrNoResults
+	}
+
+	return conv.finish(
+		prompt,
+		output,
+		answer.UsageMetadata.TotalTokenCount,
+		answer.Candidates[0].FinishReason,
+	), nil
+}
+
+// SendStream is the same as Send, but streams the response via server-sent
+// events. The provided function is called with every chunk of text as it
+// is received from the API.
+func (conv *Conversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	stream, err := types.OpenStream(ctx, types.StreamRequest{
+		Client: conv.backend.httpClient,
+		URL: fmt.Sprintf(
+			"%s/models/%s:streamGenerateContent?alt=sse",
+			conv.backend.url, conv.model,
+		),
+		Headers:      conv.backend.headers,
+		ExtraHeaders: conv.extraHeaders,
+		Body:         conv.requestBody(prompt),
+		ErrorHandler: handleError,
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", err)
+	}
+	defer stream.Close()
+
+	var (
+		output     strings.Builder
+		tokensUsed int64
+		stopReason string
+	)
+
+	for stream.Scan() {
+		line := stream.Bytes()
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+
+		var chunk chatResponse
+		err = json.Unmarshal(bytes.TrimPrefix(line, []byte("data:")), &chunk)
+		if err != nil {
+			return res, fmt.Errorf("failed decoding stream: %w", err)
+		}
+
+		if chunk.Error.Message != "" {
+			return res, chunk.err()
+		}
+
+		if delta := chunk.text(); delta != "" {
+			output.WriteString(delta)
+			fn(delta)
+		}
+
+		if len(chunk.Candidates) > 0 && chunk.Candidates[0].FinishReason != "" {
+			stopReason = chunk.Candidates[0].FinishReason
+		}
+
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			tokensUsed = chunk.UsageMetadata.TotalTokenCount
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return res, fmt.Errorf("failed reading stream: %w", err)
+	}
+
+	if output.Len() == 0 {
+		return res, types.ErrNoResults
+	}
+
+	return conv.finish(prompt, output.String(), tokensUsed, stopReason), nil
+}
+
+// newRequest creates a content generation request for the conversation,
+// including all messages exchanged so far and the new prompt.
+func (conv *Conversation) newRequest(prompt string) *requests.HTTPRequest {
+	req := conv.backend.
+		NewRequest("POST", fmt.Sprintf("/models/%s:generateContent", conv.model)).
+		JSONBody(conv.requestBody(prompt))
+
+	for key, val := range conv.extraHeaders {
+		req.Header(key, val)
+	}
+
+	return req
+}
+
+// requestBody returns the body of a content generation request for the
+// conversation, including all messages exchanged so far and the new prompt.
+// Messages from the assistant are sent with Gemini's "model" role, all others
+// with the "user" role.
+func (conv *Conversation) requestBody(prompt string) map[string]interface{} {
+	messages := append(
+		conv.messages[:len(conv.messages):len(conv.messages)],
+		types.Message{Role: "user", Content: prompt},
+	)
+
+	contents := make([]content, len(messages))
+	for i, msg := range messages {
+		role := "user"
+		if msg.Role == "assistant" || msg.Role == "model" {
+			role = "model"
+		}
+
+		contents[i] = content{
+			Role:  role,
+			Parts: []part{{Text: msg.Content}},
+		}
+	}
+
+	generationConfig := map[string]interface{}{
+		"temperature": conv.params.GetTemperature(),
+	}
+
+	if conv.params.MaxTokens != nil {
+		generationConfig["maxOutputTokens"] = *conv.params.MaxTokens
+	}
+
+	if conv.params.TopP != nil {
+		generationConfig["topP"] = *conv.params.TopP
+	}
+
+	if len(conv.params.StopSequences) > 0 {
+		generationConfig["stopSequences"] = conv.params.StopSequences
+	}
+
+	if conv.params.Seed != nil {
+		generationConfig["seed"] = *conv.params.Seed
+	}
+
+	body := map[string]interface{}{
+		"contents":         contents,
+		"generationConfig": generationConfig,
+	}
+
+	if conv.system != "" {
+		body["systemInstruction"] = content{
+			Parts: []part{{Text: conv.system}},
+		}
+	}
+
+	return body
+}
+
+// finish records the user's prompt and the assistant's response in the
+// conversation and creates the Response object returned to the caller. The
+// conversation is only updated once a response is received, so that failed
+// requests can be retried without duplicating the user's prompt.
+func (conv *Conversation) finish(
+	prompt string,
+	output string,
+	tokensUsed int64,
+	stopReason string,
+) (res types.Response) {
+	conv.messages = append(
+		conv.messages,
+		types.Message{Role: "user", Content: prompt},
+		types.Message{Role: "assistant", Content: output},
+	)
+
+	res.FullOutput = strings.TrimSpace(output)
+	res.APIKeyUsed = conv.backend.apiKey
+	res.TokensUsed = tokensUsed
+	res.StopReason = stopReason
+
+	var ok bool
+	if res.Code, ok = types.ExtractCode(res.FullOutput); !ok {
+		res.Code = res.FullOutput
+	}
+
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res
+}
+
+// Messages returns all the messages that have been exchanged between the user
+// and the assistant up to this point. If the conversation has a system
+// instruction, it is returned as the first message, with the "system" role.
+func (conv *Conversation) Messages() []types.Message {
+	if conv.system == "" {
+		return conv.messages
+	}
+
+	return append(
+		[]types.Message{{Role: "system", Content: conv.system}},
+		conv.messages...,
+	)
+}
+
+// AddHeader adds an extra HTTP header that will be added to every HTTP
+// request issued as part of this conversation. Any headers added will be in
+// addition to any extra headers defined for the backend itself, and will
+// take precedence over them.
+func (conv *Conversation) AddHeader(key, val string) {
+	if conv.extraHeaders == nil {
+		conv.extraHeaders = make(map[string]string)
+	}
+	conv.extraHeaders[key] = val
+}
+
+// SetInferenceParams sets the parameters that control how the model
+// generates responses for all subsequent messages in this conversation.
+func (conv *Conversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = params
+}
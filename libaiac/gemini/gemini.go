@@ -0,0 +1,135 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/ido50/requests"
+)
+
+const (
+	// DefaultAPIURL is the default URL for the Google Gemini API
+	DefaultAPIURL = "https://generativelanguage.googleapis.com"
+
+	// DefaultAPIVersion is the default version of the Gemini API to use
+	DefaultAPIVersion = "v1beta"
+)
+
+// Gemini is a structure used to continuously generate IaC code via Google
+// Gemini
+type Gemini struct {
+	*requests.HTTPClient
+	url        string
+	headers    map[string]string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// APIKey is the Gemini API key to use for requests. Required.
+	APIKey string
+
+	// URL is the Gemini API URL to use, without the API version path.
+	// Optional, defaults to DefaultAPIURL.
+	URL string
+
+	// APIVersion is the version of the Gemini API to use (e.g. "v1" or
+	// "v1beta"). Optional, defaults to DefaultAPIVersion.
+	APIVersion string
+
+	// ExtraHeaders are extra HTTP headers to send with every request to the
+	// provider.
+	ExtraHeaders map[string]string
+}
+
+// New creates a new instance of the Gemini struct, with the provided input
+// options. The Gemini API is not yet contacted at this point.
+func New(opts *Options) *Gemini {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.URL == "" {
+		opts.URL = DefaultAPIURL
+	}
+
+	if opts.APIVersion == "" {
+		opts.APIVersion = DefaultAPIVersion
+	}
+
+	backend := &Gemini{
+		url: fmt.Sprintf("%s/%s", strings.TrimSuffix(opts.URL, "/"), opts.APIVersion),
+		headers: map[string]string{
+			"x-goog-api-key": opts.APIKey,
+		},
+		apiKey: opts.APIKey,
+	}
+
+	for header, value := range opts.ExtraHeaders {
+		backend.headers[header] = value
+	}
+
+	backend.HTTPClient = requests.NewClient(backend.url).
+		Accept("application/json").
+		ErrorHandler(handleError)
+
+	for header, value := range backend.headers {
+		backend.HTTPClient.Header(header, value)
+	}
+
+	// The same HTTP client is used for regular and streamed requests
+	backend.httpClient = &http.Client{}
+	backend.HTTPClient.CustomHTTPClient(backend.httpClient)
+
+	return backend
+}
+
+// handleError creates the error returned when the Gemini API responds with an
+// unsuccessful status code.
+func handleError(
+	httpStatus int,
+	contentType string,
+	body io.Reader,
+) error {
+	var res errorResponse
+
+	err := json.NewDecoder(body).Decode(&res)
+	if err != nil || res.Error.Message == "" {
+		err = fmt.Errorf(
+			"%w %s",
+			types.ErrUnexpectedStatus,
+			http.StatusText(httpStatus),
+		)
+	} else {
+		err = res.err()
+	}
+
+	if types.IsRetryableStatus(httpStatus) {
+		return &types.RetryableError{Err: err}
+	}
+
+	return err
+}
+
+type errorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func (res errorResponse) err() error {
+	return fmt.Errorf(
+		"%w: [%s]: %s",
+		types.ErrRequestFailed,
+		res.Error.Status,
+		res.Error.Message,
+	)
+}
@@ -0,0 +1,280 @@
+package gemini_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/gemini"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// request is a request received by the test server.
+type request struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newServer starts a test server that records every request it receives and
+// responds with the provided handler.
+func newServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *[]request) {
+	t.Helper()
+
+	var requests []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			method: r.Method,
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			header: r.Header,
+		}
+
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			t.Errorf("request body is not valid JSON: %s", err)
+		}
+
+		requests = append(requests, req)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func newBackend(url string) *gemini.Gemini {
+	return gemini.New(&gemini.Options{
+		APIKey:       "goog-test",
+		URL:          url,
+		ExtraHeaders: map[string]string{"X-Backend": "yes"},
+	})
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name          string
+		finishReason  string
+		wantTruncated bool
+	}{
+		{name: "complete", finishReason: "STOP"},
+		{name: "truncated", finishReason: "MAX_TOKENS", wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{
+					"candidates": [{
+						"content": {"role": "model", "parts": [{"text": "`+"```hcl\\n"+`"}, {"text": "resource {}\n`+"```"+`"}]},
+						"finishReason": %q
+					}],
+					"usageMetadata": {"totalTokenCount": 21}
+				}`, tt.finishReason)
+			})
+
+			conv := newBackend(srv.URL).Chat(
+				"models/gemini-test",
+				types.Message{Role: "system", Content: "be terse"},
+				types.Message{Role: "user", Content: "hello"},
+				types.Message{Role: "assistant", Content: "hi"},
+			)
+			conv.AddHeader("X-Conversation", "yes")
+
+			maxTokens := 100
+			conv.SetInferenceParams(types.InferenceParams{MaxTokens: &maxTokens})
+
+			res, err := conv.Send(context.Background(), "generate terraform")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(*requests))
+			}
+
+			req := (*requests)[0]
+			wantPath := "/" + gemini.DefaultAPIVersion + "/models/gemini-test:generateContent"
+			if req.method != http.MethodPost || req.path != wantPath {
+				t.Errorf("expected POST %s, got %s %s", wantPath, req.method, req.path)
+			}
+
+			for header, want := range map[string]string{
+				"X-Goog-Api-Key": "goog-test",
+				"X-Backend":      "yes",
+				"X-Conversation": "yes",
+			} {
+				if got := req.header.Get(header); got != want {
+					t.Errorf("expected header %s to be %q, got %q", header, want, got)
+				}
+			}
+
+			contents, _ := req.body["contents"].([]interface{})
+			var roles []string
+			for _, c := range contents {
+				roles = append(roles, c.(map[string]interface{})["role"].(string))
+			}
+			if strings.Join(roles, ",") != "user,model,user" {
+				t.Errorf("unexpected roles %v", roles)
+			}
+
+			if _, ok := req.body["systemInstruction"]; !ok {
+				t.Errorf("expected a system instruction in %v", req.body)
+			}
+
+			config, _ := req.body["generationConfig"].(map[string]interface{})
+			if config["maxOutputTokens"] != float64(100) {
+				t.Errorf("expected maxOutputTokens 100, got %v", config["maxOutputTokens"])
+			}
+
+			if res.Code != "resource {}" || res.TokensUsed != 21 {
+				t.Errorf("unexpected response %+v", res)
+			}
+
+			if got := types.IsTruncated(res.StopReason); got != tt.wantTruncated {
+				t.Errorf("expected truncated to be %t, got %t (%s)", tt.wantTruncated, got, res.StopReason)
+			}
+
+			if got := len(conv.Messages()); got != 5 {
+				t.Errorf("expected 5 messages in conversation, got %d", got)
+			}
+		})
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for _, chunk := range []string{
+			`{"candidates": [{"content": {"parts": [{"text": "resource "}]}}]}`,
+			`{"candidates": [{"content": {"parts": [{"text": "{}"}]}, "finishReason": "MAX_TOKENS"}], "usageMetadata": {"totalTokenCount": 9}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+		}
+	})
+
+	var chunks []string
+
+	res, err := newBackend(srv.URL).Chat("gemini-test").SendStream(
+		context.Background(),
+		"generate terraform",
+		func(chunk string) { chunks = append(chunks, chunk) },
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	wantPath := "/" + gemini.DefaultAPIVersion + "/models/gemini-test:streamGenerateContent"
+	if req.path != wantPath || req.query != "alt=sse" {
+		t.Errorf("expected a request to %s?alt=sse, got %s?%s", wantPath, req.path, req.query)
+	}
+
+	if req.header.Get("X-Goog-Api-Key") != "goog-test" {
+		t.Errorf("expected API key header, got %v", req.header)
+	}
+
+	if strings.Join(chunks, "|") != "resource |{}" {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+
+	if res.FullOutput != "resource {}" || res.TokensUsed != 9 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if !types.IsTruncated(res.StopReason) {
+		t.Errorf("expected response to be truncated, got stop reason %q", res.StopReason)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		retryAfter     string
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+		wantErr        error
+	}{
+		{
+			name:           "rate limited",
+			status:         http.StatusTooManyRequests,
+			body:           `{"error": {"code": 429, "message": "quota exceeded", "status": "RESOURCE_EXHAUSTED"}}`,
+			retryAfter:     "2",
+			wantRetryable:  true,
+			wantRetryAfter: 2 * time.Second,
+			wantErr:        types.ErrRequestFailed,
+		},
+		{
+			name:          "internal error without body",
+			status:        http.StatusInternalServerError,
+			wantRetryable: true,
+			wantErr:       types.ErrUnexpectedStatus,
+		},
+		{
+			name:    "invalid argument",
+			status:  http.StatusBadRequest,
+			body:    `{"error": {"code": 400, "message": "bad", "status": "INVALID_ARGUMENT"}}`,
+			wantErr: types.ErrRequestFailed,
+		},
+		{
+			name:    "forbidden",
+			status:  http.StatusForbidden,
+			wantErr: types.ErrUnexpectedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%t", tt.name, stream), func(t *testing.T) {
+				srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				})
+
+				conv := newBackend(srv.URL).Chat("gemini-test")
+
+				var err error
+				if stream {
+					_, err = conv.SendStream(context.Background(), "prompt", func(string) {})
+				} else {
+					_, err = conv.Send(context.Background(), "prompt")
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error wrapping %q, got %v", tt.wantErr, err)
+				}
+
+				var retryable *types.RetryableError
+				if got := errors.As(err, &retryable); got != tt.wantRetryable {
+					t.Fatalf("expected retryable to be %t, got %t", tt.wantRetryable, got)
+				}
+
+				if retryable != nil && retryable.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("expected retry after %s, got %s", tt.wantRetryAfter, retryable.RetryAfter)
+				}
+
+				if got := len(conv.Messages()); got != 0 {
+					t.Errorf("expected failed request not to be recorded, got %d messages", got)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// ListModels returns a list of all the models supported by this backend. Only
+// models that support content generation are returned.
+func (backend *Gemini) ListModels(ctx context.Context) (
+	models []string,
+	err error,
+) {
+	var pageToken string
+
+	for {
+		var retryAfter string
+
+		var answer struct {
+			Models []struct {
+				Name                       string   `json:"name"`
+				SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+			} `json:"models"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+
+		req := backend.
+			NewRequest("GET", "/models").
+			QueryParam("pageSize", "1000").
+			Into(&answer).
+			HeaderInto("Retry-After", &retryAfter)
+
+		if pageToken != "" {
+			req.QueryParam("pageToken", pageToken)
+		}
+
+		err = req.RunContext(ctx)
+		if err != nil {
+			return models, fmt.Errorf(
+				"failed listing models: %w",
+				types.WithRetryAfter(err, retryAfter),
+			)
+		}
+
+		for _, model := range answer.Models {
+			for _, method := range model.SupportedGenerationMethods {
+				if method == "generateContent" {
+					models = append(models, strings.TrimPrefix(model.Name, "models/"))
+					break
+				}
+			}
+		}
+
+		if answer.NextPageToken == "" {
+			break
+		}
+
+		pageToken = answer.NextPageToken
+	}
+
+	if len(models) == 0 {
+		return models, types.ErrNoResults
+	}
+
+	sort.Strings(models)
+
+	return models, nil
+}
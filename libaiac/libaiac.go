@@ -3,24 +3,43 @@ package libaiac
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/gofireflyio/aiac/v5/libaiac/anthropic"
 	"github.com/gofireflyio/aiac/v5/libaiac/bedrock"
+	"github.com/gofireflyio/aiac/v5/libaiac/cassette"
+	"github.com/gofireflyio/aiac/v5/libaiac/gemini"
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
 	"github.com/gofireflyio/aiac/v5/libaiac/ollama"
 	"github.com/gofireflyio/aiac/v5/libaiac/openai"
+	"github.com/gofireflyio/aiac/v5/libaiac/templates"
 	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
 )
 
 // Version contains aiac's version string
 var Version = "development"
 
-// Aiac provides the main interface for using libaiac.
+// Aiac provides the main interface for using libaiac. It is safe for
+// concurrent use by multiple goroutines, e.g. to run multiple conversations in
+// parallel (see the batch package). Backends are loaded from the configuration
+// once, and shared by all conversations that use them.
 type Aiac struct {
 	// Conf holds the configuration for aiac.
 	Conf Config
 
 	// Backends is a map from backend names to backend implementations.
+	// Backends loaded from the configuration are cached here.
 	Backends map[string]types.Backend
+
+	// backendsMu protects Backends while backends are loaded.
+	backendsMu sync.Mutex
+
+	// Cassette, if set, is used by OpenAI and Ollama backends to record their
+	// HTTP exchanges, or to replay previously recorded exchanges without
+	// network access (see the cassette package).
+	Cassette *cassette.Cassette
 }
 
 // New constructs a new Aiac object with the path to a configuration file. If
@@ -62,6 +81,47 @@ func (aiac *Aiac) ListModels(ctx context.Context, backendName string) (
 	return backend.ListModels(ctx)
 }
 
+// ChatOptions contains optional parameters for starting a chat conversation
+// via ChatWithOptions.
+type ChatOptions struct {
+	// Messages are previous messages that may have been exchanged in the past,
+	// allowing to "load" previous conversations and continue them.
+	Messages []types.Message
+
+	// SystemPrompt is a system prompt to send to the model, steering its
+	// behavior throughout the conversation. Overrides the system prompt
+	// defined in the backend configuration, if any.
+	SystemPrompt string
+
+	// Inference holds parameters that control how the model generates
+	// responses. Any parameters set here take precedence over those defined
+	// in the backend configuration.
+	Inference types.InferenceParams
+
+	// MaxContinuations enables automatic continuation of responses that were
+	// truncated due to the token limit. When larger than zero, the model is
+	// asked to continue a truncated response up to this many times, and the
+	// fragments are stitched into a single response. The number of rounds
+	// needed is reported in the response's Continuations field.
+	MaxContinuations int
+
+	// MaxRepairs enables automatic repair of responses that fail validation.
+	// When larger than zero, every response is validated with Validator, and
+	// the model is asked to fix the problems found up to this many times. If
+	// the response still fails validation, an error of type *RepairError is
+	// returned together with the last response. The number of rounds needed
+	// is reported in the response's Repairs field.
+	MaxRepairs int
+
+	// Validator is the validator used for automatic repair. Defaults to the
+	// built-in validators (see validation.Validate).
+	Validator validation.Validator
+
+	// OnRepair, if provided, is called before every repair round with the
+	// response that failed validation and the problems found in it.
+	OnRepair func(RepairAttempt)
+}
+
 // Chat initiates a chat conversation with the provided chat model of the
 // selected backend. Returns a Conversation object with which messages can be
 // sent and received. If backendName is an empty string, the default backend
@@ -76,42 +136,157 @@ func (aiac *Aiac) Chat(
 	model string,
 	msgs ...types.Message,
 ) (chat types.Conversation, err error) {
-	backend, defaultModel, err := aiac.loadBackend(ctx, backendName)
+	return aiac.ChatWithOptions(ctx, backendName, model, ChatOptions{
+		Messages: msgs,
+	})
+}
+
+// ChatWithOptions is the same as Chat, but accepts a ChatOptions object that
+// allows further customizing the conversation, e.g. by setting a system
+// prompt or inference parameters. If backendName is an empty string and the
+// configuration defines a fallback chain, the returned conversation will
+// transparently move to the next backend in the chain whenever a backend
+// fails (see Config.Fallback).
+func (aiac *Aiac) ChatWithOptions(
+	ctx context.Context,
+	backendName string,
+	model string,
+	opts ChatOptions,
+) (chat types.Conversation, err error) {
+	chain := []backendRef{{name: backendName, model: model}}
+	if backendName == "" {
+		chain = aiac.fallbackChain(model)
+	}
+
+	fallback := &fallbackConversation{
+		aiac:  aiac,
+		opts:  opts,
+		chain: chain,
+	}
+
+	err = fallback.start(ctx, 0, opts.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	chat = fallback
+
+	if opts.MaxContinuations > 0 {
+		chat = &continuingConversation{
+			Conversation: chat,
+			maxRounds:    opts.MaxContinuations,
+		}
+	}
+
+	if opts.MaxRepairs > 0 {
+		validator := opts.Validator
+		if validator == nil {
+			validator = validation.ValidatorFunc(validation.Validate)
+		}
+
+		chat = &repairingConversation{
+			Conversation: chat,
+			validator:    validator,
+			maxRounds:    opts.MaxRepairs,
+			onRepair:     opts.OnRepair,
+		}
+	}
+
+	return chat, nil
+}
+
+// startChat starts a conversation with the selected backend and model, or the
+// backend's default model if one isn't provided. The system prompt and
+// inference parameters are taken from the options and the backend's
+// configuration. Returns the name of the model used.
+func (aiac *Aiac) startChat(
+	ctx context.Context,
+	backendName string,
+	model string,
+	opts ChatOptions,
+	msgs []types.Message,
+) (chat types.Conversation, usedModel string, err error) {
+	backend, backendConf, err := aiac.loadBackend(ctx, backendName)
 	if err != nil {
-		return chat, fmt.Errorf("failed loading backend: %w", err)
+		return chat, model, fmt.Errorf("failed loading backend: %w", err)
 	}
 
 	if model == "" {
-		if defaultModel == "" {
-			return nil, types.ErrNoDefaultModel
+		if backendConf.DefaultModel == "" {
+			return nil, model, types.ErrNoDefaultModel
+		}
+		model = backendConf.DefaultModel
+	}
+
+	systemPrompt := opts.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = backendConf.SystemPrompt
+	}
+
+	chat = backend.Chat(model, withSystemPrompt(msgs, systemPrompt)...)
+	chat.SetInferenceParams(backendConf.Inference.Merge(opts.Inference))
+
+	return chat, model, nil
+}
+
+// withSystemPrompt returns the provided messages with the system prompt as the
+// first message, replacing any existing system messages. If the system prompt
+// is empty, the messages are returned unchanged.
+func withSystemPrompt(msgs []types.Message, prompt string) []types.Message {
+	if prompt == "" {
+		return msgs
+	}
+
+	res := make([]types.Message, 1, len(msgs)+1)
+	res[0] = types.Message{Role: "system", Content: prompt}
+
+	for _, msg := range msgs {
+		if msg.Role != "system" {
+			res = append(res, msg)
 		}
-		model = defaultModel
 	}
 
-	return backend.Chat(model, msgs...), nil
+	return res
+}
+
+// resolveBackendName returns the name of the backend to use. If name is an
+// empty string, the default backend is used, or if one is not defined, the
+// first backend in the fallback chain.
+func (aiac *Aiac) resolveBackendName(name string) (string, error) {
+	switch {
+	case name != "":
+		return name, nil
+	case aiac.Conf.DefaultBackend != "":
+		return aiac.Conf.DefaultBackend, nil
+	case len(aiac.Conf.Fallback) > 0:
+		return parseBackendRef(aiac.Conf.Fallback[0]).name, nil
+	default:
+		return name, types.ErrNoDefaultBackend
+	}
 }
 
 func (aiac *Aiac) loadBackend(ctx context.Context, name string) (
 	backend types.Backend,
-	defaultModel string,
+	backendConf BackendConfig,
 	err error,
 ) {
-	if name == "" {
-		if aiac.Conf.DefaultBackend == "" {
-			return nil, defaultModel, types.ErrNoDefaultBackend
-		}
-		name = aiac.Conf.DefaultBackend
+	name, err = aiac.resolveBackendName(name)
+	if err != nil {
+		return nil, backendConf, err
 	}
 
+	aiac.backendsMu.Lock()
+	defer aiac.backendsMu.Unlock()
+
 	// Check if we've already loaded it before
 	if backend, ok := aiac.Backends[name]; ok {
-		return backend, defaultModel, nil
+		return backend, aiac.Conf.Backends[name], nil
 	}
 
 	// We haven't, check if it's in the configuration
 	backendConf, ok := aiac.Conf.Backends[name]
 	if !ok {
-		return backend, defaultModel, types.ErrNoSuchBackend
+		return backend, backendConf, types.ErrNoSuchBackend
 	}
 
 	switch backendConf.Type {
@@ -129,7 +304,7 @@ func (aiac *Aiac) loadBackend(ctx context.Context, name string) (
 			config.WithSharedConfigProfile(backendConf.AWSProfile),
 		)
 		if err != nil {
-			return nil, defaultModel, err
+			return nil, backendConf, err
 		}
 
 		cfg.Region = backendConf.AWSRegion
@@ -139,7 +314,29 @@ func (aiac *Aiac) loadBackend(ctx context.Context, name string) (
 		backend = ollama.New(&ollama.Options{
 			URL:          backendConf.URL,
 			ExtraHeaders: backendConf.ExtraHeaders,
+			Cassette:     aiac.Cassette,
+		})
+	case BackendAnthropic:
+		backend = anthropic.New(&anthropic.Options{
+			APIKey:       backendConf.APIKey,
+			URL:          backendConf.URL,
+			APIVersion:   backendConf.APIVersion,
+			ExtraHeaders: backendConf.ExtraHeaders,
+		})
+	case BackendGemini:
+		backend = gemini.New(&gemini.Options{
+			APIKey:       backendConf.APIKey,
+			URL:          backendConf.URL,
+			APIVersion:   backendConf.APIVersion,
+			ExtraHeaders: backendConf.ExtraHeaders,
 		})
+	case BackendMock:
+		backend, err = mock.New(&mock.Options{
+			Path: backendConf.Fixtures,
+		})
+		if err != nil {
+			return nil, backendConf, err
+		}
 	default:
 		// default to openai
 		backend, err = openai.New(&openai.Options{
@@ -147,11 +344,32 @@ func (aiac *Aiac) loadBackend(ctx context.Context, name string) (
 			URL:          backendConf.URL,
 			APIVersion:   backendConf.APIVersion,
 			ExtraHeaders: backendConf.ExtraHeaders,
+			Cassette:     aiac.Cassette,
 		})
 		if err != nil {
-			return nil, defaultModel, err
+			return nil, backendConf, err
 		}
 	}
 
-	return backend, backendConf.DefaultModel, nil
+	backend = &retryBackend{
+		Backend: backend,
+		policy:  backendConf.Retry.withDefaults(),
+	}
+
+	if aiac.Backends == nil {
+		aiac.Backends = make(map[string]types.Backend)
+	}
+	aiac.Backends[name] = backend
+
+	return backend, backendConf, nil
+}
+
+// Templates returns the store of prompt templates, which includes the
+// template files in the configured templates directory, and the templates
+// declared in the configuration file.
+func (aiac *Aiac) Templates() *templates.Store {
+	return templates.New(&templates.Options{
+		Dir:    aiac.Conf.TemplatesDir,
+		Inline: aiac.Conf.Templates,
+	})
 }
@@ -0,0 +1,200 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// mockAiac returns an Aiac object whose default (and only) backend, named
+// "mock", is the provided mock backend with the provided configuration.
+func mockAiac(backend *mock.Mock, conf BackendConfig) *Aiac {
+	conf.Type = BackendMock
+
+	return &Aiac{
+		Conf: Config{
+			DefaultBackend: "mock",
+			Backends:       map[string]BackendConfig{"mock": conf},
+		},
+		Backends: map[string]types.Backend{"mock": backend},
+	}
+}
+
+func TestChatDefaultModel(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Response: "ok"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	aiac := mockAiac(backend, BackendConfig{DefaultModel: "small"})
+
+	for _, model := range []string{"", "large"} {
+		chat, err := aiac.Chat(context.Background(), "", model)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if _, err = chat.Send(context.Background(), "prompt"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	reqs := backend.Requests()
+	if reqs[0].Model != "small" || reqs[1].Model != "large" {
+		t.Errorf("expected models small and large, got %s and %s", reqs[0].Model, reqs[1].Model)
+	}
+}
+
+func TestChatNoDefaultModel(t *testing.T) {
+	backend, err := mock.New(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = mockAiac(backend, BackendConfig{}).Chat(context.Background(), "", "")
+	if !errors.Is(err, types.ErrNoDefaultModel) {
+		t.Fatalf("expected error %q, got %v", types.ErrNoDefaultModel, err)
+	}
+}
+
+func TestChatSystemPrompt(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Response: "ok"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	aiac := mockAiac(backend, BackendConfig{
+		DefaultModel: "small",
+		SystemPrompt: "be terse",
+	})
+
+	// The configured system prompt replaces the one of a loaded conversation
+	chat, err := aiac.Chat(
+		context.Background(),
+		"",
+		"",
+		types.Message{Role: "system", Content: "old"},
+		types.Message{Role: "user", Content: "hi"},
+		types.Message{Role: "assistant", Content: "hello"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = chat.Send(context.Background(), "prompt"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []types.Message{
+		{Role: "system", Content: "be terse"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "prompt"},
+	}
+	if got := backend.Requests()[0].Messages; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected messages %v, got %v", want, got)
+	}
+
+	// A system prompt provided in the options takes precedence
+	chat, err = aiac.ChatWithOptions(context.Background(), "", "", ChatOptions{
+		SystemPrompt: "be verbose",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = chat.Send(context.Background(), "prompt"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want = []types.Message{
+		{Role: "system", Content: "be verbose"},
+		{Role: "user", Content: "prompt"},
+	}
+	if got := backend.Requests()[1].Messages; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected messages %v, got %v", want, got)
+	}
+}
+
+func TestChatInferenceParams(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Response: "ok"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	temperature, topP, maxTokens := 0.5, 0.9, 100
+
+	aiac := mockAiac(backend, BackendConfig{
+		DefaultModel: "small",
+		Inference: types.InferenceParams{
+			Temperature: &temperature,
+			MaxTokens:   &maxTokens,
+		},
+	})
+
+	// Parameters provided in the options override those of the configuration
+	override := 0.1
+	chat, err := aiac.ChatWithOptions(context.Background(), "", "", ChatOptions{
+		Inference: types.InferenceParams{Temperature: &override, TopP: &topP},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = chat.Send(context.Background(), "prompt"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	params := backend.Requests()[0].Params
+	if params.Temperature == nil || *params.Temperature != override {
+		t.Errorf("expected temperature %v, got %v", override, params.Temperature)
+	}
+
+	if params.TopP == nil || *params.TopP != topP {
+		t.Errorf("expected top_p %v, got %v", topP, params.TopP)
+	}
+
+	if params.MaxTokens == nil || *params.MaxTokens != maxTokens {
+		t.Errorf("expected max tokens %d, got %v", maxTokens, params.MaxTokens)
+	}
+}
+
+func TestLoadBackendCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.yaml")
+	if err := os.WriteFile(path, []byte("responses:\n  - response: ok\n"), 0o644); err != nil {
+		t.Fatalf("failed writing fixtures: %s", err)
+	}
+
+	aiac := NewFromConf(Config{
+		DefaultBackend: "mock",
+		Backends: map[string]BackendConfig{
+			"mock": {Type: BackendMock, Fixtures: path, DefaultModel: "model"},
+		},
+	})
+
+	first, _, err := aiac.loadBackend(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	second, _, err := aiac.loadBackend(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if first != second {
+		t.Errorf("expected backend to be loaded once")
+	}
+}
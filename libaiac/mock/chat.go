@@ -0,0 +1,151 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// Conversation is a struct used to converse with the mock backend. It
+// maintains all messages sent/received, just like conversations of real
+// providers.
+type Conversation struct {
+	backend      *Mock
+	model        string
+	messages     []types.Message
+	extraHeaders map[string]string
+	params       types.InferenceParams
+}
+
+// Chat initiates a conversation with the mock backend. The name of the model
+// must be provided. Users can also supply zero or more "previous messages"
+// that may have been exchanged in the past.
+func (backend *Mock) Chat(model string, msgs ...types.Message) types.Conversation {
+	conv := &Conversation{
+		backend: backend,
+		model:   model,
+	}
+
+	if len(msgs) > 0 {
+		conv.messages = msgs
+	}
+
+	return conv
+}
+
+// Send sends the provided message to the mock backend, and returns the
+// response of the first fixture that matches it. If no fixture matches, an
+// error wrapping types.ErrNoFixture is returned.
+func (conv *Conversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	return conv.send(ctx, prompt, false, nil)
+}
+
+// SendStream is the same as Send, but streams the response line by line. The
+// provided function is called with every line of the response.
+func (conv *Conversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	return conv.send(ctx, prompt, true, fn)
+}
+
+func (conv *Conversation) send(
+	ctx context.Context,
+	prompt string,
+	stream bool,
+	fn func(string),
+) (res types.Response, err error) {
+	msg := types.Message{Role: "user", Content: prompt}
+
+	req := Request{
+		Model:    conv.model,
+		Messages: append(conv.messages[:len(conv.messages):len(conv.messages)], msg),
+		Params:   conv.params,
+		Stream:   stream,
+	}
+
+	if len(conv.extraHeaders) > 0 {
+		req.Headers = make(map[string]string, len(conv.extraHeaders))
+		for key, val := range conv.extraHeaders {
+			req.Headers[key] = val
+		}
+	}
+
+	fixture, err := conv.backend.respond(req)
+	if err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", err)
+	}
+
+	if fixture.Latency > 0 {
+		timer := time.NewTimer(fixture.Latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return res, fmt.Errorf("failed sending prompt: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	if err = fixture.err(); err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", err)
+	}
+
+	if fn != nil {
+		for _, line := range strings.SplitAfter(fixture.Response, "\n") {
+			if line != "" {
+				fn(line)
+			}
+		}
+	}
+
+	conv.messages = append(
+		req.Messages,
+		types.Message{Role: "assistant", Content: fixture.Response},
+	)
+
+	res.FullOutput = strings.TrimSpace(fixture.Response)
+	res.TokensUsed = fixture.TokensUsed
+	res.StopReason = fixture.StopReason
+	if res.StopReason == "" {
+		res.StopReason = "stop"
+	}
+
+	var ok bool
+	if res.Code, ok = types.ExtractCode(res.FullOutput); !ok {
+		res.Code = res.FullOutput
+	}
+
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res, nil
+}
+
+// Messages returns all the messages that have been exchanged between the user
+// and the assistant up to this point.
+func (conv *Conversation) Messages() []types.Message {
+	return conv.messages
+}
+
+// AddHeader adds an extra HTTP header to the conversation. Headers are not
+// sent anywhere, but are recorded with every request.
+func (conv *Conversation) AddHeader(key, val string) {
+	if conv.extraHeaders == nil {
+		conv.extraHeaders = make(map[string]string)
+	}
+	conv.extraHeaders[key] = val
+}
+
+// SetInferenceParams sets the parameters that control how the model
+// generates responses for all subsequent messages in this conversation. They
+// are recorded with every request.
+func (conv *Conversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = params
+}
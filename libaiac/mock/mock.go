@@ -0,0 +1,291 @@
+// Package mock implements a deterministic backend that replays scripted
+// responses instead of contacting an LLM provider. Responses are selected by
+// matching prompts against a list of fixtures, and can simulate errors,
+// truncation and latency. Every request the backend receives is recorded, so
+// code using libaiac can be tested without network access.
+package mock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Mock is a backend that replays scripted responses. It is safe for
+// concurrent use by multiple conversations.
+type Mock struct {
+	models   []string
+	fixtures []Fixture
+
+	mu       sync.Mutex
+	used     []int
+	requests []Request
+}
+
+// Fixture is a scripted response, along with the prompts it matches. A
+// fixture that defines neither Prompt nor Match matches all prompts.
+type Fixture struct {
+	// Prompt matches prompts that are equal to it, ignoring surrounding
+	// whitespace.
+	Prompt string `yaml:"prompt" json:"prompt"`
+
+	// Match is a regular expression that matches prompts.
+	Match string `yaml:"match" json:"match"`
+
+	// Model restricts the fixture to conversations with this model. Optional.
+	Model string `yaml:"model" json:"model"`
+
+	// Response is the text returned by the model.
+	Response string `yaml:"response" json:"response"`
+
+	// StopReason is the reason the model stopped generating output. Defaults
+	// to "stop". Use "length" to simulate a truncated response.
+	StopReason string `yaml:"stop_reason" json:"stop_reason"`
+
+	// TokensUsed is the number of tokens reported as used.
+	TokensUsed int64 `yaml:"tokens_used" json:"tokens_used"`
+
+	// Error, if set, makes the request fail with this error message instead
+	// of returning a response.
+	Error string `yaml:"error" json:"error"`
+
+	// Status, if set, makes the request fail as if the provider responded
+	// with this HTTP status code. Errors with statuses such as 429 and 503 are
+	// retryable.
+	Status int `yaml:"status" json:"status"`
+
+	// Latency is the time to wait before responding (e.g. "500ms").
+	Latency time.Duration `yaml:"latency" json:"latency"`
+
+	// Times is the number of times the fixture can be used, after which it no
+	// longer matches. Zero means unlimited. This allows simulating flaky
+	// providers, e.g. by failing once and succeeding afterwards.
+	Times int `yaml:"times" json:"times"`
+
+	re *regexp.Regexp
+}
+
+// Request is a request received by the mock backend.
+type Request struct {
+	// Model is the model of the conversation.
+	Model string
+
+	// Messages are all the messages sent, including the new prompt as the
+	// last message.
+	Messages []types.Message
+
+	// Params are the inference parameters of the conversation.
+	Params types.InferenceParams
+
+	// Headers are the extra headers added to the conversation.
+	Headers map[string]string
+
+	// Stream is true if the response was requested as a stream.
+	Stream bool
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Path is the path of a YAML (or JSON) fixtures file to load. The file
+	// contains a list of models and a list of responses, e.g.:
+	//
+	//	models: [mock-small]
+	//	responses:
+	//	  - prompt: generate terraform for an s3 bucket
+	//	    response: "```hcl\nresource \"aws_s3_bucket\" \"b\" {}\n```"
+	//	  - match: (?i)flaky
+	//	    status: 503
+	//	    times: 1
+	Path string
+
+	// Models are the models returned by ListModels. Defaults to the models
+	// referenced by fixtures, and the models of the fixtures file.
+	Models []string
+
+	// Fixtures are the scripted responses, which are matched in order,
+	// before the fixtures of the file.
+	Fixtures []Fixture
+}
+
+// New creates a new instance of the Mock struct, with the provided input
+// options. An error is returned if the fixtures file cannot be loaded, or a
+// fixture is invalid.
+func New(opts *Options) (*Mock, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	backend := &Mock{
+		models:   append([]string(nil), opts.Models...),
+		fixtures: append([]Fixture(nil), opts.Fixtures...),
+	}
+
+	if opts.Path != "" {
+		file, err := loadFixtures(opts.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		backend.models = append(backend.models, file.Models...)
+		backend.fixtures = append(backend.fixtures, file.Responses...)
+	}
+
+	for i := range backend.fixtures {
+		fixture := &backend.fixtures[i]
+		if fixture.Match == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(fixture.Match)
+		if err != nil {
+			return nil, fmt.Errorf("%w: fixture %d: %s", types.ErrInvalidFixtures, i+1, err)
+		}
+
+		fixture.re = re
+	}
+
+	backend.used = make([]int, len(backend.fixtures))
+
+	return backend, nil
+}
+
+type fixturesFile struct {
+	Models    []string  `yaml:"models"`
+	Responses []Fixture `yaml:"responses"`
+}
+
+func loadFixtures(path string) (file fixturesFile, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("failed reading fixtures: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return file, fmt.Errorf("%w: %s", types.ErrInvalidFixtures, err)
+	}
+
+	return file, nil
+}
+
+// ListModels returns the models of the backend, sorted by name.
+func (backend *Mock) ListModels(_ context.Context) (models []string, err error) {
+	seen := make(map[string]bool)
+
+	for _, model := range backend.models {
+		seen[model] = true
+	}
+
+	for _, fixture := range backend.fixtures {
+		if fixture.Model != "" {
+			seen[fixture.Model] = true
+		}
+	}
+
+	if len(seen) == 0 {
+		return models, types.ErrNoResults
+	}
+
+	for model := range seen {
+		models = append(models, model)
+	}
+
+	sort.Strings(models)
+
+	return models, nil
+}
+
+// Requests returns all the requests the backend has received so far, from all
+// conversations, in the order they were received.
+func (backend *Mock) Requests() []Request {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	return append([]Request(nil), backend.requests...)
+}
+
+// respond records a request and returns the first fixture matching it.
+func (backend *Mock) respond(req Request) (Fixture, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	backend.requests = append(backend.requests, req)
+
+	prompt := req.Messages[len(req.Messages)-1].Content
+
+	for i, fixture := range backend.fixtures {
+		if !fixture.matches(req.Model, prompt) {
+			continue
+		}
+
+		if fixture.Times > 0 && backend.used[i] >= fixture.Times {
+			continue
+		}
+
+		backend.used[i]++
+
+		return fixture, nil
+	}
+
+	return Fixture{}, fmt.Errorf("%w: %q", types.ErrNoFixture, prompt)
+}
+
+func (fixture *Fixture) matches(model, prompt string) bool {
+	if fixture.Model != "" && fixture.Model != model {
+		return false
+	}
+
+	if fixture.Prompt != "" && strings.TrimSpace(fixture.Prompt) != strings.TrimSpace(prompt) {
+		return false
+	}
+
+	if fixture.re != nil && !fixture.re.MatchString(prompt) {
+		return false
+	}
+
+	return true
+}
+
+// err returns the error simulated by the fixture, if any. Errors with a
+// status code are built the same way as those of real providers, so that
+// they are retried (or not) just the same.
+func (fixture *Fixture) err() error {
+	if fixture.Status == 0 && fixture.Error == "" {
+		return nil
+	}
+
+	var err error
+	switch {
+	case fixture.Status == 0:
+		err = fmt.Errorf("%w:  %s", types.ErrRequestFailed, fixture.Error)
+	case fixture.Error == "":
+		err = fmt.Errorf(
+			"%w %s",
+			types.ErrUnexpectedStatus,
+			http.StatusText(fixture.Status),
+		)
+	default:
+		err = fmt.Errorf(
+			"%w %s: %s",
+			types.ErrUnexpectedStatus,
+			http.StatusText(fixture.Status),
+			fixture.Error,
+		)
+	}
+
+	if types.IsRetryableStatus(fixture.Status) {
+		return &types.RetryableError{Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,249 @@
+package mock_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestSend(t *testing.T) {
+	backend, err := mock.New(&mock.Options{Fixtures: []mock.Fixture{
+		{Prompt: "exact", Response: "```hcl\nlocals {}\n```", TokensUsed: 4},
+		{Prompt: "large only", Model: "large", Response: "large"},
+		{Prompt: "long", Response: "cut", StopReason: "length"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := backend.Chat("small")
+
+	// Prompts are matched ignoring surrounding whitespace
+	res, err := conv.Send(context.Background(), "  exact\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Code != "locals {}" || res.StopReason != "stop" || res.TokensUsed != 4 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	res, err = conv.Send(context.Background(), "long")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != "cut" || res.StopReason != "length" {
+		t.Errorf("expected a truncated response, got %+v", res)
+	}
+
+	// Fixtures restricted to a model only match conversations with it
+	if _, err = conv.Send(context.Background(), "large only"); !errors.Is(err, types.ErrNoFixture) {
+		t.Errorf("expected error %q, got %v", types.ErrNoFixture, err)
+	}
+
+	res, err = backend.Chat("large").Send(context.Background(), "large only")
+	if err != nil || res.FullOutput != "large" {
+		t.Errorf("expected response from the large model, got %+v (%v)", res, err)
+	}
+
+	reqs := backend.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("expected 4 requests to be recorded, got %d", len(reqs))
+	}
+
+	if reqs[1].Model != "small" || len(reqs[1].Messages) != 3 || reqs[1].Stream {
+		t.Errorf("unexpected request %+v", reqs[1])
+	}
+
+	if got := len(conv.Messages()); got != 4 {
+		t.Errorf("expected failed requests not to be recorded, got %d messages", got)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	backend, err := mock.New(&mock.Options{Fixtures: []mock.Fixture{
+		{Match: "(?i)^flaky", Status: http.StatusServiceUnavailable, Times: 1},
+		{Match: "(?i)^flaky", Response: "recovered"},
+		{Prompt: "invalid", Error: "bad prompt"},
+		{Prompt: "forbidden", Status: http.StatusForbidden, Error: "no access"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := backend.Chat("small")
+
+	// The first attempt fails with a retryable error, the second succeeds
+	_, err = conv.Send(context.Background(), "Flaky")
+	var retryable *types.RetryableError
+	if !errors.Is(err, types.ErrUnexpectedStatus) || !errors.As(err, &retryable) {
+		t.Errorf("expected a retryable error wrapping %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+
+	res, err := conv.Send(context.Background(), "flaky")
+	if err != nil || res.FullOutput != "recovered" {
+		t.Errorf("expected the second attempt to succeed, got %+v (%v)", res, err)
+	}
+
+	_, err = conv.Send(context.Background(), "invalid")
+	if !errors.Is(err, types.ErrRequestFailed) || errors.As(err, &retryable) {
+		t.Errorf("expected a non-retryable error wrapping %q, got %v", types.ErrRequestFailed, err)
+	}
+
+	_, err = conv.Send(context.Background(), "forbidden")
+	if !errors.Is(err, types.ErrUnexpectedStatus) || errors.As(err, &retryable) {
+		t.Errorf("expected a non-retryable error wrapping %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+
+	if _, err = conv.Send(context.Background(), "unknown"); !errors.Is(err, types.ErrNoFixture) {
+		t.Errorf("expected error %q, got %v", types.ErrNoFixture, err)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	backend, err := mock.New(&mock.Options{Fixtures: []mock.Fixture{
+		{Response: "```hcl\nlocals {}\n```\n"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := backend.Chat("small", types.Message{Role: "system", Content: "be terse"})
+	conv.AddHeader("X-Test", "yes")
+
+	temperature := 0.7
+	conv.SetInferenceParams(types.InferenceParams{Temperature: &temperature})
+
+	var chunks []string
+	res, err := conv.SendStream(context.Background(), "prompt", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if want := []string{"```hcl\n", "locals {}\n", "```\n"}; !reflect.DeepEqual(chunks, want) {
+		t.Errorf("expected chunks %q, got %q", want, chunks)
+	}
+
+	if res.Code != "locals {}" {
+		t.Errorf("unexpected code %q", res.Code)
+	}
+
+	req := backend.Requests()[0]
+	if !req.Stream || req.Model != "small" || req.Headers["X-Test"] != "yes" ||
+		req.Params.Temperature == nil || *req.Params.Temperature != temperature {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	if len(req.Messages) != 2 || req.Messages[1].Content != "prompt" {
+		t.Errorf("unexpected request messages %v", req.Messages)
+	}
+
+	msgs := conv.Messages()
+	if len(msgs) != 3 || msgs[2].Content != "```hcl\nlocals {}\n```\n" {
+		t.Errorf("expected untrimmed response to be recorded, got %v", msgs)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	backend, err := mock.New(&mock.Options{Fixtures: []mock.Fixture{
+		{Response: "slow", Latency: time.Hour},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = backend.Chat("small").Send(ctx, "prompt")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "fixtures.yaml")
+	err := os.WriteFile(valid, []byte(`
+models: [mock-small]
+responses:
+  - prompt: generate terraform
+    model: mock-large
+    response: "resource {}"
+  - match: (?i)flaky
+    status: 503
+    latency: 1ms
+    times: 1
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("responses: {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       *mock.Options
+		wantModels []string
+		wantErr    error
+	}{
+		{
+			name:       "fixtures file",
+			opts:       &mock.Options{Path: valid, Models: []string{"mock-tiny"}},
+			wantModels: []string{"mock-large", "mock-small", "mock-tiny"},
+		},
+		{
+			name:    "no models",
+			opts:    nil,
+			wantErr: types.ErrNoResults,
+		},
+		{
+			name:    "invalid file",
+			opts:    &mock.Options{Path: invalid},
+			wantErr: types.ErrInvalidFixtures,
+		},
+		{
+			name:    "missing file",
+			opts:    &mock.Options{Path: filepath.Join(dir, "missing.yaml")},
+			wantErr: os.ErrNotExist,
+		},
+		{
+			name:    "invalid regular expression",
+			opts:    &mock.Options{Fixtures: []mock.Fixture{{Match: "("}}},
+			wantErr: types.ErrInvalidFixtures,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := mock.New(tt.opts)
+			if err == nil {
+				var models []string
+				models, err = backend.ListModels(context.Background())
+				if err == nil && strings.Join(models, ",") != strings.Join(tt.wantModels, ",") {
+					t.Errorf("expected models %v, got %v", tt.wantModels, models)
+				}
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
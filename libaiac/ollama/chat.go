@@ -2,10 +2,12 @@ package ollama
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/ido50/requests"
 )
 
 // Conversation is a struct used to converse with an Ollama chat model. It
@@ -15,11 +17,18 @@ type Conversation struct {
 	model        string
 	messages     []types.Message
 	extraHeaders map[string]string
+	params       types.InferenceParams
 }
 
 type chatResponse struct {
-	Message types.Message `json:"message"`
-	Done    bool          `json:"done"`
+	Message    types.Message `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+}
+
+type chatStreamChunk struct {
+	chatResponse
+	Error string `json:"error"`
 }
 
 // Chat initiates a conversation with an Ollama chat model. A conversation
@@ -49,39 +58,160 @@ func (conv *Conversation) Send(ctx context.Context, prompt string) (
 	res types.Response,
 	err error,
 ) {
-	var answer chatResponse
+	var (
+		answer     chatResponse
+		retryAfter string
+	)
+
+	err = conv.newRequest(prompt).
+		Into(&answer).
+		HeaderInto("Retry-After", &retryAfter).
+		RunContext(ctx)
+	if err != nil {
+		return res, fmt.Errorf(
+			"failed sending prompt: %w",
+			types.WithRetryAfter(err, retryAfter),
+		)
+	}
 
-	conv.messages = append(conv.messages, types.Message{
-		Role:    "user",
-		Content: prompt,
+	return conv.finish(prompt, answer.Message, answer.Done, answer.DoneReason), nil
+}
+
+// SendStream is the same as Send, but streams the response from the API,
+// which is returned as newline-delimited JSON objects. The provided function
+// is called with every chunk of text as it is received.
+func (conv *Conversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	stream, err := types.OpenStream(ctx, types.StreamRequest{
+		Client:       conv.backend.httpClient,
+		URL:          conv.backend.url + "/chat",
+		Headers:      conv.backend.headers,
+		ExtraHeaders: conv.extraHeaders,
+		Body:         conv.requestBody(prompt, true),
+		ErrorHandler: handleError,
 	})
+	if err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", err)
+	}
+	defer stream.Close()
+
+	var (
+		content    strings.Builder
+		done       bool
+		doneReason string
+	)
+
+	for stream.Scan() {
+		var chunk chatStreamChunk
+		if err = json.Unmarshal(stream.Bytes(), &chunk); err != nil {
+			return res, fmt.Errorf("failed decoding stream: %w", err)
+		}
+
+		if chunk.Error != "" {
+			return res, fmt.Errorf("%w:  %s", types.ErrRequestFailed, chunk.Error)
+		}
+
+		if delta := chunk.Message.Content; delta != "" {
+			content.WriteString(delta)
+			fn(delta)
+		}
+
+		if chunk.Done {
+			done = true
+			doneReason = chunk.DoneReason
+			break
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return res, fmt.Errorf("failed reading stream: %w", err)
+	}
 
+	return conv.finish(
+		prompt,
+		types.Message{Role: "assistant", Content: content.String()},
+		done,
+		doneReason,
+	), nil
+}
+
+// newRequest creates a chat request for the conversation, including all
+// messages exchanged so far and the new prompt.
+func (conv *Conversation) newRequest(prompt string) *requests.HTTPRequest {
 	req := conv.backend.NewRequest("POST", "/chat").
-		JSONBody(map[string]interface{}{
-			"model":    conv.model,
-			"messages": conv.messages,
-			"options": map[string]interface{}{
-				"temperature": 0.2,
-			},
-			"stream": false,
-		}).
-		Into(&answer)
+		JSONBody(conv.requestBody(prompt, false))
 
 	for key, val := range conv.extraHeaders {
 		req.Header(key, val)
 	}
 
-	err = req.RunContext(ctx)
-	if err != nil {
-		return res, fmt.Errorf("failed sending prompt: %w", err)
+	return req
+}
+
+// requestBody returns the body of a chat request for the conversation,
+// including all messages exchanged so far and the new prompt.
+func (conv *Conversation) requestBody(prompt string, stream bool) map[string]interface{} {
+	messages := append(
+		conv.messages[:len(conv.messages):len(conv.messages)],
+		types.Message{Role: "user", Content: prompt},
+	)
+
+	options := map[string]interface{}{
+		"temperature": conv.params.GetTemperature(),
+	}
+
+	if conv.params.MaxTokens != nil {
+		options["num_predict"] = *conv.params.MaxTokens
+	}
+
+	if conv.params.TopP != nil {
+		options["top_p"] = *conv.params.TopP
+	}
+
+	if len(conv.params.StopSequences) > 0 {
+		options["stop"] = conv.params.StopSequences
+	}
+
+	if conv.params.Seed != nil {
+		options["seed"] = *conv.params.Seed
 	}
 
-	conv.messages = append(conv.messages, answer.Message)
+	return map[string]interface{}{
+		"model":    conv.model,
+		"messages": messages,
+		"options":  options,
+		"stream":   stream,
+	}
+}
 
-	res.FullOutput = strings.TrimSpace(answer.Message.Content)
-	if answer.Done {
+// finish records the user's prompt and the assistant's response in the
+// conversation and creates the Response object returned to the caller. The
+// conversation is only updated once a response is received, so that failed
+// requests can be retried without duplicating the user's prompt. Newer
+// versions of Ollama return the reason the model stopped generating (e.g.
+// "stop" or "length"), which is used as the stop reason if available.
+func (conv *Conversation) finish(
+	prompt string,
+	msg types.Message,
+	done bool,
+	doneReason string,
+) (res types.Response) {
+	conv.messages = append(
+		conv.messages,
+		types.Message{Role: "user", Content: prompt},
+		msg,
+	)
+
+	res.FullOutput = strings.TrimSpace(msg.Content)
+	switch {
+	case doneReason != "":
+		res.StopReason = doneReason
+	case done:
 		res.StopReason = "done"
-	} else {
+	default:
 		res.StopReason = "truncated"
 	}
 
@@ -90,7 +220,9 @@ func (conv *Conversation) Send(ctx context.Context, prompt string) (
 		res.Code = res.FullOutput
 	}
 
-	return res, nil
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res
 }
 
 // Messages returns all the messages that have been exchanged between the user
@@ -109,3 +241,9 @@ func (conv *Conversation) AddHeader(key, val string) {
 	}
 	conv.extraHeaders[key] = val
 }
+
+// SetInferenceParams sets the parameters that control how the model
+// generates responses for all subsequent messages in this conversation.
+func (conv *Conversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = params
+}
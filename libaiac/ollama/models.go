@@ -16,12 +16,18 @@ func (backend *Ollama) ListModels(ctx context.Context) (models []string, err err
 		} `json:"models"`
 	}
 
+	var retryAfter string
+
 	err = backend.
 		NewRequest("GET", "/tags").
 		Into(&answer).
+		HeaderInto("Retry-After", &retryAfter).
 		RunContext(ctx)
 	if err != nil {
-		return models, fmt.Errorf("failed sending prompt: %w", err)
+		return models, fmt.Errorf(
+			"failed sending prompt: %w",
+			types.WithRetryAfter(err, retryAfter),
+		)
 	}
 
 	if len(answer.Models) == 0 {
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	"github.com/gofireflyio/aiac/v5/libaiac/cassette"
 	"github.com/gofireflyio/aiac/v5/libaiac/types"
 	"github.com/ido50/requests"
 )
@@ -16,6 +18,9 @@ const DefaultAPIURL = "http://localhost:11434/api"
 // Ollama is a structure used to continuously generate IaC code via Ollama
 type Ollama struct {
 	*requests.HTTPClient
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
 }
 
 // Options is a struct containing all the parameters accepted by the New
@@ -28,6 +33,11 @@ type Options struct {
 	// ExtraHeaders are extra HTTP headers to send with every request to the
 	// provider.
 	ExtraHeaders map[string]string
+
+	// Cassette, if provided, is used to record all HTTP exchanges with the
+	// API server, or to replay previously recorded exchanges without network
+	// access, depending on its mode.
+	Cassette *cassette.Cassette
 }
 
 // New creates a new instance of the Ollama struct, with the provided
@@ -41,38 +51,63 @@ func New(opts *Options) *Ollama {
 		opts.URL = DefaultAPIURL
 	}
 
-	cli := &Ollama{}
+	cli := &Ollama{
+		url:     strings.TrimSuffix(opts.URL, "/"),
+		headers: make(map[string]string),
+	}
+
+	for header, value := range opts.ExtraHeaders {
+		cli.headers[header] = value
+	}
 
 	cli.HTTPClient = requests.NewClient(opts.URL).
 		Accept("application/json").
-		ErrorHandler(func(
-			httpStatus int,
-			contentType string,
-			body io.Reader,
-		) error {
-			var res struct {
-				Error string `json:"error"`
-			}
-
-			err := json.NewDecoder(body).Decode(&res)
-			if err != nil {
-				return fmt.Errorf(
-					"%w %s",
-					types.ErrUnexpectedStatus,
-					http.StatusText(httpStatus),
-				)
-			}
-
-			return fmt.Errorf(
-				"%w:  %s",
-				types.ErrRequestFailed,
-				res.Error,
-			)
-		})
+		ErrorHandler(handleError)
 
-	for header, value := range opts.ExtraHeaders {
+	for header, value := range cli.headers {
 		cli.HTTPClient.Header(header, value)
 	}
 
+	// The same HTTP client is used for regular and streamed requests
+	cli.httpClient = &http.Client{}
+	if opts.Cassette != nil {
+		cli.httpClient = opts.Cassette.Client()
+	}
+
+	cli.HTTPClient.CustomHTTPClient(cli.httpClient)
+
 	return cli
 }
+
+// handleError creates the error returned when the Ollama API responds with an
+// unsuccessful status code.
+func handleError(
+	httpStatus int,
+	contentType string,
+	body io.Reader,
+) error {
+	var res struct {
+		Error string `json:"error"`
+	}
+
+	err := json.NewDecoder(body).Decode(&res)
+	if err != nil {
+		err = fmt.Errorf(
+			"%w %s",
+			types.ErrUnexpectedStatus,
+			http.StatusText(httpStatus),
+		)
+	} else {
+		err = fmt.Errorf(
+			"%w:  %s",
+			types.ErrRequestFailed,
+			res.Error,
+		)
+	}
+
+	if types.IsRetryableStatus(httpStatus) {
+		return &types.RetryableError{Err: err}
+	}
+
+	return err
+}
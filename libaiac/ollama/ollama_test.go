@@ -0,0 +1,257 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/ollama"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// request is a request received by the test server.
+type request struct {
+	path   string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newServer starts a test server that records every request it receives and
+// responds with the provided handler.
+func newServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *[]request) {
+	t.Helper()
+
+	var requests []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{path: r.URL.Path, header: r.Header}
+
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			t.Errorf("request body is not valid JSON: %s", err)
+		}
+
+		requests = append(requests, req)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func newBackend(url string) *ollama.Ollama {
+	return ollama.New(&ollama.Options{
+		URL:          url,
+		ExtraHeaders: map[string]string{"X-Backend": "yes"},
+	})
+}
+
+// writeLines writes the provided newline-delimited JSON objects, flushing
+// after every object so that the client receives them separately.
+func writeLines(w http.ResponseWriter, lines ...string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestSend(t *testing.T) {
+	srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"message": {"role": "assistant", "content": "`+"```hcl\\nresource {}\\n```"+`"},
+			"done": true,
+			"done_reason": "stop"
+		}`)
+	})
+
+	conv := newBackend(srv.URL).Chat("llama-test")
+	conv.AddHeader("X-Conversation", "yes")
+
+	maxTokens := 100
+	conv.SetInferenceParams(types.InferenceParams{MaxTokens: &maxTokens})
+
+	res, err := conv.Send(context.Background(), "generate terraform")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	if req.path != "/chat" || req.body["model"] != "llama-test" || req.body["stream"] != false {
+		t.Errorf("unexpected request to %s: %v", req.path, req.body)
+	}
+
+	if req.header.Get("X-Backend") != "yes" || req.header.Get("X-Conversation") != "yes" {
+		t.Errorf("expected extra headers, got %v", req.header)
+	}
+
+	options, _ := req.body["options"].(map[string]interface{})
+	if options["num_predict"] != float64(100) {
+		t.Errorf("expected num_predict 100, got %v", req.body["options"])
+	}
+
+	if res.Code != "resource {}" || res.StopReason != "stop" {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if got := len(conv.Messages()); got != 2 {
+		t.Errorf("expected 2 messages in conversation, got %d", got)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	tests := []struct {
+		name           string
+		last           string
+		wantStopReason string
+		wantTruncated  bool
+	}{
+		{
+			name:           "done with reason",
+			last:           `{"message": {"content": "{}"}, "done": true, "done_reason": "length"}`,
+			wantStopReason: "length",
+			wantTruncated:  true,
+		},
+		{
+			name:           "done without reason",
+			last:           `{"message": {"content": "{}"}, "done": true}`,
+			wantStopReason: "done",
+		},
+		{
+			name:           "stream ended early",
+			last:           `{"message": {"content": "{}"}, "done": false}`,
+			wantStopReason: "truncated",
+			wantTruncated:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				writeLines(w,
+					`{"message": {"role": "assistant", "content": "resource "}, "done": false}`,
+					tt.last,
+				)
+			})
+
+			var chunks []string
+			res, err := newBackend(srv.URL).Chat("llama-test").SendStream(
+				context.Background(),
+				"generate terraform",
+				func(chunk string) { chunks = append(chunks, chunk) },
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if (*requests)[0].body["stream"] != true {
+				t.Errorf("expected a streaming request, got %v", (*requests)[0].body)
+			}
+
+			if strings.Join(chunks, "|") != "resource |{}" {
+				t.Errorf("unexpected chunks %q", chunks)
+			}
+
+			if res.FullOutput != "resource {}" || res.StopReason != tt.wantStopReason {
+				t.Errorf("unexpected response %+v", res)
+			}
+
+			if got := types.IsTruncated(res.StopReason); got != tt.wantTruncated {
+				t.Errorf("expected truncated to be %t, got %t", tt.wantTruncated, got)
+			}
+		})
+	}
+}
+
+func TestSendStreamError(t *testing.T) {
+	srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeLines(w,
+			`{"message": {"content": "resource "}, "done": false}`,
+			`{"error": "model runner has unexpectedly stopped"}`,
+		)
+	})
+
+	conv := newBackend(srv.URL).Chat("llama-test")
+
+	_, err := conv.SendStream(context.Background(), "prompt", func(string) {})
+	if !errors.Is(err, types.ErrRequestFailed) || !strings.Contains(err.Error(), "unexpectedly stopped") {
+		t.Fatalf("expected error wrapping %q, got %v", types.ErrRequestFailed, err)
+	}
+
+	if got := len(conv.Messages()); got != 0 {
+		t.Errorf("expected failed request not to be recorded, got %d messages", got)
+	}
+}
+
+func TestSendStreamInvalidJSON(t *testing.T) {
+	srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeLines(w, `{"message": {"content": "resource "}, "done": false}`, `not json`)
+	})
+
+	_, err := newBackend(srv.URL).Chat("llama-test").
+		SendStream(context.Background(), "prompt", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "failed decoding stream") {
+		t.Fatalf("expected a decoding error, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantRetryable bool
+		wantErr       error
+	}{
+		{
+			name:    "model not found",
+			status:  http.StatusNotFound,
+			body:    `{"error": "model 'llama-test' not found"}`,
+			wantErr: types.ErrRequestFailed,
+		},
+		{
+			name:          "unavailable without body",
+			status:        http.StatusServiceUnavailable,
+			wantRetryable: true,
+			wantErr:       types.ErrUnexpectedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%t", tt.name, stream), func(t *testing.T) {
+				srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				})
+
+				conv := newBackend(srv.URL).Chat("llama-test")
+
+				var err error
+				if stream {
+					_, err = conv.SendStream(context.Background(), "prompt", func(string) {})
+				} else {
+					_, err = conv.Send(context.Background(), "prompt")
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error wrapping %q, got %v", tt.wantErr, err)
+				}
+
+				var retryable *types.RetryableError
+				if got := errors.As(err, &retryable); got != tt.wantRetryable {
+					t.Errorf("expected retryable to be %t, got %t", tt.wantRetryable, got)
+				}
+			})
+		}
+	}
+}
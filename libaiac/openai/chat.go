@@ -1,11 +1,14 @@
 package openai
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/ido50/requests"
 )
 
 // Conversation is a struct used to converse with an OpenAI chat model. It
@@ -16,6 +19,7 @@ type Conversation struct {
 	model        string
 	messages     []types.Message
 	extraHeaders map[string]string
+	params       types.InferenceParams
 }
 
 type chatResponse struct {
@@ -29,6 +33,20 @@ type chatResponse struct {
 	} `json:"usage"`
 }
 
+type chatStreamChunk struct {
+	Choices []struct {
+		Delta        types.Message `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		TotalTokens int64 `json:"total_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
 // Chat initiates a conversation with an OpenAI chat model. A conversation
 // maintains context, allowing to send further instructions to modify the output
 // from previous requests, just like using the ChatGPT website. The name of the
@@ -56,53 +74,213 @@ func (conv *Conversation) Send(ctx context.Context, prompt string) (
 	res types.Response,
 	err error,
 ) {
-	var answer chatResponse
+	var (
+		answer     chatResponse
+		retryAfter string
+	)
+
+	err = conv.newRequest(prompt).
+		Into(&answer).
+		HeaderInto("Retry-After", &retryAfter).
+		RunContext(ctx)
+	if err != nil {
+		return res, fmt.Errorf(
+			"failed sending prompt: %w",
+			types.WithRetryAfter(err, retryAfter),
+		)
+	}
+
+	if len(answer.Choices) == 0 {
+		return res, types.ErrNoResults
+	}
+
+	return conv.finish(
+		prompt,
+		answer.Choices[0].Message,
+		answer.Usage.TotalTokens,
+		answer.Choices[0].FinishReason,
+	), nil
+}
 
-	conv.messages = append(conv.messages, types.Message{
-		Role:    "user",
-		Content: prompt,
+// SendStream is the same as Send, but streams the response via server-sent
+// events. The provided function is called with every chunk of text as it
+// is received from the API.
+func (conv *Conversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	stream, err := types.OpenStream(ctx, types.StreamRequest{
+		Client:       conv.backend.httpClient,
+		URL:          conv.backend.url + conv.requestPath(),
+		Headers:      conv.backend.headers,
+		ExtraHeaders: conv.extraHeaders,
+		Body:         conv.requestBody(prompt, true),
+		ErrorHandler: handleError,
 	})
+	if err != nil {
+		return res, fmt.Errorf("failed sending prompt: %w", err)
+	}
+	defer stream.Close()
 
-	var apiVersion string
-	if len(conv.backend.apiVersion) > 0 {
-		apiVersion = fmt.Sprintf("?api-version=%s", conv.backend.apiVersion)
+	var (
+		content    strings.Builder
+		tokensUsed int64
+		stopReason string
+	)
+
+	for stream.Scan() {
+		line := stream.Bytes()
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+
+		data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+		if bytes.Equal(data, []byte("[DONE]")) {
+			break
+		}
+
+		var chunk chatStreamChunk
+		if err = json.Unmarshal(data, &chunk); err != nil {
+			return res, fmt.Errorf("failed decoding stream: %w", err)
+		}
+
+		if chunk.Error.Message != "" {
+			return res, fmt.Errorf(
+				"%w: [%s]: %s",
+				types.ErrRequestFailed,
+				chunk.Error.Type,
+				chunk.Error.Message,
+			)
+		}
+
+		if chunk.Usage != nil {
+			tokensUsed = chunk.Usage.TotalTokens
+		}
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			content.WriteString(delta)
+			fn(delta)
+		}
+
+		if chunk.Choices[0].FinishReason != "" {
+			stopReason = chunk.Choices[0].FinishReason
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return res, fmt.Errorf("failed reading stream: %w", err)
 	}
 
+	if content.Len() == 0 {
+		return res, types.ErrNoResults
+	}
+
+	return conv.finish(
+		prompt,
+		types.Message{Role: "assistant", Content: content.String()},
+		tokensUsed,
+		stopReason,
+	), nil
+}
+
+// newRequest creates a chat completion request for the conversation,
+// including all messages exchanged so far and the new prompt.
+func (conv *Conversation) newRequest(prompt string) *requests.HTTPRequest {
 	req := conv.backend.
-		NewRequest("POST", fmt.Sprintf("/chat/completions%s", apiVersion)).
-		JSONBody(map[string]interface{}{
-			"model":       conv.model,
-			"messages":    conv.messages,
-			"temperature": 0.2,
-		}).
-		Into(&answer)
+		NewRequest("POST", conv.requestPath()).
+		JSONBody(conv.requestBody(prompt, false))
 
 	for key, val := range conv.extraHeaders {
 		req.Header(key, val)
 	}
 
-	err = req.RunContext(ctx)
-	if err != nil {
-		return res, fmt.Errorf("failed sending prompt: %w", err)
+	return req
+}
+
+// requestPath returns the path of the chat completions endpoint, relative to
+// the backend's URL.
+func (conv *Conversation) requestPath() string {
+	if len(conv.backend.apiVersion) > 0 {
+		return fmt.Sprintf("/chat/completions?api-version=%s", conv.backend.apiVersion)
 	}
 
-	if len(answer.Choices) == 0 {
-		return res, types.ErrNoResults
+	return "/chat/completions"
+}
+
+// requestBody returns the body of a chat completion request for the
+// conversation, including all messages exchanged so far and the new prompt.
+func (conv *Conversation) requestBody(prompt string, stream bool) map[string]interface{} {
+	messages := append(
+		conv.messages[:len(conv.messages):len(conv.messages)],
+		types.Message{Role: "user", Content: prompt},
+	)
+
+	body := map[string]interface{}{
+		"model":       conv.model,
+		"messages":    messages,
+		"temperature": conv.params.GetTemperature(),
 	}
 
-	conv.messages = append(conv.messages, answer.Choices[0].Message)
+	if conv.params.MaxTokens != nil {
+		body["max_tokens"] = *conv.params.MaxTokens
+	}
+
+	if conv.params.TopP != nil {
+		body["top_p"] = *conv.params.TopP
+	}
+
+	if len(conv.params.StopSequences) > 0 {
+		body["stop"] = conv.params.StopSequences
+	}
+
+	if conv.params.Seed != nil {
+		body["seed"] = *conv.params.Seed
+	}
 
-	res.FullOutput = strings.TrimSpace(answer.Choices[0].Message.Content)
+	if stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]interface{}{
+			"include_usage": true,
+		}
+	}
+
+	return body
+}
+
+// finish records the user's prompt and the assistant's response in the
+// conversation and creates the Response object returned to the caller. The
+// conversation is only updated once a response is received, so that failed
+// requests can be retried without duplicating the user's prompt.
+func (conv *Conversation) finish(
+	prompt string,
+	msg types.Message,
+	tokensUsed int64,
+	stopReason string,
+) (res types.Response) {
+	conv.messages = append(
+		conv.messages,
+		types.Message{Role: "user", Content: prompt},
+		msg,
+	)
+
+	res.FullOutput = strings.TrimSpace(msg.Content)
 	res.APIKeyUsed = conv.backend.apiKey
-	res.TokensUsed = answer.Usage.TotalTokens
-	res.StopReason = answer.Choices[0].FinishReason
+	res.TokensUsed = tokensUsed
+	res.StopReason = stopReason
 
 	var ok bool
 	if res.Code, ok = types.ExtractCode(res.FullOutput); !ok {
 		res.Code = res.FullOutput
 	}
 
-	return res, nil
+	res.Files = types.ExtractFiles(res.FullOutput)
+
+	return res
 }
 
 // Messages returns all the messages that have been exchanged between the user
@@ -121,3 +299,9 @@ func (conv *Conversation) AddHeader(key, val string) {
 	}
 	conv.extraHeaders[key] = val
 }
+
+// SetInferenceParams sets the parameters that control how the model
+// generates responses for all subsequent messages in this conversation.
+func (conv *Conversation) SetInferenceParams(params types.InferenceParams) {
+	conv.params = params
+}
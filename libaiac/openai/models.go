@@ -19,12 +19,18 @@ func (backend *OpenAI) ListModels(ctx context.Context) (
 		} `json:"data"`
 	}
 
+	var retryAfter string
+
 	err = backend.
 		NewRequest("GET", "/models").
 		Into(&answer).
+		HeaderInto("Retry-After", &retryAfter).
 		RunContext(ctx)
 	if err != nil {
-		return models, fmt.Errorf("failed sending prompt: %w", err)
+		return models, fmt.Errorf(
+			"failed sending prompt: %w",
+			types.WithRetryAfter(err, retryAfter),
+		)
 	}
 
 	if len(answer.Data) == 0 {
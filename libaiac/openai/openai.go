@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gofireflyio/aiac/v5/libaiac/cassette"
 	"github.com/gofireflyio/aiac/v5/libaiac/types"
 	"github.com/ido50/requests"
 )
@@ -17,9 +18,12 @@ const OpenAIBackend = "https://api.openai.com/v1"
 // OpenAI is a structure used to continuously generate IaC code via OpenAPI
 type OpenAI struct {
 	*requests.HTTPClient
+	url        string
+	headers    map[string]string
 	apiKey     string
 	apiVersion string
 	authHeader string
+	httpClient *http.Client
 }
 
 // Options is a struct containing all the parameters accepted by the New
@@ -44,6 +48,12 @@ type Options struct {
 	// ExtraHeaders are extra HTTP headers to send with every request to the
 	// provider.
 	ExtraHeaders map[string]string
+
+	// Cassette, if provided, is used to record all HTTP exchanges with the
+	// provider, or to replay previously recorded exchanges without network
+	// access, depending on its mode. The API key is redacted from recorded
+	// exchanges.
+	Cassette *cassette.Cassette
 }
 
 // New creates a new instance of the OpenAI struct, with the provided input
@@ -58,50 +68,14 @@ func New(opts *Options) (*OpenAI, error) {
 	}
 
 	backend := &OpenAI{
+		url:        strings.TrimSuffix(opts.URL, "/"),
+		headers:    make(map[string]string),
 		apiKey:     opts.ApiKey,
 		apiVersion: opts.APIVersion,
 
 		HTTPClient: requests.NewClient(opts.URL).
 			Accept("application/json").
-			ErrorHandler(func(
-				httpStatus int,
-				contentType string,
-				body io.Reader,
-			) error {
-				var res struct {
-					Error struct {
-						Message string `json:"message"`
-						Type    string `json:"type"`
-					} `json:"error"`
-					Message string `json:"message"`
-					Status  string `json:"status"`
-				}
-
-				err := json.NewDecoder(body).Decode(&res)
-				if err == nil {
-					if res.Error.Type != "" {
-						return fmt.Errorf(
-							"%w: [%s]: %s",
-							types.ErrRequestFailed,
-							res.Error.Type,
-							res.Error.Message,
-						)
-					} else if res.Message != "" {
-						return fmt.Errorf(
-							"%w: [%s]: %s",
-							types.ErrRequestFailed,
-							res.Status,
-							res.Message,
-						)
-					}
-				}
-
-				return fmt.Errorf(
-					"%w %s",
-					types.ErrUnexpectedStatus,
-					http.StatusText(httpStatus),
-				)
-			}),
+			ErrorHandler(handleError),
 	}
 
 	if opts.ApiKey != "" {
@@ -135,12 +109,72 @@ func New(opts *Options) (*OpenAI, error) {
 			authHeaderVal = backend.apiKey
 		}
 
-		backend.HTTPClient.Header(authHeaderKey, authHeaderVal)
+		backend.headers[authHeaderKey] = authHeaderVal
 	}
 
 	for header, value := range opts.ExtraHeaders {
+		backend.headers[header] = value
+	}
+
+	for header, value := range backend.headers {
 		backend.HTTPClient.Header(header, value)
 	}
 
+	// The same HTTP client is used for regular and streamed requests
+	backend.httpClient = &http.Client{}
+	if opts.Cassette != nil {
+		opts.Cassette.AddSecret(backend.apiKey)
+		backend.httpClient = opts.Cassette.Client()
+	}
+
+	backend.HTTPClient.CustomHTTPClient(backend.httpClient)
+
 	return backend, nil
 }
+
+// handleError creates the error returned when the OpenAI API responds with an
+// unsuccessful status code.
+func handleError(
+	httpStatus int,
+	contentType string,
+	body io.Reader,
+) error {
+	var res struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	}
+
+	err := json.NewDecoder(body).Decode(&res)
+	switch {
+	case err == nil && res.Error.Type != "":
+		err = fmt.Errorf(
+			"%w: [%s]: %s",
+			types.ErrRequestFailed,
+			res.Error.Type,
+			res.Error.Message,
+		)
+	case err == nil && res.Message != "":
+		err = fmt.Errorf(
+			"%w: [%s]: %s",
+			types.ErrRequestFailed,
+			res.Status,
+			res.Message,
+		)
+	default:
+		err = fmt.Errorf(
+			"%w %s",
+			types.ErrUnexpectedStatus,
+			http.StatusText(httpStatus),
+		)
+	}
+
+	if types.IsRetryableStatus(httpStatus) {
+		return &types.RetryableError{Err: err}
+	}
+
+	return err
+}
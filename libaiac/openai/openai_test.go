@@ -0,0 +1,295 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/openai"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// request is a request received by the test server.
+type request struct {
+	path   string
+	query  string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newServer starts a test server that records every request it receives and
+// responds with the provided handler.
+func newServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *[]request) {
+	t.Helper()
+
+	var requests []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{path: r.URL.Path, query: r.URL.RawQuery, header: r.Header}
+
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &req.body); err != nil {
+			t.Errorf("request body is not valid JSON: %s", err)
+		}
+
+		requests = append(requests, req)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func newBackend(t *testing.T, url string) *openai.OpenAI {
+	t.Helper()
+
+	backend, err := openai.New(&openai.Options{
+		ApiKey:       "sk-test",
+		URL:          url,
+		ExtraHeaders: map[string]string{"X-Backend": "yes"},
+	})
+	if err != nil {
+		t.Fatalf("failed creating backend: %s", err)
+	}
+
+	return backend
+}
+
+// writeEvents writes the provided server-sent events, flushing after every
+// event so that the client receives them separately.
+func writeEvents(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+
+	for _, event := range events {
+		fmt.Fprintf(w, "data: %s\n\n", event)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestSend(t *testing.T) {
+	srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"choices": [{
+				"index": 0,
+				"message": {"role": "assistant", "content": "`+"```hcl\\nresource {}\\n```"+`"},
+				"finish_reason": "stop"
+			}],
+			"usage": {"total_tokens": 15}
+		}`)
+	})
+
+	conv := newBackend(t, srv.URL).Chat("gpt-test")
+	conv.AddHeader("X-Conversation", "yes")
+
+	res, err := conv.Send(context.Background(), "generate terraform")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	if req.path != "/chat/completions" || req.body["model"] != "gpt-test" {
+		t.Errorf("unexpected request to %s: %v", req.path, req.body)
+	}
+
+	for header, want := range map[string]string{
+		"Authorization":  "Bearer sk-test",
+		"X-Backend":      "yes",
+		"X-Conversation": "yes",
+	} {
+		if got := req.header.Get(header); got != want {
+			t.Errorf("expected header %s to be %q, got %q", header, want, got)
+		}
+	}
+
+	if res.Code != "resource {}" || res.TokensUsed != 15 || res.StopReason != "stop" {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if got := len(conv.Messages()); got != 2 {
+		t.Errorf("expected 2 messages in conversation, got %d", got)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w,
+			`{"choices": [{"delta": {"role": "assistant"}}]}`,
+			`{"choices": [{"delta": {"content": "resource "}}]}`,
+			`{"choices": [{"delta": {"content": "{}"}, "finish_reason": "length"}]}`,
+			`{"choices": [], "usage": {"total_tokens": 12}}`,
+			`[DONE]`,
+		)
+	})
+
+	conv := newBackend(t, srv.URL).Chat("gpt-test")
+
+	var chunks []string
+	res, err := conv.SendStream(context.Background(), "generate terraform", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	if req.body["stream"] != true || req.header.Get("Authorization") != "Bearer sk-test" {
+		t.Errorf("expected an authorized streaming request, got %v", req.body)
+	}
+
+	options, _ := req.body["stream_options"].(map[string]interface{})
+	if options["include_usage"] != true {
+		t.Errorf("expected usage to be requested, got %v", req.body["stream_options"])
+	}
+
+	if strings.Join(chunks, "|") != "resource |{}" {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+
+	if res.FullOutput != "resource {}" || res.TokensUsed != 12 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	if !types.IsTruncated(res.StopReason) {
+		t.Errorf("expected response to be truncated, got stop reason %q", res.StopReason)
+	}
+
+	if got := len(conv.Messages()); got != 2 {
+		t.Errorf("expected 2 messages in conversation, got %d", got)
+	}
+}
+
+func TestSendStreamAPIVersion(t *testing.T) {
+	srv, requests := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, `{"choices": [{"delta": {"content": "ok"}, "finish_reason": "stop"}]}`, `[DONE]`)
+	})
+
+	backend, err := openai.New(&openai.Options{
+		ApiKey:     "azure-key",
+		URL:        srv.URL,
+		APIVersion: "2024-02-01",
+		AuthHeader: "api-key",
+	})
+	if err != nil {
+		t.Fatalf("failed creating backend: %s", err)
+	}
+
+	if _, err = backend.Chat("gpt-test").SendStream(context.Background(), "prompt", func(string) {}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	req := (*requests)[0]
+	if req.query != "api-version=2024-02-01" || req.header.Get("Api-Key") != "azure-key" {
+		t.Errorf("unexpected request with query %q and headers %v", req.query, req.header)
+	}
+}
+
+func TestSendStreamError(t *testing.T) {
+	srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w,
+			`{"choices": [{"delta": {"content": "resource "}}]}`,
+			`{"error": {"type": "server_error", "message": "model overloaded"}}`,
+		)
+	})
+
+	conv := newBackend(t, srv.URL).Chat("gpt-test")
+
+	_, err := conv.SendStream(context.Background(), "prompt", func(string) {})
+	if !errors.Is(err, types.ErrRequestFailed) || !strings.Contains(err.Error(), "model overloaded") {
+		t.Fatalf("expected error wrapping %q, got %v", types.ErrRequestFailed, err)
+	}
+
+	if got := len(conv.Messages()); got != 0 {
+		t.Errorf("expected failed request not to be recorded, got %d messages", got)
+	}
+}
+
+func TestSendStreamEmpty(t *testing.T) {
+	srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, `[DONE]`)
+	})
+
+	_, err := newBackend(t, srv.URL).Chat("gpt-test").
+		SendStream(context.Background(), "prompt", func(string) {})
+	if !errors.Is(err, types.ErrNoResults) {
+		t.Fatalf("expected error %q, got %v", types.ErrNoResults, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		retryAfter     string
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+		wantErr        error
+	}{
+		{
+			name:           "rate limited",
+			status:         http.StatusTooManyRequests,
+			body:           `{"error": {"type": "rate_limit_exceeded", "message": "slow down"}}`,
+			retryAfter:     "4",
+			wantRetryable:  true,
+			wantRetryAfter: 4 * time.Second,
+			wantErr:        types.ErrRequestFailed,
+		},
+		{
+			name:          "bad gateway without body",
+			status:        http.StatusBadGateway,
+			wantRetryable: true,
+			wantErr:       types.ErrUnexpectedStatus,
+		},
+		{
+			name:    "invalid request",
+			status:  http.StatusBadRequest,
+			body:    `{"error": {"type": "invalid_request_error", "message": "bad"}}`,
+			wantErr: types.ErrRequestFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/stream=%t", tt.name, stream), func(t *testing.T) {
+				srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					fmt.Fprint(w, tt.body)
+				})
+
+				conv := newBackend(t, srv.URL).Chat("gpt-test")
+
+				var err error
+				if stream {
+					_, err = conv.SendStream(context.Background(), "prompt", func(string) {})
+				} else {
+					_, err = conv.Send(context.Background(), "prompt")
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error wrapping %q, got %v", tt.wantErr, err)
+				}
+
+				var retryable *types.RetryableError
+				if got := errors.As(err, &retryable); got != tt.wantRetryable {
+					t.Fatalf("expected retryable to be %t, got %t", tt.wantRetryable, got)
+				}
+
+				if retryable != nil && retryable.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("expected retry after %s, got %s", tt.wantRetryAfter, retryable.RetryAfter)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package libaiac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+// RepairAttempt records a single round of a repair loop: the response received
+// from the model, and the diagnostics found when validating it.
+type RepairAttempt struct {
+	// Response is the response received from the model.
+	Response types.Response
+
+	// Diagnostics are the problems found when validating the response.
+	Diagnostics []validation.Diagnostic
+}
+
+// RepairError is returned when responses still fail validation after the
+// maximum number of repair rounds. It wraps types.ErrValidationFailed, and
+// holds the history of all attempts.
+type RepairError struct {
+	// Attempts are all the attempts made, in order. The first attempt is the
+	// response to the original prompt.
+	Attempts []RepairAttempt
+}
+
+// Error returns the error message.
+func (err *RepairError) Error() string {
+	last := err.Attempts[len(err.Attempts)-1]
+	return fmt.Sprintf(
+		"%s after %d attempt(s), %d problem(s) remaining",
+		types.ErrValidationFailed, len(err.Attempts), len(last.Diagnostics),
+	)
+}
+
+// Unwrap returns types.ErrValidationFailed.
+func (err *RepairError) Unwrap() error {
+	return types.ErrValidationFailed
+}
+
+// repairingConversation wraps a Conversation, validating every response and
+// automatically asking the model to fix the problems found, up to a maximum
+// number of rounds. Only diagnostics of error severity trigger a repair.
+type repairingConversation struct {
+	types.Conversation
+	validator validation.Validator
+	maxRounds int
+	onRepair  func(RepairAttempt)
+}
+
+// Send sends the provided message to the model, repairing the response as
+// necessary.
+func (conv *repairingConversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	return conv.send(ctx, prompt, conv.Conversation.Send)
+}
+
+// SendStream is the same as Send, but streams the response. Responses to
+// repair requests are streamed as well.
+func (conv *repairingConversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	return conv.send(ctx, prompt, func(ctx context.Context, prompt string) (
+		types.Response,
+		error,
+	) {
+		return conv.Conversation.SendStream(ctx, prompt, fn)
+	})
+}
+
+func (conv *repairingConversation) send(
+	ctx context.Context,
+	prompt string,
+	send func(context.Context, string) (types.Response, error),
+) (res types.Response, err error) {
+	res, err = send(ctx, prompt)
+	if err != nil {
+		return res, err
+	}
+
+	var attempts []RepairAttempt
+
+	for round := 1; ; round++ {
+		attempt := RepairAttempt{
+			Response:    res,
+			Diagnostics: conv.validator.Validate(res),
+		}
+		attempts = append(attempts, attempt)
+
+		if !validation.HasErrors(attempt.Diagnostics) {
+			return res, nil
+		}
+
+		if round > conv.maxRounds {
+			return res, &RepairError{Attempts: attempts}
+		}
+
+		if conv.onRepair != nil {
+			conv.onRepair(attempt)
+		}
+
+		tokensUsed := res.TokensUsed
+
+		res, err = send(ctx, validation.FixPrompt(attempt.Diagnostics))
+		if err != nil {
+			return res, fmt.Errorf(
+				"failed repairing response (round %d): %w",
+				round, err,
+			)
+		}
+
+		res.TokensUsed += tokensUsed
+		res.Repairs = round
+	}
+}
+
+// FormatRepairHistory returns a human-readable description of the attempts
+// made in a repair loop, listing the problems found in each.
+func FormatRepairHistory(attempts []RepairAttempt) string {
+	var history strings.Builder
+
+	for i, attempt := range attempts {
+		fmt.Fprintf(
+			&history,
+			"Attempt %d: %d problem(s)\n",
+			i+1, len(attempt.Diagnostics),
+		)
+
+		for _, diag := range attempt.Diagnostics {
+			fmt.Fprintf(&history, "  %s\n", diag)
+		}
+	}
+
+	return history.String()
+}
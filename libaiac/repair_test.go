@@ -0,0 +1,256 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+const (
+	invalidHCL = "```hcl\nresource \"aws_s3_bucket\" \"b\" {\n  bucket = \n}\n```"
+	validHCL   = "```hcl\nresource \"aws_s3_bucket\" \"b\" {\n  bucket = \"b\"\n}\n```"
+
+	// fixPattern matches the prompts sent by validation.FixPrompt.
+	fixPattern = "^The code you generated has the following problems"
+)
+
+func TestRepair(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Prompt: "prompt", Response: invalidHCL, TokensUsed: 5},
+			{Match: fixPattern, Response: invalidHCL, TokensUsed: 6, Times: 1},
+			{Match: fixPattern, Response: validHCL, TokensUsed: 7},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var attempts []RepairAttempt
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{
+			MaxRepairs: 2,
+			OnRepair: func(attempt RepairAttempt) {
+				attempts = append(attempts, attempt)
+			},
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != validHCL {
+		t.Errorf("expected output %q, got %q", validHCL, res.FullOutput)
+	}
+
+	if res.Repairs != 2 || res.TokensUsed != 18 {
+		t.Errorf("expected 2 repairs and 18 tokens, got %d and %d", res.Repairs, res.TokensUsed)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 repair rounds, got %d", len(attempts))
+	}
+
+	for _, attempt := range attempts {
+		if attempt.Response.FullOutput != invalidHCL || !validation.HasErrors(attempt.Diagnostics) {
+			t.Errorf("expected repair of invalid response, got %+v", attempt)
+		}
+	}
+
+	if got := len(backend.Requests()); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestRepairStream(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Prompt: "prompt", Response: invalidHCL},
+			{Match: fixPattern, Response: validHCL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxRepairs: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.SendStream(context.Background(), "prompt", func(string) {})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != validHCL || res.Repairs != 1 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	for i, req := range backend.Requests() {
+		if !req.Stream {
+			t.Errorf("expected request %d to be streamed", i)
+		}
+	}
+}
+
+func TestRepairNotNeeded(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Response: validHCL}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxRepairs: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.Repairs != 0 {
+		t.Errorf("expected no repairs, got %d", res.Repairs)
+	}
+
+	if got := len(backend.Requests()); got != 1 {
+		t.Errorf("expected 1 request, got %d", got)
+	}
+}
+
+func TestRepairRoundsExhausted(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Response: invalidHCL, TokensUsed: 5}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxRepairs: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if !errors.Is(err, types.ErrValidationFailed) {
+		t.Fatalf("expected error %q, got %v", types.ErrValidationFailed, err)
+	}
+
+	var repairErr *RepairError
+	if !errors.As(err, &repairErr) || len(repairErr.Attempts) != 3 {
+		t.Fatalf("expected a repair error with 3 attempts, got %v", err)
+	}
+
+	// The last response is returned along with the error
+	if res.FullOutput != invalidHCL || res.TokensUsed != 15 {
+		t.Errorf("unexpected response %+v", res)
+	}
+}
+
+func TestRepairFails(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Prompt: "prompt", Response: invalidHCL},
+			{Match: fixPattern, Status: http.StatusBadRequest},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{MaxRepairs: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	_, err = chat.Send(context.Background(), "prompt")
+	if !errors.Is(err, types.ErrUnexpectedStatus) {
+		t.Fatalf("expected error %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+}
+
+func TestRepairCustomValidator(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Prompt: "prompt", Response: "TODO"},
+			{Match: fixPattern, Response: "done"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	validator := validation.ValidatorFunc(func(res types.Response) []validation.Diagnostic {
+		if strings.Contains(res.FullOutput, "TODO") {
+			return []validation.Diagnostic{{
+				File:     "output",
+				Severity: validation.SeverityError,
+				Message:  "unfinished output",
+				Rule:     "todo",
+			}}
+		}
+		return nil
+	})
+
+	chat, err := mockAiac(backend, BackendConfig{DefaultModel: "model"}).
+		ChatWithOptions(context.Background(), "", "", ChatOptions{
+			MaxRepairs: 1,
+			Validator:  validator,
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res, err := chat.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != "done" || res.Repairs != 1 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	msgs := backend.Requests()[1].Messages
+	if prompt := msgs[len(msgs)-1].Content; !strings.Contains(prompt, "output: error: unfinished output [todo]") {
+		t.Errorf("expected fix prompt to list problems, got %q", prompt)
+	}
+}
+
+func TestFormatRepairHistory(t *testing.T) {
+	attempts := []RepairAttempt{
+		{Diagnostics: []validation.Diagnostic{{
+			File:     "main.tf",
+			Line:     2,
+			Severity: validation.SeverityError,
+			Message:  "bad",
+			Rule:     "hcl-syntax",
+		}}},
+		{},
+	}
+
+	want := "Attempt 1: 1 problem(s)\n" +
+		"  main.tf:2: error: bad [hcl-syntax]\n" +
+		"Attempt 2: 0 problem(s)\n"
+
+	if got := FormatRepairHistory(attempts); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,357 @@
+// Package report generates machine-readable reports of the problems found in
+// code generated by LLM providers, in JSON or SARIF format, e.g. for
+// consumption by CI pipelines and code scanning dashboards.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/security"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+// Severity is the severity of a finding. The supported values match SARIF's
+// result levels.
+type Severity string
+
+const (
+	// SeverityError is used for problems that must be fixed.
+	SeverityError Severity = "error"
+
+	// SeverityWarning is used for problems that should be reviewed.
+	SeverityWarning Severity = "warning"
+
+	// SeverityNote is used for minor problems.
+	SeverityNote Severity = "note"
+)
+
+// Built-in checks performed on every response.
+const (
+	// RuleNoCodeBlock is reported when no code block could be extracted from
+	// the response.
+	RuleNoCodeBlock = "no-code-block"
+
+	// RuleResponseTruncated is reported when the response was cut off before
+	// it was complete, e.g. due to the token limit.
+	RuleResponseTruncated = "response-truncated"
+)
+
+// Finding is a single problem found in a response.
+type Finding struct {
+	// RuleID identifies the check that produced the finding, e.g.
+	// "no-code-block", "hcl-syntax" or "public-bucket".
+	RuleID string `json:"rule_id"`
+
+	// Severity is the severity of the finding.
+	Severity Severity `json:"severity"`
+
+	// SecuritySeverity is the severity of findings produced by security
+	// checks, e.g. "high". Empty for other findings.
+	SecuritySeverity string `json:"security_severity,omitempty"`
+
+	// File is the name of the file (or code block) the problem was found in.
+	// Empty for problems with the response as a whole.
+	File string `json:"file,omitempty"`
+
+	// Line is the line number of the problem, starting at 1. Zero if unknown.
+	Line int `json:"line,omitempty"`
+
+	// Column is the column number of the problem, starting at 1. Zero if
+	// unknown.
+	Column int `json:"column,omitempty"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// Report describes a response generated by an LLM provider, and all problems
+// found in it.
+type Report struct {
+	// Tool is the name of the tool that generated the report.
+	Tool string `json:"tool"`
+
+	// Version is the version of the tool, if known.
+	Version string `json:"version,omitempty"`
+
+	// CreatedAt is the time the report was created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// Backend is the name of the backend that generated the response.
+	Backend string `json:"backend,omitempty"`
+
+	// Model is the name of the model that generated the response.
+	Model string `json:"model,omitempty"`
+
+	// Prompt is the prompt the response was generated for.
+	Prompt string `json:"prompt,omitempty"`
+
+	// StopReason is the reason the model stopped generating the response.
+	StopReason string `json:"stop_reason,omitempty"`
+
+	// TokensUsed is the number of tokens used to generate the response.
+	TokensUsed int64 `json:"tokens_used,omitempty"`
+
+	// Files are the names of the files (or code blocks) extracted from the
+	// response, or the paths they were saved to, if known.
+	Files []string `json:"files"`
+
+	// Findings are all problems found in the response.
+	Findings []Finding `json:"findings"`
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Prompt is the prompt the response was generated for. Optional.
+	Prompt string
+
+	// Version is the version of the tool generating the report. Optional.
+	Version string
+
+	// Validator is used to validate the response. Optional, defaults to the
+	// built-in validators (see validation.Validate).
+	Validator validation.Validator
+
+	// Scanner is used to run security checks on the response. Optional,
+	// defaults to a scanner with the built-in rules.
+	Scanner *security.Scanner
+
+	// Checked is true if the response was already validated and checked for
+	// security problems by the caller, in which case Diagnostics and
+	// SecurityFindings are included in the report as-is, and Validator and
+	// Scanner are not used.
+	Checked bool
+
+	// Diagnostics are the validation problems found in the response, if
+	// Checked is true.
+	Diagnostics []validation.Diagnostic
+
+	// SecurityFindings are the security problems found in the response, if
+	// Checked is true.
+	SecurityFindings []security.Finding
+
+	// Paths are the paths the code blocks of the response were saved to, in
+	// the same order as the response's Files. Code blocks with a non-empty
+	// path are referred to by it in the report, rather than by their name.
+	// Optional.
+	Paths []string
+}
+
+// New creates a report for the provided response, running the built-in
+// response checks (see RuleNoCodeBlock and RuleResponseTruncated), validation
+// and security checks (unless the caller already ran them, see
+// Options.Checked). opts may be nil.
+func New(res types.Response, opts *Options) *Report {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	diags, findings := opts.Diagnostics, opts.SecurityFindings
+	if !opts.Checked {
+		validator := opts.Validator
+		if validator == nil {
+			validator = validation.ValidatorFunc(validation.Validate)
+		}
+
+		scanner := opts.Scanner
+		if scanner == nil {
+			scanner = security.New(nil)
+		}
+
+		diags, findings = validator.Validate(res), scanner.Scan(res)
+	}
+
+	report := &Report{
+		Tool:       "aiac",
+		Version:    opts.Version,
+		CreatedAt:  time.Now().UTC(),
+		Backend:    res.Backend,
+		Model:      res.Model,
+		Prompt:     opts.Prompt,
+		StopReason: res.StopReason,
+		TokensUsed: res.TokensUsed,
+		Files:      make([]string, 0, len(res.Files)),
+		Findings:   append([]Finding{}, checkResponse(res)...),
+	}
+
+	for _, diag := range diags {
+		report.Findings = append(report.Findings, fromDiagnostic(diag))
+	}
+
+	for _, finding := range findings {
+		report.Findings = append(report.Findings, fromSecurityFinding(finding))
+	}
+
+	// refer to code blocks by the paths they were saved to, if known
+	paths := make(map[string]string, len(opts.Paths))
+	for i, file := range res.Files {
+		name := fileName(i, file)
+		if i < len(opts.Paths) && opts.Paths[i] != "" {
+			paths[name] = opts.Paths[i]
+			name = opts.Paths[i]
+		}
+
+		report.Files = append(report.Files, name)
+	}
+
+	for i := range report.Findings {
+		if path, ok := paths[report.Findings[i].File]; ok {
+			report.Findings[i].File = path
+		}
+	}
+
+	return report
+}
+
+// fileName returns the name used for a code block in findings, which is its
+// file name, or its position if it has no file name.
+func fileName(i int, block types.CodeBlock) string {
+	if block.Filename != "" {
+		return block.Filename
+	}
+
+	return fmt.Sprintf("code block %d", i+1)
+}
+
+// checkResponse runs the built-in checks on a response.
+func checkResponse(res types.Response) (findings []Finding) {
+	if len(res.Files) == 0 {
+		findings = append(findings, Finding{
+			RuleID:   RuleNoCodeBlock,
+			Severity: SeverityError,
+			Message:  "no code block could be extracted from the response",
+		})
+	}
+
+	if types.IsTruncated(res.StopReason) {
+		finding := Finding{
+			RuleID:   RuleResponseTruncated,
+			Severity: SeverityError,
+			Message: fmt.Sprintf(
+				"the response was truncated (%s), the code is probably incomplete",
+				res.StopReason,
+			),
+		}
+
+		// the last code block is the one that was cut off
+		if last := len(res.Files) - 1; last >= 0 {
+			finding.File = fileName(last, res.Files[last])
+			finding.Line = strings.Count(res.Files[last].Code, "\n") + 1
+		}
+
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+func fromDiagnostic(diag validation.Diagnostic) Finding {
+	severity := SeverityError
+	if diag.Severity == validation.SeverityWarning {
+		severity = SeverityWarning
+	}
+
+	return Finding{
+		RuleID:   diag.Rule,
+		Severity: severity,
+		File:     diag.File,
+		Line:     diag.Line,
+		Column:   diag.Column,
+		Message:  diag.Message,
+	}
+}
+
+func fromSecurityFinding(finding security.Finding) Finding {
+	var severity Severity
+	switch finding.Severity {
+	case security.SeverityCritical, security.SeverityHigh:
+		severity = SeverityError
+	case security.SeverityMedium:
+		severity = SeverityWarning
+	default:
+		severity = SeverityNote
+	}
+
+	msg := finding.Message
+	if finding.Resource != "" {
+		msg = fmt.Sprintf("%s: %s", finding.Resource, msg)
+	}
+
+	return Finding{
+		RuleID:           finding.Rule,
+		Severity:         severity,
+		SecuritySeverity: finding.Severity.String(),
+		File:             finding.File,
+		Line:             finding.Line,
+		Message:          msg,
+	}
+}
+
+// Penalties subtracted from a report's score for every finding, by severity.
+var scorePenalties = map[Severity]int{
+	SeverityError:   20,
+	SeverityWarning: 5,
+	SeverityNote:    1,
+}
+
+// Score rates the response described by the report from 0 to 100, with 100
+// meaning no problems were found. Every finding lowers the score according to
+// its severity (20 points for errors, 5 for warnings and 1 for notes).
+// Responses without code score 0.
+func (report *Report) Score() int {
+	score := 100
+	for _, finding := range report.Findings {
+		if finding.RuleID == RuleNoCodeBlock {
+			return 0
+		}
+
+		score -= scorePenalties[finding.Severity]
+	}
+
+	if score < 0 {
+		score = 0
+	}
+
+	return score
+}
+
+// Format is the format of a report.
+type Format string
+
+const (
+	// FormatJSON is a JSON encoding of the Report struct.
+	FormatJSON Format = "json"
+
+	// FormatSARIF is the Static Analysis Results Interchange Format, version
+	// 2.1.0, supported by most code scanning dashboards.
+	FormatSARIF Format = "sarif"
+)
+
+// Write writes the report to w in the provided format.
+func (report *Report) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		return report.WriteJSON(w)
+	case FormatSARIF:
+		return report.WriteSARIF(w)
+	default:
+		return fmt.Errorf("%w %q", types.ErrUnsupportedReportFormat, format)
+	}
+}
+
+// WriteJSON writes the report to w as JSON.
+func (report *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("failed encoding report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/report"
+	"github.com/gofireflyio/aiac/v5/libaiac/security"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// response is a truncated response with a validation problem and a security
+// problem.
+func response() types.Response {
+	output := "```hcl\n" +
+		"// main.tf\n" +
+		"resource \"aws_s3_bucket\" \"logs\" {\n" +
+		"  acl = \"public-read\"\n" +
+		"}\n" +
+		"```\n" +
+		"```hcl\n" +
+		"resource \"aws_s3_bucket\" {\n" +
+		"```"
+
+	return types.Response{
+		FullOutput: output,
+		Files:      types.ExtractFiles(output),
+		Backend:    "mock",
+		Model:      "mock-model",
+		StopReason: "length",
+		TokensUsed: 42,
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		res       types.Response
+		opts      *report.Options
+		wantFiles []string
+		wantRules []string
+		wantScore int
+	}{
+		{
+			name:      "no code",
+			res:       types.Response{FullOutput: "I cannot help with that.", StopReason: "stop"},
+			wantFiles: []string{},
+			wantRules: []string{report.RuleNoCodeBlock},
+			wantScore: 0,
+		},
+		{
+			name: "clean",
+			res: types.Response{
+				Files:      types.ExtractFiles("```hcl\nlocals {}\n```"),
+				StopReason: "stop",
+			},
+			wantFiles: []string{"code block 1"},
+			wantRules: []string{},
+			wantScore: 100,
+		},
+		{
+			name:      "checked by the report",
+			res:       response(),
+			wantFiles: []string{"main.tf", "code block 2"},
+			wantRules: []string{
+				report.RuleResponseTruncated,
+				"hcl-syntax",
+				"public-bucket",
+			},
+			wantScore: 40,
+		},
+		{
+			name: "checked by the caller",
+			res:  response(),
+			opts: &report.Options{
+				Checked: true,
+				Diagnostics: []validation.Diagnostic{{
+					File:     "main.tf",
+					Line:     2,
+					Severity: validation.SeverityWarning,
+					Message:  "meh",
+					Rule:     "custom",
+				}},
+			},
+			wantFiles: []string{"main.tf", "code block 2"},
+			wantRules: []string{report.RuleResponseTruncated, "custom"},
+			wantScore: 75,
+		},
+		{
+			name: "saved paths",
+			res:  response(),
+			opts: &report.Options{
+				Checked: true,
+				SecurityFindings: []security.Finding{{
+					Rule:     "public-bucket",
+					Severity: security.SeverityLow,
+					File:     "main.tf",
+					Line:     2,
+				}},
+				Paths: []string{"infra/main.tf", ""},
+			},
+			wantFiles: []string{"infra/main.tf", "code block 2"},
+			wantRules: []string{report.RuleResponseTruncated, "public-bucket"},
+			wantScore: 79,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep := report.New(tt.res, tt.opts)
+
+			if !equalStrings(rep.Files, tt.wantFiles) {
+				t.Errorf("expected files %v, got %v", tt.wantFiles, rep.Files)
+			}
+
+			rules := []string{}
+			for _, finding := range rep.Findings {
+				rules = append(rules, finding.RuleID)
+			}
+
+			if !equalStrings(rules, tt.wantRules) {
+				t.Errorf("expected findings of rules %v, got %v", tt.wantRules, rules)
+			}
+
+			if tt.opts != nil && len(tt.opts.Paths) > 0 {
+				for _, finding := range rep.Findings {
+					if finding.File == "main.tf" {
+						t.Errorf("expected finding to refer to saved path, got %+v", finding)
+					}
+				}
+			}
+
+			if got := rep.Score(); got != tt.wantScore {
+				t.Errorf("expected score %d, got %d", tt.wantScore, got)
+			}
+		})
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	rep := report.New(response(), &report.Options{
+		Prompt:  "generate terraform for a logs bucket",
+		Version: "v5.0.0",
+		Paths:   []string{"infra/main.tf", ""},
+	})
+	rep.CreatedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := rep.Write(&buf, report.FormatSARIF); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	golden := filepath.Join("testdata", "report.sarif")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("failed updating golden file: %s", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed reading golden file: %s", err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("SARIF output does not match %s (run with -update to update it):\n%s", golden, buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	rep := report.New(response(), nil)
+
+	var buf bytes.Buffer
+	if err := rep.Write(&buf, report.FormatJSON); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var decoded report.Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("report is not valid JSON: %s", err)
+	}
+
+	if decoded.Model != "mock-model" || len(decoded.Findings) != len(rep.Findings) {
+		t.Errorf("unexpected decoded report %+v", decoded)
+	}
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	err := report.New(response(), nil).Write(&bytes.Buffer{}, "xml")
+	if !errors.Is(err, types.ErrUnsupportedReportFormat) {
+		t.Errorf("expected error %q, got %v", types.ErrUnsupportedReportFormat, err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,227 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/security"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolURI      = "https://github.com/gofireflyio/aiac"
+)
+
+// ruleDescriptions describe the rules of the built-in response checks and
+// validators. Descriptions of security rules are taken from the security
+// package.
+var ruleDescriptions = map[string]string{
+	RuleNoCodeBlock:       "No code block could be extracted from the response",
+	RuleResponseTruncated: "The response was truncated before it was complete",
+	"hcl-syntax":          "HCL code with syntax errors",
+	"terraform-structure": "Terraform configuration with invalid top-level structure",
+	"yaml-syntax":         "YAML code with syntax errors",
+	"k8s-schema":          "Kubernetes manifests that do not match the Kubernetes API",
+}
+
+// securitySeverityScores map security severities to the numeric scores used
+// by code scanning dashboards (e.g. GitHub's) to rank security findings.
+var securitySeverityScores = map[string]string{
+	security.SeverityCritical.String(): "9.5",
+	security.SeverityHigh.String():     "8.0",
+	security.SeverityMedium.String():   "5.5",
+	security.SeverityLow.String():      "3.0",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool              `json:"tool"`
+	Artifacts  []sarifArtifact        `json:"artifacts,omitempty"`
+	Results    []sarifResult          `json:"results"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string            `json:"id"`
+	ShortDescription sarifMessage      `json:"shortDescription"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifact struct {
+	Location sarifArtifactLocation `json:"location"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     Severity        `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes the report to w as a SARIF 2.1.0 log with a single run.
+// The backend, model and prompt are included in the run's properties.
+func (report *Report) WriteSARIF(w io.Writer) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           report.Tool,
+				Version:        report.Version,
+				InformationURI: toolURI,
+				Rules:          []sarifRule{},
+			},
+		},
+		Results: []sarifResult{},
+		Properties: map[string]interface{}{
+			"backend":     report.Backend,
+			"model":       report.Model,
+			"prompt":      report.Prompt,
+			"stop_reason": report.StopReason,
+			"tokens_used": report.TokensUsed,
+			"created_at":  report.CreatedAt,
+		},
+	}
+
+	for _, file := range report.Files {
+		run.Artifacts = append(run.Artifacts, sarifArtifact{
+			Location: sarifArtifactLocation{URI: fileURI(file)},
+		})
+	}
+
+	ruleIndexes := make(map[string]int)
+
+	for _, finding := range report.Findings {
+		index, ok := ruleIndexes[finding.RuleID]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			ruleIndexes[finding.RuleID] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, newSARIFRule(finding))
+		}
+
+		result := sarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: index,
+			Level:     finding.Severity,
+			Message:   sarifMessage{Text: finding.Message},
+		}
+
+		if finding.File != "" {
+			loc := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: fileURI(finding.File)},
+				},
+			}
+
+			if finding.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{
+					StartLine:   finding.Line,
+					StartColumn: finding.Column,
+				}
+			}
+
+			result.Locations = []sarifLocation{loc}
+		}
+
+		run.Results = append(run.Results, result)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	})
+	if err != nil {
+		return fmt.Errorf("failed encoding report: %w", err)
+	}
+
+	return nil
+}
+
+func newSARIFRule(finding Finding) sarifRule {
+	rule := sarifRule{
+		ID:               finding.RuleID,
+		ShortDescription: sarifMessage{Text: ruleDescription(finding.RuleID)},
+	}
+
+	if score, ok := securitySeverityScores[finding.SecuritySeverity]; ok {
+		rule.Properties = map[string]string{"security-severity": score}
+	}
+
+	return rule
+}
+
+func ruleDescription(id string) string {
+	if desc, ok := ruleDescriptions[id]; ok {
+		return desc
+	}
+
+	for _, rule := range security.Rules() {
+		if rule.ID == id {
+			return rule.Description
+		}
+	}
+
+	return id
+}
+
+// fileURI converts a file name to a URI, as required by SARIF: a relative
+// URI reference for relative paths, and a file URI for absolute paths.
+func fileURI(file string) string {
+	path := filepath.ToSlash(file)
+	if !filepath.IsAbs(file) {
+		return (&url.URL{Path: path}).String()
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths, e.g. C:/path
+		path = "/" + path
+	}
+
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
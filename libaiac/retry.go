@@ -0,0 +1,250 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// DefaultRetryPolicy is the retry policy used for backends that do not
+// define one in the configuration.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+// RetryPolicy controls how requests to a backend are retried when they fail
+// due to temporary errors, such as rate limiting, service unavailability, or
+// network errors (see isRetryable). Requests that fail due to invalid input
+// (i.e. types.ErrRequestFailed) or because their context was canceled are
+// never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts to make for every
+	// request, including the first one. Set to 1 to disable retries.
+	MaxAttempts int `toml:"max_attempts"`
+
+	// InitialBackoff is the duration to wait before the first retry. It is
+	// doubled for every subsequent retry, up to MaxBackoff. Accepts strings
+	// such as "500ms" or "2s" in the configuration file.
+	InitialBackoff time.Duration `toml:"initial_backoff"`
+
+	// MaxBackoff is the maximum duration to wait between attempts. It also
+	// limits durations requested by the provider via Retry-After.
+	MaxBackoff time.Duration `toml:"max_backoff"`
+
+	// Jitter is the fraction (between 0 and 1) by which backoff durations are
+	// randomly adjusted, to prevent multiple clients from retrying in unison.
+	Jitter float64 `toml:"jitter"`
+}
+
+// withDefaults returns a copy of the policy where unset values are taken
+// from DefaultRetryPolicy.
+func (policy RetryPolicy) withDefaults() RetryPolicy {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		policy.Jitter = DefaultRetryPolicy.Jitter
+	}
+
+	return policy
+}
+
+// backoff returns the duration to wait before the provided retry attempt
+// (starting from 1). If the provider asked to wait a specific duration, it
+// is used instead, but never for longer than MaxBackoff, so that a provider
+// cannot stall requests indefinitely.
+func (policy RetryPolicy) backoff(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if retryAfter > policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+
+		return retryAfter
+	}
+
+	delay := policy.InitialBackoff
+	for i := 1; i < retry && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		//nolint: gosec
+		delta := (rand.Float64()*2 - 1) * policy.Jitter * float64(delay)
+		delay += time.Duration(delta)
+	}
+
+	return delay
+}
+
+// isRetryable returns true if a request that failed with the provided error
+// may succeed if retried, along with the duration the provider asked to wait
+// before retrying, if any. Besides errors marked by backends as retryable
+// (i.e. types.RetryableError), network errors such as connection resets,
+// connections closed unexpectedly and timeouts are retryable. Errors caused
+// by the request's context being canceled are not.
+func isRetryable(err error) (retryAfter time.Duration, ok bool) {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return 0, false
+	}
+
+	var retryable *types.RetryableError
+	if errors.As(err, &retryable) {
+		return retryable.RetryAfter, true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// permanentError wraps errors that must not be retried, even if they are
+// otherwise retryable.
+type permanentError struct {
+	err error
+}
+
+func (err *permanentError) Error() string {
+	return err.err.Error()
+}
+
+// run executes the provided function until it succeeds, fails with an error
+// that is not retryable, or the maximum number of attempts is reached. The
+// function may wrap errors in a permanentError to prevent retries.
+func (policy RetryPolicy) run(ctx context.Context, fn func() error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = fn()
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+
+		retryAfter, retryable := isRetryable(err)
+		if !retryable || ctx.Err() != nil || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(policy.backoff(attempt, retryAfter))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryBackend wraps a Backend, retrying failed requests according to a
+// retry policy.
+type retryBackend struct {
+	types.Backend
+	policy RetryPolicy
+}
+
+// ListModels returns a list of all models supported by the backend,
+// retrying the request as necessary.
+func (backend *retryBackend) ListModels(ctx context.Context) (
+	models []string,
+	err error,
+) {
+	err = backend.policy.run(ctx, func() (err error) {
+		models, err = backend.Backend.ListModels(ctx)
+		return err
+	})
+
+	return models, err
+}
+
+// Chat initiates a conversation with the backend, in which all messages are
+// retried as necessary.
+func (backend *retryBackend) Chat(model string, msgs ...types.Message) types.Conversation {
+	return &retryConversation{
+		Conversation: backend.Backend.Chat(model, msgs...),
+		policy:       backend.policy,
+	}
+}
+
+// retryConversation wraps a Conversation, retrying failed messages according
+// to a retry policy. Backends only record a message in the conversation once
+// a response is received, so retries do not duplicate messages.
+type retryConversation struct {
+	types.Conversation
+	policy RetryPolicy
+}
+
+// Send sends the provided message to the model, retrying as necessary.
+func (conv *retryConversation) Send(ctx context.Context, prompt string) (
+	res types.Response,
+	err error,
+) {
+	err = conv.policy.run(ctx, func() (err error) {
+		res, err = conv.Conversation.Send(ctx, prompt)
+		return err
+	})
+
+	return res, err
+}
+
+// SendStream is the same as Send, but streams the response. Requests are
+// only retried if they failed before any output was streamed, otherwise the
+// caller would receive duplicate output.
+func (conv *retryConversation) SendStream(
+	ctx context.Context,
+	prompt string,
+	fn func(string),
+) (res types.Response, err error) {
+	var streamed bool
+
+	err = conv.policy.run(ctx, func() (err error) {
+		res, err = conv.Conversation.SendStream(ctx, prompt, func(chunk string) {
+			streamed = true
+			fn(chunk)
+		})
+
+		if streamed && err != nil {
+			// don't retry, return the underlying error instead
+			var retryable *types.RetryableError
+			if errors.As(err, &retryable) {
+				err = retryable.Err
+			}
+
+			return &permanentError{err: err}
+		}
+
+		return err
+	})
+
+	return res, err
+}
@@ -0,0 +1,358 @@
+package libaiac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestRetryPolicyWithDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   RetryPolicy
+	}{
+		{
+			name:   "empty",
+			policy: RetryPolicy{},
+			want: RetryPolicy{
+				MaxAttempts:    DefaultRetryPolicy.MaxAttempts,
+				InitialBackoff: DefaultRetryPolicy.InitialBackoff,
+				MaxBackoff:     DefaultRetryPolicy.MaxBackoff,
+			},
+		},
+		{
+			name: "custom",
+			policy: RetryPolicy{
+				MaxAttempts:    5,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Second,
+				Jitter:         0,
+			},
+			want: RetryPolicy{
+				MaxAttempts:    5,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Second,
+				Jitter:         0,
+			},
+		},
+		{
+			name:   "invalid jitter",
+			policy: RetryPolicy{MaxAttempts: 1, Jitter: 2},
+			want: RetryPolicy{
+				MaxAttempts:    1,
+				InitialBackoff: DefaultRetryPolicy.InitialBackoff,
+				MaxBackoff:     DefaultRetryPolicy.MaxBackoff,
+				Jitter:         DefaultRetryPolicy.Jitter,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.withDefaults(); got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+	}
+
+	tests := []struct {
+		retry      int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{retry: 1, want: time.Second},
+		{retry: 2, want: 2 * time.Second},
+		{retry: 3, want: 4 * time.Second},
+		{retry: 4, want: 5 * time.Second},
+		{retry: 20, want: 5 * time.Second},
+		{retry: 1, retryAfter: 3 * time.Second, want: 3 * time.Second},
+		{retry: 1, retryAfter: time.Hour, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("retry=%d/after=%s", tt.retry, tt.retryAfter), func(t *testing.T) {
+			if got := policy.backoff(tt.retry, tt.retryAfter); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("jitter", func(t *testing.T) {
+		policy := policy
+		policy.Jitter = 0.5
+
+		for i := 0; i < 100; i++ {
+			got := policy.backoff(2, 0)
+			if got < time.Second || got > 3*time.Second {
+				t.Fatalf("expected backoff between 1s and 3s, got %s", got)
+			}
+		}
+	})
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		want           bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "nil"},
+		{
+			name: "retryable",
+			err: fmt.Errorf("failed: %w", &types.RetryableError{
+				Err:        types.ErrRequestFailed,
+				RetryAfter: time.Second,
+			}),
+			want:           true,
+			wantRetryAfter: time.Second,
+		},
+		{
+			name: "connection reset",
+			err:  &url.Error{Op: "Post", URL: "http://x", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}},
+			want: true,
+		},
+		{
+			name: "connection closed",
+			err:  fmt.Errorf("failed sending prompt: %w", &url.Error{Op: "Post", URL: "http://x", Err: io.EOF}),
+			want: true,
+		},
+		{
+			name: "stream cut off",
+			err:  fmt.Errorf("failed reading stream: %w", io.ErrUnexpectedEOF),
+			want: true,
+		},
+		{
+			name: "timeout",
+			err:  &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			want: true,
+		},
+		{
+			name: "not a timeout",
+			err:  &net.DNSError{Err: "no such host", IsNotFound: true},
+		},
+		{
+			name: "canceled",
+			err:  &url.Error{Op: "Post", URL: "http://x", Err: context.Canceled},
+		},
+		{
+			name: "request failed",
+			err:  fmt.Errorf("%w: bad", types.ErrRequestFailed),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryAfter, got := isRetryable(tt.err)
+			if got != tt.want || retryAfter != tt.wantRetryAfter {
+				t.Errorf("expected %t (%s), got %t (%s)", tt.want, tt.wantRetryAfter, got, retryAfter)
+			}
+		})
+	}
+}
+
+func TestRetryTransportError(t *testing.T) {
+	var attempts int
+
+	err := fastRetries.run(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("failed sending prompt: %w", io.ErrUnexpectedEOF)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	var attempts int
+
+	err := fastRetries.run(context.Background(), func() error {
+		attempts++
+		return &permanentError{err: io.ErrUnexpectedEOF}
+	})
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected error %q, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
+
+// fastRetries is a retry policy that makes three attempts without waiting
+// between them for more than a millisecond.
+var fastRetries = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+}
+
+func TestRetryFlaky(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Status: http.StatusServiceUnavailable, Times: 1},
+			{Status: http.StatusTooManyRequests, Times: 1},
+			{Response: "ok"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := (&retryBackend{Backend: backend, policy: fastRetries}).Chat("model")
+
+	res, err := conv.Send(context.Background(), "prompt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != "ok" {
+		t.Errorf("unexpected output %q", res.FullOutput)
+	}
+
+	if got := len(backend.Requests()); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+
+	// Failed attempts must not leave the prompt in the conversation
+	if got := len(conv.Messages()); got != 2 {
+		t.Errorf("expected 2 messages, got %d", got)
+	}
+}
+
+func TestRetryFlakyStream(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Status: http.StatusBadGateway, Times: 1},
+			{Response: "ok"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := (&retryBackend{Backend: backend, policy: fastRetries}).Chat("model")
+
+	var streamed string
+	res, err := conv.SendStream(context.Background(), "prompt", func(chunk string) {
+		streamed += chunk
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if res.FullOutput != "ok" || streamed != "ok" {
+		t.Errorf("unexpected output %q (streamed %q)", res.FullOutput, streamed)
+	}
+
+	if got := len(backend.Requests()); got != 2 {
+		t.Errorf("expected 2 requests, got %d", got)
+	}
+}
+
+func TestRetryAttemptsExhausted(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Status: http.StatusServiceUnavailable, Times: 3},
+			{Response: "ok"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := (&retryBackend{Backend: backend, policy: fastRetries}).Chat("model")
+
+	_, err = conv.Send(context.Background(), "prompt")
+	if !errors.Is(err, types.ErrUnexpectedStatus) {
+		t.Fatalf("expected error %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+
+	if got := len(backend.Requests()); got != 3 {
+		t.Errorf("expected 3 requests, got %d", got)
+	}
+
+	if got := len(conv.Messages()); got != 0 {
+		t.Errorf("expected no messages, got %d", got)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{
+			{Prompt: "bad request", Status: http.StatusBadRequest},
+			{Prompt: "invalid prompt", Error: "invalid prompt"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := (&retryBackend{Backend: backend, policy: fastRetries}).Chat("model")
+
+	_, err = conv.Send(context.Background(), "bad request")
+	if !errors.Is(err, types.ErrUnexpectedStatus) {
+		t.Fatalf("expected error %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+
+	_, err = conv.Send(context.Background(), "invalid prompt")
+	if !errors.Is(err, types.ErrRequestFailed) {
+		t.Fatalf("expected error %q, got %v", types.ErrRequestFailed, err)
+	}
+
+	if got := len(backend.Requests()); got != 2 {
+		t.Errorf("expected no retries, got %d requests", got)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	backend, err := mock.New(&mock.Options{
+		Fixtures: []mock.Fixture{{Status: http.StatusServiceUnavailable}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	conv := (&retryBackend{
+		Backend: backend,
+		policy:  RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+	}).Chat("model")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = conv.Send(ctx, "prompt")
+	if !errors.Is(err, types.ErrUnexpectedStatus) {
+		t.Fatalf("expected error %q, got %v", types.ErrUnexpectedStatus, err)
+	}
+
+	if got := len(backend.Requests()); got != 1 {
+		t.Errorf("expected no retries after cancellation, got %d requests", got)
+	}
+}
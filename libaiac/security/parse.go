@@ -0,0 +1,249 @@
+package security
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of infrastructure-as-code resources.
+type Format string
+
+const (
+	// FormatTerraform is used for Terraform resources.
+	FormatTerraform Format = "terraform"
+
+	// FormatCloudFormation is used for AWS CloudFormation resources.
+	FormatCloudFormation Format = "cloudformation"
+
+	// FormatKubernetes is used for Kubernetes manifests.
+	FormatKubernetes Format = "kubernetes"
+)
+
+// Resource is an infrastructure resource defined in a file.
+type Resource struct {
+	// Format is the format the resource is defined in.
+	Format Format
+
+	// Type is the type of the resource. For Terraform, this is the resource
+	// type for "resource" blocks (e.g. "aws_s3_bucket"), the data source type
+	// prefixed with "data." for "data" blocks, the provider name prefixed with
+	// "provider." for "provider" blocks, and the block type for all other
+	// top-level blocks (e.g. "variable"). For CloudFormation, this is the
+	// resource type (e.g. "AWS::S3::Bucket"), and for Kubernetes the kind
+	// (e.g. "Deployment").
+	Type string
+
+	// Name is the name of the resource, e.g. the name of a Terraform
+	// resource, the logical ID of a CloudFormation resource, or the name of a
+	// Kubernetes object.
+	Name string
+
+	// Line is the line number where the resource is defined.
+	Line int
+
+	// Body holds the configuration of the resource: the body of a Terraform
+	// block, the properties of a CloudFormation resource, or the entire
+	// Kubernetes manifest.
+	Body *Value
+}
+
+// Address returns a string identifying the resource in findings, e.g.
+// "aws_s3_bucket.logs" or "Deployment/web".
+func (res Resource) Address() string {
+	switch {
+	case res.Name == "":
+		return res.Type
+	case res.Format == FormatKubernetes:
+		return fmt.Sprintf("%s/%s", res.Type, res.Name)
+	case res.Format == FormatCloudFormation:
+		return res.Name
+	default:
+		return fmt.Sprintf("%s.%s", res.Type, res.Name)
+	}
+}
+
+// File is a code block being checked by security rules.
+type File struct {
+	// Name is the name of the file, or a description of the code block if it
+	// has no file name.
+	Name string
+
+	// Language is the language of the code block, if known.
+	Language string
+
+	// Code is the contents of the file.
+	Code string
+
+	// Resources are the infrastructure resources defined in the file, in
+	// order. Files that cannot be parsed, or are not in one of the supported
+	// formats, have no resources.
+	Resources []Resource
+}
+
+// ResourcesOf returns the file's resources of the provided format, whose type
+// is one of the provided types. If no types are provided, all resources of
+// the format are returned.
+func (file *File) ResourcesOf(format Format, resTypes ...string) (resources []Resource) {
+	for _, res := range file.Resources {
+		if res.Format != format {
+			continue
+		}
+
+		if len(resTypes) == 0 || containsString(resTypes, res.Type) {
+			resources = append(resources, res)
+		}
+	}
+
+	return resources
+}
+
+func parseFile(name string, block types.CodeBlock) *File {
+	file := &File{
+		Name:     name,
+		Language: block.Language,
+		Code:     block.Code,
+	}
+
+	switch {
+	case validation.IsHCL(block):
+		file.Resources = parseTerraform(name, []byte(block.Code))
+	case validation.IsYAML(block) || isJSON(block):
+		file.Resources = parseYAML(block.Code)
+	}
+
+	return file
+}
+
+func isJSON(block types.CodeBlock) bool {
+	return strings.EqualFold(block.Language, "json") || filepath.Ext(block.Filename) == ".json"
+}
+
+func parseTerraform(name string, src []byte) (resources []Resource) {
+	file, diags := hclsyntax.ParseConfig(src, name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	for _, block := range body.Blocks {
+		res := Resource{
+			Format: FormatTerraform,
+			Type:   block.Type,
+			Line:   block.TypeRange.Start.Line,
+			Body:   fromHCLBody(block.Body, src, block.TypeRange.Start.Line),
+		}
+
+		switch {
+		case block.Type == "resource" && len(block.Labels) == 2:
+			res.Type, res.Name = block.Labels[0], block.Labels[1]
+		case block.Type == "data" && len(block.Labels) == 2:
+			res.Type, res.Name = "data."+block.Labels[0], block.Labels[1]
+		case block.Type == "provider" && len(block.Labels) == 1:
+			res.Type = "provider." + block.Labels[0]
+		case len(block.Labels) > 0:
+			res.Name = block.Labels[len(block.Labels)-1]
+		}
+
+		resources = append(resources, res)
+	}
+
+	return resources
+}
+
+// parseYAML parses all documents in YAML (or JSON) code, returning the
+// resources of CloudFormation templates and the objects of Kubernetes
+// manifests.
+func parseYAML(code string) (resources []Resource) {
+	decoder := yaml.NewDecoder(strings.NewReader(code))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			// either the end of the input, or invalid YAML, which is
+			// reported by validation
+			return resources
+		}
+
+		doc := fromYAML(&node, 0)
+		if doc.Kind != MapValue {
+			continue
+		}
+
+		if isCloudFormation(doc) {
+			resources = append(resources, cloudFormationResources(doc)...)
+		} else if kind := doc.Get("kind"); kind.IsScalar() && doc.Get("apiVersion").IsScalar() {
+			resources = append(resources, Resource{
+				Format: FormatKubernetes,
+				Type:   kind.Str,
+				Name:   doc.Get("metadata", "name").String(),
+				Line:   doc.Line,
+				Body:   doc,
+			})
+		}
+	}
+}
+
+// isCloudFormation returns true if a document is a CloudFormation template,
+// i.e. it has a template format version or at least one resource of an AWS
+// resource type.
+func isCloudFormation(doc *Value) bool {
+	if doc.Get("AWSTemplateFormatVersion") != nil {
+		return true
+	}
+
+	resources := doc.Get("Resources")
+	for _, name := range sortedKeys(resources) {
+		if strings.HasPrefix(resources.Get(name, "Type").String(), "AWS::") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cloudFormationResources(doc *Value) (resources []Resource) {
+	defs := doc.Get("Resources")
+	for _, name := range sortedKeys(defs) {
+		res := defs.Get(name)
+		props := res.Get("Properties")
+		if props == nil {
+			props = &Value{Kind: MapValue, Line: res.Line, Map: make(map[string]*Value)}
+		}
+
+		resources = append(resources, Resource{
+			Format: FormatCloudFormation,
+			Type:   res.Get("Type").String(),
+			Name:   name,
+			Line:   res.Line,
+			Body:   props,
+		})
+	}
+
+	// maps are unordered, so keep resources in the order they are defined
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Line < resources[j].Line
+	})
+
+	return resources
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+
+	return false
+}
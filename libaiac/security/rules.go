@@ -0,0 +1,943 @@
+package security
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtinRules are the rules run by default, see Rules.
+var builtinRules = []Rule{
+	{
+		ID:          "hardcoded-key",
+		Severity:    SeverityCritical,
+		Description: "Cloud access keys, API tokens or private keys embedded in code",
+		Check:       checkHardcodedKeys,
+	},
+	{
+		ID:          "plaintext-secret",
+		Severity:    SeverityHigh,
+		Description: "Passwords, tokens and other secrets set to plaintext values",
+		Check:       checkPlaintextSecrets,
+	},
+	{
+		ID:          "open-admin-port",
+		Severity:    SeverityHigh,
+		Description: "SSH or RDP open to the internet",
+		Check:       checkOpenAdminPorts,
+	},
+	{
+		ID:          "open-ingress",
+		Severity:    SeverityMedium,
+		Description: "Ports other than HTTP and HTTPS open to the internet",
+		Check:       checkOpenIngress,
+	},
+	{
+		ID:          "public-bucket",
+		Severity:    SeverityHigh,
+		Description: "Storage buckets and containers accessible by anyone",
+		Check:       checkPublicBuckets,
+	},
+	{
+		ID:          "public-database",
+		Severity:    SeverityHigh,
+		Description: "Databases accessible from the internet",
+		Check:       checkPublicDatabases,
+	},
+	{
+		ID:          "unencrypted-storage",
+		Severity:    SeverityMedium,
+		Description: "Volumes, databases and file systems without encryption at rest",
+		Check:       checkUnencryptedStorage,
+	},
+	{
+		ID:          "wildcard-iam-action",
+		Severity:    SeverityHigh,
+		Description: "IAM policies allowing all actions",
+		Check:       checkWildcardActions,
+	},
+	{
+		ID:          "privileged-container",
+		Severity:    SeverityHigh,
+		Description: "Privileged containers, or containers with the SYS_ADMIN or ALL capabilities",
+		Check:       checkPrivilegedContainers,
+	},
+	{
+		ID:          "privilege-escalation",
+		Severity:    SeverityMedium,
+		Description: "Containers allowing privilege escalation",
+		Check:       checkPrivilegeEscalation,
+	},
+	{
+		ID:          "host-namespace",
+		Severity:    SeverityMedium,
+		Description: "Pods sharing the host's network, PID or IPC namespace",
+		Check:       checkHostNamespaces,
+	},
+	{
+		ID:          "host-path-volume",
+		Severity:    SeverityMedium,
+		Description: "Pods mounting directories of the host",
+		Check:       checkHostPathVolumes,
+	},
+	{
+		ID:          "run-as-root",
+		Severity:    SeverityLow,
+		Description: "Pods or containers explicitly running as root",
+		Check:       checkRunAsRoot,
+	},
+}
+
+// keyPatterns match well-known formats of credentials.
+var keyPatterns = []struct {
+	regex *regexp.Regexp
+	desc  string
+}{
+	{regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), "AWS access key ID"},
+	{regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----`), "private key"},
+	{regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`), "GitHub token"},
+	{regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), "Slack token"},
+}
+
+func checkHardcodedKeys(file *File) (findings []Finding) {
+	for _, pattern := range keyPatterns {
+		for _, loc := range pattern.regex.FindAllStringIndex(file.Code, -1) {
+			if strings.Contains(file.Code[loc[0]:loc[1]], "EXAMPLE") {
+				// placeholder keys from the AWS documentation
+				continue
+			}
+
+			findings = append(findings, Finding{
+				Line:    strings.Count(file.Code[:loc[0]], "\n") + 1,
+				Message: fmt.Sprintf("%s embedded in code", pattern.desc),
+			})
+		}
+	}
+
+	return findings
+}
+
+// secretNameSuffixes are suffixes of (normalized) attribute names that hold
+// secrets.
+var secretNameSuffixes = []string{
+	"password", "passwd", "passphrase", "secret", "secretkey", "secretstring",
+	"accesskey", "apikey", "token", "privatekey",
+}
+
+func isSecretName(name string) bool {
+	normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", ".", "").Replace(name))
+	for _, suffix := range secretNameSuffixes {
+		if strings.HasSuffix(normalized, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPlaintext returns true if a value is a literal, non-empty string, rather
+// than a reference to a secret store (e.g. a Terraform variable, a
+// CloudFormation dynamic reference or an ARN).
+func isPlaintext(v *Value) bool {
+	return v != nil && v.Kind == StringValue && v.Str != "" &&
+		!strings.Contains(v.Str, "{{resolve:") && !strings.HasPrefix(v.Str, "arn:")
+}
+
+func checkPlaintextSecrets(file *File) (findings []Finding) {
+	for _, res := range file.Resources {
+		switch {
+		case res.Format == FormatTerraform && res.Type == "variable":
+			if def := res.Body.Get("default"); isSecretName(res.Name) && isPlaintext(def) {
+				findings = append(findings, Finding{
+					Line:     def.Line,
+					Resource: "var." + res.Name,
+					Message:  "variable has a plaintext default value",
+				})
+			}
+		case res.Format == FormatKubernetes:
+			for _, container := range containers(podSpec(res)) {
+				for _, env := range container.Get("env").Items() {
+					name, value := env.Get("name").String(), env.Get("value")
+					if isSecretName(name) && isPlaintext(value) {
+						findings = append(findings, Finding{
+							Line:     value.Line,
+							Resource: res.Address(),
+							Message: fmt.Sprintf(
+								"environment variable %s of container %s is set to a plaintext value, use a Secret instead",
+								name, container.Get("name"),
+							),
+						})
+					}
+				}
+			}
+
+			if res.Type == "ConfigMap" {
+				for _, key := range sortedKeys(res.Body.Get("data")) {
+					if value := res.Body.Get("data", key); isSecretName(key) && isPlaintext(value) {
+						findings = append(findings, Finding{
+							Line:     value.Line,
+							Resource: res.Address(),
+							Message:  fmt.Sprintf("key %s holds a plaintext secret, use a Secret instead", key),
+						})
+					}
+				}
+			}
+		default:
+			walkMap(res.Body, func(key string, value *Value) {
+				if isSecretName(key) && isPlaintext(value) {
+					findings = append(findings, Finding{
+						Line:     value.Line,
+						Resource: res.Address(),
+						Message:  fmt.Sprintf("%s is set to a plaintext value", key),
+					})
+				}
+			})
+		}
+	}
+
+	return findings
+}
+
+// walkMap calls fn for every key of every map nested in the provided value, in
+// sorted key order.
+func walkMap(v *Value, fn func(key string, value *Value)) {
+	if v == nil {
+		return
+	}
+
+	switch v.Kind {
+	case MapValue:
+		for _, key := range sortedKeys(v) {
+			fn(key, v.Map[key])
+			walkMap(v.Map[key], fn)
+		}
+	case ListValue:
+		for _, item := range v.List {
+			walkMap(item, fn)
+		}
+	}
+}
+
+func sortedKeys(v *Value) []string {
+	if v == nil || v.Kind != MapValue {
+		return nil
+	}
+
+	keys := make([]string, 0, len(v.Map))
+	for key := range v.Map {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// portRange is an inclusive range of network ports.
+type portRange struct {
+	from, to int
+}
+
+func (ports portRange) String() string {
+	if ports.from == ports.to {
+		return strconv.Itoa(ports.from)
+	}
+
+	return fmt.Sprintf("%d-%d", ports.from, ports.to)
+}
+
+var allPorts = []portRange{{0, 65535}}
+
+// ingressRule is a firewall rule allowing traffic from the internet.
+type ingressRule struct {
+	res   Resource
+	line  int
+	ports []portRange
+}
+
+func (rule ingressRule) allows(port int) bool {
+	for _, ports := range rule.ports {
+		if port >= ports.from && port <= ports.to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isInternet returns true if a source address of a firewall rule matches all
+// addresses.
+func isInternet(addr string) bool {
+	switch strings.ToLower(addr) {
+	case "0.0.0.0/0", "::/0", "0.0.0.0", "*", "internet", "any":
+		return true
+	}
+
+	return false
+}
+
+func anyInternet(values ...*Value) bool {
+	for _, v := range values {
+		for _, addr := range v.Strings() {
+			if isInternet(addr) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parsePorts parses port specifications such as "22", "1000-2000" or "*".
+func parsePorts(specs []string) (ranges []portRange, ok bool) {
+	for _, spec := range specs {
+		if spec == "*" {
+			return allPorts, true
+		}
+
+		from, to, isRange := strings.Cut(spec, "-")
+		if !isRange {
+			to = from
+		}
+
+		fromPort, err1 := strconv.Atoi(strings.TrimSpace(from))
+		toPort, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+
+		ranges = append(ranges, portRange{fromPort, toPort})
+	}
+
+	return ranges, true
+}
+
+// awsIngressRule creates an ingressRule from an AWS security group rule, if
+// it allows traffic from the internet to known ports.
+func awsIngressRule(
+	res Resource,
+	rule *Value,
+	fromKey, toKey, protocolKey string,
+	cidrKeys ...string,
+) (ingressRule, bool) {
+	cidrs := make([]*Value, 0, len(cidrKeys))
+	for _, key := range cidrKeys {
+		cidrs = append(cidrs, rule.Get(key))
+	}
+
+	if !anyInternet(cidrs...) {
+		return ingressRule{}, false
+	}
+
+	ingress := ingressRule{res: res, line: rule.Line}
+
+	protocol := rule.Get(protocolKey).String()
+	if protocol == "-1" || strings.EqualFold(protocol, "all") {
+		ingress.ports = allPorts
+		return ingress, true
+	}
+
+	from, ok1 := rule.Get(fromKey).Int()
+	to, ok2 := rule.Get(toKey).Int()
+	if !ok1 || !ok2 {
+		return ingressRule{}, false
+	}
+
+	ingress.ports = []portRange{{from, to}}
+
+	return ingress, true
+}
+
+// internetIngressRules returns all firewall rules in the file that allow
+// traffic from the internet, for AWS security groups, Google Cloud firewalls
+// and Azure network security groups.
+func internetIngressRules(file *File) (rules []ingressRule) {
+	add := func(rule ingressRule, ok bool) {
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, res := range file.Resources {
+		switch res.Type {
+		case "aws_security_group":
+			for _, rule := range res.Body.Get("ingress").Items() {
+				add(awsIngressRule(res, rule, "from_port", "to_port", "protocol",
+					"cidr_blocks", "ipv6_cidr_blocks"))
+			}
+		case "aws_security_group_rule":
+			if res.Body.Get("type").String() == "ingress" {
+				add(awsIngressRule(res, res.Body, "from_port", "to_port", "protocol",
+					"cidr_blocks", "ipv6_cidr_blocks"))
+			}
+		case "aws_vpc_security_group_ingress_rule":
+			add(awsIngressRule(res, res.Body, "from_port", "to_port", "ip_protocol",
+				"cidr_ipv4", "cidr_ipv6"))
+		case "AWS::EC2::SecurityGroup":
+			for _, rule := range res.Body.Get("SecurityGroupIngress").Items() {
+				add(awsIngressRule(res, rule, "FromPort", "ToPort", "IpProtocol",
+					"CidrIp", "CidrIpv6"))
+			}
+		case "AWS::EC2::SecurityGroupIngress":
+			add(awsIngressRule(res, res.Body, "FromPort", "ToPort", "IpProtocol",
+				"CidrIp", "CidrIpv6"))
+		case "google_compute_firewall":
+			direction := res.Body.Get("direction").String()
+			if (direction != "" && !strings.EqualFold(direction, "INGRESS")) ||
+				!anyInternet(res.Body.Get("source_ranges")) {
+				continue
+			}
+
+			for _, allow := range res.Body.Get("allow").Items() {
+				ports, ok := parsePorts(allow.Get("ports").Strings())
+				if len(ports) == 0 || allow.Get("protocol").String() == "all" {
+					ports = allPorts
+				}
+
+				add(ingressRule{res: res, line: allow.Line, ports: ports}, ok)
+			}
+		case "azurerm_network_security_rule":
+			add(azureIngressRule(res, res.Body))
+		case "azurerm_network_security_group":
+			for _, rule := range res.Body.Get("security_rule").Items() {
+				add(azureIngressRule(res, rule))
+			}
+		}
+	}
+
+	return rules
+}
+
+func azureIngressRule(res Resource, rule *Value) (ingressRule, bool) {
+	if !strings.EqualFold(rule.Get("direction").String(), "Inbound") ||
+		!strings.EqualFold(rule.Get("access").String(), "Allow") ||
+		!anyInternet(rule.Get("source_address_prefix"), rule.Get("source_address_prefixes")) {
+		return ingressRule{}, false
+	}
+
+	specs := append(
+		rule.Get("destination_port_range").Strings(),
+		rule.Get("destination_port_ranges").Strings()...,
+	)
+
+	ports, ok := parsePorts(specs)
+	if !ok || len(ports) == 0 {
+		return ingressRule{}, false
+	}
+
+	return ingressRule{res: res, line: rule.Line, ports: ports}, true
+}
+
+// adminPorts are ports of remote administration protocols.
+var adminPorts = []struct {
+	port     int
+	protocol string
+}{
+	{22, "SSH"},
+	{3389, "RDP"},
+}
+
+func checkOpenAdminPorts(file *File) (findings []Finding) {
+	for _, rule := range internetIngressRules(file) {
+		var exposed []string
+		for _, admin := range adminPorts {
+			if rule.allows(admin.port) {
+				exposed = append(exposed, fmt.Sprintf("%s (port %d)", admin.protocol, admin.port))
+			}
+		}
+
+		if len(exposed) > 0 {
+			findings = append(findings, Finding{
+				Line:     rule.line,
+				Resource: rule.res.Address(),
+				Message:  fmt.Sprintf("allows %s from the internet", strings.Join(exposed, " and ")),
+			})
+		}
+	}
+
+	return findings
+}
+
+func checkOpenIngress(file *File) (findings []Finding) {
+RULES:
+	for _, rule := range internetIngressRules(file) {
+		for _, admin := range adminPorts {
+			if rule.allows(admin.port) {
+				// already reported by open-admin-port
+				continue RULES
+			}
+		}
+
+		var exposed []string
+		for _, ports := range rule.ports {
+			if (ports.from == 80 || ports.from == 443) && ports.from == ports.to {
+				continue
+			}
+
+			exposed = append(exposed, ports.String())
+		}
+
+		if len(exposed) > 0 {
+			findings = append(findings, Finding{
+				Line:     rule.line,
+				Resource: rule.res.Address(),
+				Message: fmt.Sprintf(
+					"allows port(s) %s from the internet",
+					strings.Join(exposed, ", "),
+				),
+			})
+		}
+	}
+
+	return findings
+}
+
+// policyStatements returns the statements of an IAM policy document, which
+// may be provided as a structure or as a JSON string.
+func policyStatements(doc *Value) []*Value {
+	if doc != nil && doc.Kind == StringValue {
+		doc = parseJSON(doc.Str, doc.Line)
+	}
+
+	return doc.Get("Statement").Items()
+}
+
+func isAllowStatement(stmt *Value, effectKey string) bool {
+	return !strings.EqualFold(stmt.Get(effectKey).String(), "Deny")
+}
+
+func isPublicPrincipal(principal *Value) bool {
+	if principal == nil {
+		return false
+	}
+
+	if principal.Kind == MapValue {
+		for _, key := range sortedKeys(principal) {
+			if containsString(principal.Map[key].Strings(), "*") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return containsString(principal.Strings(), "*")
+}
+
+var (
+	publicS3ACLs = map[string]bool{
+		"public-read":        true,
+		"public-read-write":  true,
+		"authenticated-read": true,
+		"PublicRead":         true,
+		"PublicReadWrite":    true,
+		"AuthenticatedRead":  true,
+	}
+
+	publicGCSMembers = map[string]bool{
+		"allUsers":              true,
+		"allAuthenticatedUsers": true,
+	}
+)
+
+func checkPublicBuckets(file *File) (findings []Finding) {
+	report := func(res Resource, line int, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Line:     line,
+			Resource: res.Address(),
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	checkAccessBlock := func(res Resource, block *Value, keys ...string) {
+		var disabled []string
+		for _, key := range keys {
+			if block.Get(key).IsFalse() {
+				disabled = append(disabled, key)
+			}
+		}
+
+		if len(disabled) > 0 {
+			report(res, block.Line, "public access block disables %s", strings.Join(disabled, ", "))
+		}
+	}
+
+	checkPolicy := func(res Resource, doc *Value) {
+		for _, stmt := range policyStatements(doc) {
+			if isAllowStatement(stmt, "Effect") && isPublicPrincipal(stmt.Get("Principal")) &&
+				stmt.Get("Condition") == nil {
+				report(res, stmt.Line, "bucket policy allows access to anyone")
+			}
+		}
+	}
+
+	for _, res := range file.Resources {
+		switch res.Type {
+		case "aws_s3_bucket", "aws_s3_bucket_acl":
+			if acl := res.Body.Get("acl"); publicS3ACLs[acl.String()] {
+				report(res, acl.Line, "grants public access with the %s ACL", acl)
+			}
+		case "aws_s3_bucket_public_access_block":
+			checkAccessBlock(res, res.Body, "block_public_acls", "block_public_policy",
+				"ignore_public_acls", "restrict_public_buckets")
+		case "aws_s3_bucket_policy":
+			checkPolicy(res, res.Body.Get("policy"))
+		case "google_storage_bucket_iam_member", "google_storage_bucket_iam_binding":
+			members := append(res.Body.Get("member").Strings(), res.Body.Get("members").Strings()...)
+			for _, member := range members {
+				if publicGCSMembers[member] {
+					report(res, res.Line, "grants access to %s", member)
+				}
+			}
+		case "google_storage_bucket_acl":
+			if acl := res.Body.Get("predefined_acl"); strings.HasPrefix(acl.String(), "public") {
+				report(res, acl.Line, "grants public access with the %s ACL", acl)
+			}
+		case "azurerm_storage_container":
+			if access := res.Body.Get("container_access_type"); access.String() == "blob" ||
+				access.String() == "container" {
+				report(res, access.Line, "allows anonymous access to %s data", access)
+			}
+		case "azurerm_storage_account":
+			if public := res.Body.Get("allow_nested_items_to_be_public"); public.IsTrue() {
+				report(res, public.Line, "allows containers and blobs to be public")
+			}
+		case "AWS::S3::Bucket":
+			if acl := res.Body.Get("AccessControl"); publicS3ACLs[acl.String()] {
+				report(res, acl.Line, "grants public access with the %s ACL", acl)
+			}
+
+			if block := res.Body.Get("PublicAccessBlockConfiguration"); block != nil {
+				checkAccessBlock(res, block, "BlockPublicAcls", "BlockPublicPolicy",
+					"IgnorePublicAcls", "RestrictPublicBuckets")
+			}
+		case "AWS::S3::BucketPolicy":
+			checkPolicy(res, res.Body.Get("PolicyDocument"))
+		}
+	}
+
+	return findings
+}
+
+func checkPublicDatabases(file *File) (findings []Finding) {
+	for _, res := range file.Resources {
+		var public *Value
+
+		switch res.Type {
+		case "aws_db_instance", "aws_rds_cluster_instance", "aws_redshift_cluster":
+			public = res.Body.Get("publicly_accessible")
+		case "AWS::RDS::DBInstance", "AWS::Redshift::Cluster":
+			public = res.Body.Get("PubliclyAccessible")
+		case "google_sql_database_instance":
+			for _, settings := range res.Body.Get("settings").Items() {
+				for _, ipConfig := range settings.Get("ip_configuration").Items() {
+					for _, network := range ipConfig.Get("authorized_networks").Items() {
+						if anyInternet(network.Get("value")) {
+							findings = append(findings, Finding{
+								Line:     network.Line,
+								Resource: res.Address(),
+								Message:  "authorizes connections from the entire internet",
+							})
+						}
+					}
+				}
+			}
+		}
+
+		if public.IsTrue() {
+			findings = append(findings, Finding{
+				Line:     public.Line,
+				Resource: res.Address(),
+				Message:  "database is publicly accessible",
+			})
+		}
+	}
+
+	return findings
+}
+
+// encryptionAttributes maps resource types to the attributes that enable
+// encryption at rest for them.
+var encryptionAttributes = map[string]string{
+	"aws_ebs_volume":                     "encrypted",
+	"aws_db_instance":                    "storage_encrypted",
+	"aws_rds_cluster":                    "storage_encrypted",
+	"aws_docdb_cluster":                  "storage_encrypted",
+	"aws_neptune_cluster":                "storage_encrypted",
+	"aws_efs_file_system":                "encrypted",
+	"aws_elasticache_replication_group":  "at_rest_encryption_enabled",
+	"AWS::EC2::Volume":                   "Encrypted",
+	"AWS::RDS::DBInstance":               "StorageEncrypted",
+	"AWS::RDS::DBCluster":                "StorageEncrypted",
+	"AWS::DocDB::DBCluster":              "StorageEncrypted",
+	"AWS::EFS::FileSystem":               "Encrypted",
+	"AWS::ElastiCache::ReplicationGroup": "AtRestEncryptionEnabled",
+}
+
+// inheritedEncryptionAttributes are attributes of database instances whose
+// storage (and encryption) is inherited from another database, e.g. read
+// replicas and Aurora cluster members.
+var inheritedEncryptionAttributes = []string{
+	"replicate_source_db",
+	"DBClusterIdentifier",
+	"SourceDBInstanceIdentifier",
+}
+
+func checkUnencryptedStorage(file *File) (findings []Finding) {
+	check := func(res Resource, body *Value, attr string) {
+		switch enabled := body.Get(attr); {
+		case enabled == nil:
+			findings = append(findings, Finding{
+				Line:     body.Line,
+				Resource: res.Address(),
+				Message:  fmt.Sprintf("storage is not encrypted at rest (%s is not set)", attr),
+			})
+		case enabled.IsKnown() && !enabled.IsTrue():
+			findings = append(findings, Finding{
+				Line:     enabled.Line,
+				Resource: res.Address(),
+				Message:  fmt.Sprintf("storage is not encrypted at rest (%s is %s)", attr, enabled),
+			})
+		}
+	}
+
+RESOURCES:
+	for _, res := range file.Resources {
+		if res.Format != FormatTerraform && res.Format != FormatCloudFormation {
+			continue
+		}
+
+		switch res.Type {
+		case "aws_instance":
+			for _, key := range []string{"root_block_device", "ebs_block_device"} {
+				for _, device := range res.Body.Get(key).Items() {
+					check(res, device, "encrypted")
+				}
+			}
+		case "AWS::EC2::Instance":
+			for _, mapping := range res.Body.Get("BlockDeviceMappings").Items() {
+				if ebs := mapping.Get("Ebs"); ebs != nil {
+					check(res, ebs, "Encrypted")
+				}
+			}
+		default:
+			attr, ok := encryptionAttributes[res.Type]
+			if !ok {
+				continue
+			}
+
+			for _, inherited := range inheritedEncryptionAttributes {
+				if res.Body.Get(inherited) != nil {
+					continue RESOURCES
+				}
+			}
+
+			check(res, res.Body, attr)
+		}
+	}
+
+	return findings
+}
+
+func checkWildcardActions(file *File) (findings []Finding) {
+	check := func(res Resource, stmts []*Value, effectKey, actionKey string) {
+		for _, stmt := range stmts {
+			if isAllowStatement(stmt, effectKey) && containsString(stmt.Get(actionKey).Strings(), "*") {
+				findings = append(findings, Finding{
+					Line:     stmt.Line,
+					Resource: res.Address(),
+					Message:  `policy allows all actions ("*")`,
+				})
+			}
+		}
+	}
+
+	for _, res := range file.Resources {
+		switch res.Format {
+		case FormatTerraform:
+			check(res, policyStatements(res.Body.Get("policy")), "Effect", "Action")
+			for _, inline := range res.Body.Get("inline_policy").Items() {
+				check(res, policyStatements(inline.Get("policy")), "Effect", "Action")
+			}
+
+			if res.Type == "data.aws_iam_policy_document" {
+				check(res, res.Body.Get("statement").Items(), "effect", "actions")
+			}
+		case FormatCloudFormation:
+			check(res, policyStatements(res.Body.Get("PolicyDocument")), "Effect", "Action")
+			for _, policy := range res.Body.Get("Policies").Items() {
+				check(res, policyStatements(policy.Get("PolicyDocument")), "Effect", "Action")
+			}
+		}
+	}
+
+	return findings
+}
+
+// podSpec returns the pod specification of a Kubernetes workload, or nil if
+// the resource is not a workload.
+func podSpec(res Resource) *Value {
+	if res.Format != FormatKubernetes {
+		return nil
+	}
+
+	switch res.Type {
+	case "Pod":
+		return res.Body.Get("spec")
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return res.Body.Get("spec", "template", "spec")
+	case "CronJob":
+		return res.Body.Get("spec", "jobTemplate", "spec", "template", "spec")
+	}
+
+	return nil
+}
+
+// containers returns all containers of a pod specification, including init
+// and ephemeral containers.
+func containers(spec *Value) (all []*Value) {
+	for _, key := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		all = append(all, spec.Get(key).Items()...)
+	}
+
+	return all
+}
+
+// checkPods calls fn for every workload in the file with its pod
+// specification, and returns the findings it produces, with their resource
+// set.
+func checkPods(file *File, fn func(spec *Value) []Finding) (findings []Finding) {
+	for _, res := range file.ResourcesOf(FormatKubernetes) {
+		spec := podSpec(res)
+		if spec == nil {
+			continue
+		}
+
+		for _, finding := range fn(spec) {
+			finding.Resource = res.Address()
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
+
+// dangerousCapabilities are Linux capabilities that practically grant full
+// control of the host.
+var dangerousCapabilities = map[string]bool{
+	"ALL":       true,
+	"SYS_ADMIN": true,
+}
+
+func checkPrivilegedContainers(file *File) []Finding {
+	return checkPods(file, func(spec *Value) (findings []Finding) {
+		for _, container := range containers(spec) {
+			secCtx := container.Get("securityContext")
+
+			if privileged := secCtx.Get("privileged"); privileged.IsTrue() {
+				findings = append(findings, Finding{
+					Line:    privileged.Line,
+					Message: fmt.Sprintf("container %s runs in privileged mode", container.Get("name")),
+				})
+			}
+
+			added := secCtx.Get("capabilities", "add")
+			for _, capability := range added.Strings() {
+				if dangerousCapabilities[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")] {
+					findings = append(findings, Finding{
+						Line: added.Line,
+						Message: fmt.Sprintf(
+							"container %s adds the %s capability",
+							container.Get("name"), capability,
+						),
+					})
+				}
+			}
+		}
+
+		return findings
+	})
+}
+
+func checkPrivilegeEscalation(file *File) []Finding {
+	return checkPods(file, func(spec *Value) (findings []Finding) {
+		for _, container := range containers(spec) {
+			allowed := container.Get("securityContext", "allowPrivilegeEscalation")
+			if allowed.IsTrue() {
+				findings = append(findings, Finding{
+					Line: allowed.Line,
+					Message: fmt.Sprintf(
+						"container %s allows privilege escalation",
+						container.Get("name"),
+					),
+				})
+			}
+		}
+
+		return findings
+	})
+}
+
+func checkHostNamespaces(file *File) []Finding {
+	namespaces := []struct{ key, name string }{
+		{"hostNetwork", "network"},
+		{"hostPID", "PID"},
+		{"hostIPC", "IPC"},
+	}
+
+	return checkPods(file, func(spec *Value) (findings []Finding) {
+		for _, ns := range namespaces {
+			if shared := spec.Get(ns.key); shared.IsTrue() {
+				findings = append(findings, Finding{
+					Line:    shared.Line,
+					Message: fmt.Sprintf("pod shares the host's %s namespace", ns.name),
+				})
+			}
+		}
+
+		return findings
+	})
+}
+
+func checkHostPathVolumes(file *File) []Finding {
+	return checkPods(file, func(spec *Value) (findings []Finding) {
+		for _, volume := range spec.Get("volumes").Items() {
+			if hostPath := volume.Get("hostPath"); hostPath != nil {
+				findings = append(findings, Finding{
+					Line: hostPath.Line,
+					Message: fmt.Sprintf(
+						"volume %s mounts host path %s",
+						volume.Get("name"), hostPath.Get("path"),
+					),
+				})
+			}
+		}
+
+		return findings
+	})
+}
+
+func checkRunAsRoot(file *File) []Finding {
+	return checkPods(file, func(spec *Value) (findings []Finding) {
+		if user, ok := spec.Get("securityContext", "runAsUser").Int(); ok && user == 0 {
+			findings = append(findings, Finding{
+				Line:    spec.Get("securityContext", "runAsUser").Line,
+				Message: "pod runs as root (runAsUser is 0)",
+			})
+		}
+
+		for _, container := range containers(spec) {
+			runAsUser := container.Get("securityContext", "runAsUser")
+			if user, ok := runAsUser.Int(); ok && user == 0 {
+				findings = append(findings, Finding{
+					Line:    runAsUser.Line,
+					Message: fmt.Sprintf("container %s runs as root (runAsUser is 0)", container.Get("name")),
+				})
+			}
+		}
+
+		return findings
+	})
+}
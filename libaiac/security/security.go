@@ -0,0 +1,213 @@
+// Package security implements static security checks for code generated by
+// LLM providers, finding common misconfigurations in Terraform,
+// CloudFormation and Kubernetes code (e.g. SSH open to the world, public
+// storage buckets or hard-coded credentials) before the code is used.
+package security
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// Severity is the severity of a security finding.
+type Severity int
+
+const (
+	// SeverityLow is used for findings that are worth reviewing, but are
+	// often acceptable.
+	SeverityLow Severity = iota + 1
+
+	// SeverityMedium is used for findings that weaken the security of the
+	// infrastructure and should usually be fixed.
+	SeverityMedium
+
+	// SeverityHigh is used for findings that expose the infrastructure to
+	// likely attacks and must be fixed.
+	SeverityHigh
+
+	// SeverityCritical is used for findings that are exploitable as-is, e.g.
+	// leaked credentials.
+	SeverityCritical
+)
+
+var severityNames = map[Severity]string{
+	SeverityLow:      "low",
+	SeverityMedium:   "medium",
+	SeverityHigh:     "high",
+	SeverityCritical: "critical",
+}
+
+// ParseSeverity parses the name of a severity level (one of "low", "medium",
+// "high" or "critical", case-insensitive).
+func ParseSeverity(name string) (Severity, error) {
+	for severity, severityName := range severityNames {
+		if strings.EqualFold(name, severityName) {
+			return severity, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w %q", types.ErrInvalidSeverity, name)
+}
+
+// String returns the name of the severity level.
+func (severity Severity) String() string {
+	if name, ok := severityNames[severity]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Severity(%d)", int(severity))
+}
+
+// MarshalText encodes the severity as its name.
+func (severity Severity) MarshalText() ([]byte, error) {
+	return []byte(severity.String()), nil
+}
+
+// UnmarshalText decodes a severity from its name.
+func (severity *Severity) UnmarshalText(text []byte) (err error) {
+	*severity, err = ParseSeverity(string(text))
+	return err
+}
+
+// Finding is a single security problem found in generated code.
+type Finding struct {
+	// Rule is the ID of the rule that produced the finding, e.g.
+	// "open-admin-port".
+	Rule string `json:"rule"`
+
+	// Severity is the severity of the finding.
+	Severity Severity `json:"severity"`
+
+	// File is the name of the file (or code block) the problem was found in.
+	File string `json:"file"`
+
+	// Line is the line number of the problem, starting at 1. Zero if unknown.
+	Line int `json:"line,omitempty"`
+
+	// Resource is the address of the resource the problem was found in, if
+	// any, e.g. "aws_s3_bucket.logs" or "Deployment/web".
+	Resource string `json:"resource,omitempty"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// String returns a textual representation of the finding in the common
+// "file:line: severity: message" format.
+func (finding Finding) String() string {
+	loc := finding.File
+	if finding.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", loc, finding.Line)
+	}
+
+	msg := finding.Message
+	if finding.Resource != "" {
+		msg = fmt.Sprintf("%s: %s", finding.Resource, msg)
+	}
+
+	return fmt.Sprintf("%s: %s: %s [%s]", loc, finding.Severity, msg, finding.Rule)
+}
+
+// Rule is a security check that is run over every file in a response.
+type Rule struct {
+	// ID uniquely identifies the rule, e.g. "public-bucket".
+	ID string
+
+	// Severity is the severity of all findings produced by the rule.
+	Severity Severity
+
+	// Description is a short description of the problems the rule finds.
+	Description string
+
+	// Check inspects a file and returns the problems found. The Rule,
+	// Severity and File fields of the returned findings do not need to be set,
+	// they are filled in by the scanner.
+	Check func(file *File) []Finding
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Rules are the rules to check. Optional, defaults to the built-in rules
+	// (see Rules).
+	Rules []Rule
+}
+
+// Scanner runs security rules over the code blocks of responses.
+type Scanner struct {
+	rules []Rule
+}
+
+// New creates a new Scanner with the provided options. opts may be nil, in
+// which case the built-in rules are used.
+func New(opts *Options) *Scanner {
+	scanner := &Scanner{rules: builtinRules}
+	if opts != nil && opts.Rules != nil {
+		scanner.rules = opts.Rules
+	}
+
+	return scanner
+}
+
+// Scan runs the built-in rules over all code blocks in the provided response,
+// and returns all findings, ordered by code block and line number.
+func Scan(res types.Response) []Finding {
+	return New(nil).Scan(res)
+}
+
+// Scan runs the scanner's rules over all code blocks in the provided response,
+// and returns all findings, ordered by code block and line number.
+func (scanner *Scanner) Scan(res types.Response) (findings []Finding) {
+	for i, block := range res.Files {
+		name := block.Filename
+		if name == "" {
+			name = fmt.Sprintf("code block %d", i+1)
+		}
+
+		findings = append(findings, scanner.ScanBlock(name, block)...)
+	}
+
+	return findings
+}
+
+// ScanBlock runs the scanner's rules over a single code block, and returns all
+// findings, ordered by line number. The provided name is used as the file name
+// of the findings.
+func (scanner *Scanner) ScanBlock(name string, block types.CodeBlock) (findings []Finding) {
+	file := parseFile(name, block)
+
+	for _, rule := range scanner.rules {
+		for _, finding := range rule.Check(file) {
+			finding.Rule = rule.ID
+			finding.Severity = rule.Severity
+			finding.File = name
+			findings = append(findings, finding)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+
+	return findings
+}
+
+// Rules returns the built-in rules.
+func Rules() []Rule {
+	return append([]Rule(nil), builtinRules...)
+}
+
+// AtLeast returns the findings whose severity is at least the provided
+// severity.
+func AtLeast(findings []Finding, severity Severity) (filtered []Finding) {
+	for _, finding := range findings {
+		if finding.Severity >= severity {
+			filtered = append(filtered, finding)
+		}
+	}
+
+	return filtered
+}
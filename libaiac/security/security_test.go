@@ -0,0 +1,102 @@
+package security_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/security"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    security.Severity
+		wantErr error
+	}{
+		{name: "low", want: security.SeverityLow},
+		{name: "Medium", want: security.SeverityMedium},
+		{name: "HIGH", want: security.SeverityHigh},
+		{name: "critical", want: security.SeverityCritical},
+		{name: "severe", wantErr: types.ErrInvalidSeverity},
+		{name: "", wantErr: types.ErrInvalidSeverity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := security.ParseSeverity(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSeverityText(t *testing.T) {
+	text, err := security.SeverityHigh.MarshalText()
+	if err != nil || string(text) != "high" {
+		t.Fatalf("expected \"high\", got %q (%v)", text, err)
+	}
+
+	var severity security.Severity
+	if err := severity.UnmarshalText([]byte("low")); err != nil || severity != security.SeverityLow {
+		t.Errorf("expected low, got %s (%v)", severity, err)
+	}
+
+	if got := security.Severity(42).String(); got != "Severity(42)" {
+		t.Errorf("unexpected name for unknown severity: %q", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	output := "```hcl\n" +
+		"resource \"aws_db_instance\" \"db\" {\n" +
+		"  storage_encrypted   = true\n" +
+		"  publicly_accessible = true\n" +
+		"  password            = \"hunter22\"\n" +
+		"}\n" +
+		"```\n" +
+		"```yaml\n" +
+		"# pod.yaml\n" +
+		"apiVersion: v1\n" +
+		"kind: Pod\n" +
+		"metadata:\n" +
+		"  name: web\n" +
+		"spec:\n" +
+		"  securityContext:\n" +
+		"    runAsUser: 0\n" +
+		"  containers:\n" +
+		"    - name: web\n" +
+		"```\n"
+
+	findings := security.Scan(types.Response{Files: types.ExtractFiles(output)})
+
+	want := []string{
+		"code block 1:3: high: aws_db_instance.db: database is publicly accessible [public-database]",
+		"code block 1:4: high: aws_db_instance.db: password is set to a plaintext value [plaintext-secret]",
+		"pod.yaml:8: low: Pod/web: pod runs as root (runAsUser is 0) [run-as-root]",
+	}
+
+	if len(findings) != len(want) {
+		t.Fatalf("expected %d findings, got %d: %v", len(want), len(findings), findings)
+	}
+
+	for i, finding := range findings {
+		if got := finding.String(); got != want[i] {
+			t.Errorf("expected finding %d to be %q, got %q", i+1, want[i], got)
+		}
+	}
+
+	high := security.AtLeast(findings, security.SeverityHigh)
+	if len(high) != 2 {
+		t.Errorf("expected 2 findings of high severity, got %v", high)
+	}
+
+	if critical := security.AtLeast(findings, security.SeverityCritical); len(critical) != 0 {
+		t.Errorf("expected no critical findings, got %v", critical)
+	}
+}
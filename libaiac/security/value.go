@@ -0,0 +1,336 @@
+package security
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// ValueKind is the kind of a Value.
+type ValueKind int
+
+const (
+	// NullValue is an empty or null value.
+	NullValue ValueKind = iota
+
+	// StringValue is a string.
+	StringValue
+
+	// NumberValue is a number.
+	NumberValue
+
+	// BoolValue is a boolean.
+	BoolValue
+
+	// ListValue is a list of values, e.g. a YAML sequence or repeated
+	// Terraform blocks of the same type.
+	ListValue
+
+	// MapValue is a map of values, e.g. a YAML mapping or the body of a
+	// Terraform block.
+	MapValue
+
+	// ExprValue is an expression whose value cannot be determined statically,
+	// e.g. a reference to a Terraform variable or a CloudFormation intrinsic
+	// function.
+	ExprValue
+)
+
+// Value is a format-independent representation of configuration values,
+// allowing rules to inspect Terraform, CloudFormation and Kubernetes code in
+// the same way. All methods are safe to call on a nil Value.
+type Value struct {
+	// Kind is the kind of the value.
+	Kind ValueKind
+
+	// Line is the line number where the value is defined.
+	Line int
+
+	// Str is the value of strings, the textual representation of numbers and
+	// booleans, and the source code of expressions.
+	Str string
+
+	// List contains the items of lists.
+	List []*Value
+
+	// Map contains the items of maps.
+	Map map[string]*Value
+}
+
+// Get returns the value at the provided path of map keys, or nil if it does
+// not exist.
+func (v *Value) Get(path ...string) *Value {
+	for _, key := range path {
+		if v == nil || v.Kind != MapValue {
+			return nil
+		}
+
+		v = v.Map[key]
+	}
+
+	return v
+}
+
+// Items returns the items of a list. Other values are returned as a list of
+// one item, and nil as an empty list.
+func (v *Value) Items() []*Value {
+	switch {
+	case v == nil || v.Kind == NullValue:
+		return nil
+	case v.Kind == ListValue:
+		return v.List
+	default:
+		return []*Value{v}
+	}
+}
+
+// Strings returns the scalar items of the value (see Items) as strings.
+func (v *Value) Strings() (strs []string) {
+	for _, item := range v.Items() {
+		if item.IsScalar() {
+			strs = append(strs, item.Str)
+		}
+	}
+
+	return strs
+}
+
+// String returns the Str field of the value, or an empty string if the value
+// is nil.
+func (v *Value) String() string {
+	if v == nil {
+		return ""
+	}
+
+	return v.Str
+}
+
+// IsScalar returns true if the value is a string, number or boolean.
+func (v *Value) IsScalar() bool {
+	return v != nil && (v.Kind == StringValue || v.Kind == NumberValue || v.Kind == BoolValue)
+}
+
+// IsKnown returns true if the value is defined and not an expression.
+func (v *Value) IsKnown() bool {
+	return v != nil && v.Kind != ExprValue
+}
+
+// IsTrue returns true if the value is the boolean true, or the string "true".
+func (v *Value) IsTrue() bool {
+	return v.IsScalar() && strings.EqualFold(v.Str, "true")
+}
+
+// IsFalse returns true if the value is the boolean false, or the string
+// "false".
+func (v *Value) IsFalse() bool {
+	return v.IsScalar() && strings.EqualFold(v.Str, "false")
+}
+
+// Int returns the value as an integer, if it is a number or a string
+// containing an integer.
+func (v *Value) Int() (int, bool) {
+	if !v.IsScalar() {
+		return 0, false
+	}
+
+	i, err := strconv.Atoi(v.Str)
+	return i, err == nil
+}
+
+// fromHCLBody converts the body of a Terraform block to a map. Nested blocks
+// are converted to lists of maps, keyed by their type.
+func fromHCLBody(body *hclsyntax.Body, src []byte, line int) *Value {
+	v := &Value{Kind: MapValue, Line: line, Map: make(map[string]*Value)}
+
+	for name, attr := range body.Attributes {
+		v.Map[name] = fromHCLExpr(attr.Expr, src)
+	}
+
+	for _, block := range body.Blocks {
+		list, ok := v.Map[block.Type]
+		if !ok || list.Kind != ListValue {
+			list = &Value{Kind: ListValue, Line: block.TypeRange.Start.Line}
+			v.Map[block.Type] = list
+		}
+
+		list.List = append(list.List, fromHCLBody(block.Body, src, block.TypeRange.Start.Line))
+	}
+
+	return v
+}
+
+// fromHCLExpr converts an HCL expression to a value. Object and tuple
+// constructors (including those wrapped in jsonencode, as commonly done for
+// IAM policies) are converted structurally, so that their known parts can be
+// inspected even if other parts reference variables. Other expressions are
+// evaluated without any variables, and become ExprValues if that fails.
+func fromHCLExpr(expr hclsyntax.Expression, src []byte) *Value {
+	line := expr.Range().Start.Line
+
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		v := &Value{Kind: MapValue, Line: line, Map: make(map[string]*Value)}
+		for _, item := range e.Items {
+			key, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() || !key.IsKnown() || key.IsNull() || key.Type() != cty.String {
+				continue
+			}
+
+			v.Map[key.AsString()] = fromHCLExpr(item.ValueExpr, src)
+		}
+
+		return v
+	case *hclsyntax.TupleConsExpr:
+		v := &Value{Kind: ListValue, Line: line}
+		for _, item := range e.Exprs {
+			v.List = append(v.List, fromHCLExpr(item, src))
+		}
+
+		return v
+	case *hclsyntax.FunctionCallExpr:
+		if e.Name == "jsonencode" && len(e.Args) == 1 {
+			return fromHCLExpr(e.Args[0], src)
+		}
+	}
+
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || !val.IsWhollyKnown() {
+		return &Value{
+			Kind: ExprValue,
+			Line: line,
+			Str:  string(expr.Range().SliceBytes(src)),
+		}
+	}
+
+	if bytes.HasPrefix(expr.Range().SliceBytes(src), []byte("<<")) {
+		// heredoc contents start on the line after the opening marker
+		line++
+	}
+
+	return fromCty(val, line)
+}
+
+func fromCty(val cty.Value, line int) *Value {
+	if val.IsNull() {
+		return &Value{Kind: NullValue, Line: line}
+	}
+
+	typ := val.Type()
+
+	switch {
+	case typ == cty.String:
+		return &Value{Kind: StringValue, Line: line, Str: val.AsString()}
+	case typ == cty.Number:
+		return &Value{Kind: NumberValue, Line: line, Str: val.AsBigFloat().Text('f', -1)}
+	case typ == cty.Bool:
+		return &Value{Kind: BoolValue, Line: line, Str: strconv.FormatBool(val.True())}
+	case typ.IsListType() || typ.IsTupleType() || typ.IsSetType():
+		v := &Value{Kind: ListValue, Line: line}
+		for it := val.ElementIterator(); it.Next(); {
+			_, item := it.Element()
+			v.List = append(v.List, fromCty(item, line))
+		}
+
+		return v
+	case typ.IsMapType() || typ.IsObjectType():
+		v := &Value{Kind: MapValue, Line: line, Map: make(map[string]*Value)}
+		for it := val.ElementIterator(); it.Next(); {
+			key, item := it.Element()
+			v.Map[key.AsString()] = fromCty(item, line)
+		}
+
+		return v
+	}
+
+	return &Value{Kind: ExprValue, Line: line}
+}
+
+// fromYAML converts a YAML node (which may also have been parsed from JSON) to
+// a value. Nodes with custom tags (e.g. CloudFormation's "!Ref") and
+// CloudFormation intrinsic functions in their long form (e.g. {"Ref": "x"})
+// become ExprValues.
+func fromYAML(node *yaml.Node, lineOffset int) *Value {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return &Value{Kind: NullValue, Line: node.Line + lineOffset}
+		}
+
+		return fromYAML(node.Content[0], lineOffset)
+	}
+
+	line := node.Line + lineOffset
+	tag := node.ShortTag()
+
+	if !strings.HasPrefix(tag, "!!") {
+		return &Value{Kind: ExprValue, Line: line, Str: tag + " " + node.Value}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 2 && isIntrinsicFunction(node.Content[0].Value) {
+			return &Value{Kind: ExprValue, Line: line, Str: node.Content[0].Value}
+		}
+
+		v := &Value{Kind: MapValue, Line: line, Map: make(map[string]*Value)}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, item := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+
+			child := fromYAML(item, lineOffset)
+			if child.Kind == MapValue || child.Kind == ListValue {
+				// report problems in nested structures at the line of
+				// their key, rather than their first item
+				child.Line = key.Line + lineOffset
+			}
+
+			v.Map[key.Value] = child
+		}
+
+		return v
+	case yaml.SequenceNode:
+		v := &Value{Kind: ListValue, Line: line}
+		for _, item := range node.Content {
+			v.List = append(v.List, fromYAML(item, lineOffset))
+		}
+
+		return v
+	}
+
+	switch tag {
+	case "!!null":
+		return &Value{Kind: NullValue, Line: line}
+	case "!!bool":
+		return &Value{Kind: BoolValue, Line: line, Str: strings.ToLower(node.Value)}
+	case "!!int", "!!float":
+		return &Value{Kind: NumberValue, Line: line, Str: node.Value}
+	}
+
+	return &Value{Kind: StringValue, Line: line, Str: node.Value}
+}
+
+func isIntrinsicFunction(key string) bool {
+	return key == "Ref" || key == "Condition" || strings.HasPrefix(key, "Fn::")
+}
+
+// parseJSON parses a string containing a JSON document (e.g. an IAM policy
+// embedded in a Terraform string) into a value. The line numbers of the
+// document are offset by the provided line number. Nil is returned if the
+// string is not valid JSON (or YAML).
+func parseJSON(str string, line int) *Value {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(str), &node); err != nil {
+		return nil
+	}
+
+	return fromYAML(&node, line-1)
+}
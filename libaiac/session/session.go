@@ -0,0 +1,247 @@
+// Package session implements persistent storage of conversations with LLM
+// providers, allowing them to be resumed at a later time. Sessions are stored
+// as JSON files, one per session, by default under the user's data directory
+// based on the XDG specification.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// Session is a conversation persisted to disk.
+type Session struct {
+	// Name is the unique name of the session.
+	Name string `json:"name"`
+
+	// Backend is the name of the backend used in the conversation.
+	Backend string `json:"backend"`
+
+	// Model is the name of the model used in the conversation.
+	Model string `json:"model"`
+
+	// Messages are all the messages exchanged in the conversation, including
+	// system prompts, in order.
+	Messages []types.Message `json:"messages"`
+
+	// Responses are all the responses received in the conversation, in order.
+	Responses []types.Response `json:"responses"`
+
+	// CreatedAt is the time the session was created.
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt is the time the session was last saved.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Record updates the session with the current messages of a conversation and
+// the latest response received in it. The backend and model that generated
+// the response, if known, are recorded as well, so that the session is resumed
+// with the same backend and model.
+func (sess *Session) Record(msgs []types.Message, res types.Response) {
+	sess.Messages = msgs
+	sess.Responses = append(sess.Responses, res)
+
+	if res.Backend != "" {
+		sess.Backend = res.Backend
+	}
+
+	if res.Model != "" {
+		sess.Model = res.Model
+	}
+}
+
+// Store is a directory of persisted sessions.
+type Store struct {
+	dir string
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Dir is the directory in which sessions are stored. Defaults to
+	// "aiac/sessions" under the XDG data directory. On Unix-like operating
+	// systems, this will be ~/.local/share/aiac/sessions.
+	Dir string
+}
+
+// New creates a new instance of the Store struct, with the provided input
+// options. The directory is only created when a session is first saved.
+func New(opts *Options) *Store {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(xdg.DataHome, "aiac", "sessions")
+	}
+
+	return &Store{dir: opts.Dir}
+}
+
+// Dir returns the directory in which sessions are stored.
+func (store *Store) Dir() string {
+	return store.dir
+}
+
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidName returns true if the provided session name is valid. Names must
+// start with a letter or digit, and may only contain letters, digits, dots,
+// dashes and underscores.
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+func (store *Store) path(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("%w %q", types.ErrInvalidSessionName, name)
+	}
+
+	return filepath.Join(store.dir, name+".json"), nil
+}
+
+// Load loads the session with the provided name. If the session does not
+// exist, an error wrapping types.ErrNoSuchSession is returned.
+func (store *Store) Load(name string) (sess *Session, err error) {
+	path, err := store.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w %s", types.ErrNoSuchSession, name)
+		}
+		return nil, fmt.Errorf("failed reading session %s: %w", name, err)
+	}
+
+	sess = &Session{}
+	err = json.Unmarshal(data, sess)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding session %s: %w", name, err)
+	}
+
+	return sess, nil
+}
+
+// Open is the same as Load, but returns a new, empty session if one with the
+// provided name does not exist. The new session is not saved until Save is
+// called.
+func (store *Store) Open(name string) (sess *Session, err error) {
+	sess, err = store.Load(name)
+	if errors.Is(err, types.ErrNoSuchSession) {
+		return &Session{Name: name, CreatedAt: time.Now()}, nil
+	}
+
+	return sess, err
+}
+
+// Save persists the provided session, overwriting any previous version of it.
+// The file is replaced atomically, so an interrupted save will not corrupt
+// an existing session.
+func (store *Store) Save(sess *Session) error {
+	path, err := store.path(sess.Name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(store.dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed creating sessions directory: %w", err)
+	}
+
+	if sess.CreatedAt.IsZero() {
+		sess.CreatedAt = time.Now()
+	}
+	sess.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding session %s: %w", sess.Name, err)
+	}
+
+	tmp, err := os.CreateTemp(store.dir, "."+sess.Name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed saving session %s: %w", sess.Name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed saving session %s: %w", sess.Name, err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed saving session %s: %w", sess.Name, err)
+	}
+
+	return nil
+}
+
+// List returns all sessions in the store, most recently updated first. If the
+// store's directory does not exist, an empty list is returned.
+func (store *Store) List() (sessions []*Session, err error) {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return sessions, nil
+		}
+		return nil, fmt.Errorf("failed listing sessions: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || name == entry.Name() || !ValidName(name) {
+			continue
+		}
+
+		sess, err := store.Load(name)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// Delete deletes the session with the provided name. If the session does not
+// exist, an error wrapping types.ErrNoSuchSession is returned.
+func (store *Store) Delete(name string) error {
+	path, err := store.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w %s", types.ErrNoSuchSession, name)
+		}
+		return fmt.Errorf("failed deleting session %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/mock"
+	"github.com/gofireflyio/aiac/v5/libaiac/session"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "infra", want: true},
+		{name: "infra-2024_01.v2", want: true},
+		{name: "9lives", want: true},
+		{name: ""},
+		{name: ".hidden"},
+		{name: "-flag"},
+		{name: "../escape"},
+		{name: "with space"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := session.ValidName(tt.name); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	backend, err := mock.New(&mock.Options{Fixtures: []mock.Fixture{
+		{Prompt: "first", Response: "one", TokensUsed: 3},
+		{Prompt: "second", Response: "two"},
+	}})
+	if err != nil {
+		t.Fatalf("failed creating mock backend: %s", err)
+	}
+
+	store := session.New(&session.Options{Dir: filepath.Join(t.TempDir(), "sessions")})
+
+	sess, err := store.Open("infra")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if sess.Name != "infra" || len(sess.Messages) != 0 || sess.CreatedAt.IsZero() {
+		t.Fatalf("expected a new session, got %+v", sess)
+	}
+
+	conv := backend.Chat("mock-model", types.Message{Role: "system", Content: "be terse"})
+
+	res, err := conv.Send(context.Background(), "first")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	res.Backend, res.Model = "mock", "mock-model"
+	sess.Record(conv.Messages(), res)
+
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("failed saving session: %s", err)
+	}
+
+	loaded, err := store.Load("infra")
+	if err != nil {
+		t.Fatalf("failed loading session: %s", err)
+	}
+
+	if loaded.Backend != "mock" || loaded.Model != "mock-model" {
+		t.Errorf("expected backend and model to be recorded, got %s/%s", loaded.Backend, loaded.Model)
+	}
+
+	if len(loaded.Responses) != 1 || loaded.Responses[0].TokensUsed != 3 {
+		t.Errorf("unexpected responses %+v", loaded.Responses)
+	}
+
+	if loaded.UpdatedAt.IsZero() || !loaded.CreatedAt.Equal(sess.CreatedAt) {
+		t.Errorf("unexpected timestamps %s, %s", loaded.CreatedAt, loaded.UpdatedAt)
+	}
+
+	// resume the conversation from the loaded session
+	resumed := backend.Chat(loaded.Model, loaded.Messages...)
+	if _, err := resumed.Send(context.Background(), "second"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	reqs := backend.Requests()
+	want := []types.Message{
+		{Role: "system", Content: "be terse"},
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "one"},
+		{Role: "user", Content: "second"},
+	}
+
+	got := reqs[len(reqs)-1].Messages
+	if len(got) != len(want) {
+		t.Fatalf("expected resumed conversation to send %d messages, got %v", len(want), got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected message %d to be %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store := session.New(&session.Options{Dir: dir})
+
+	sessions, err := store.List()
+	if err != nil || len(sessions) != 0 {
+		t.Fatalf("expected no sessions, got %v (%v)", sessions, err)
+	}
+
+	for _, name := range []string{"older", "newer"} {
+		if err := store.Save(&session.Session{Name: name}); err != nil {
+			t.Fatalf("failed saving session %s: %s", name, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// files that are not sessions are ignored
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err = store.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(sessions) != 2 || sessions[0].Name != "newer" || sessions[1].Name != "older" {
+		t.Errorf("expected sessions ordered by update time, got %+v", sessions)
+	}
+
+	if err := store.Delete("older"); err != nil {
+		t.Fatalf("failed deleting session: %s", err)
+	}
+
+	if _, err := store.Load("older"); !errors.Is(err, types.ErrNoSuchSession) {
+		t.Errorf("expected error %q when loading a deleted session, got %v", types.ErrNoSuchSession, err)
+	}
+
+	if err := store.Delete("older"); !errors.Is(err, types.ErrNoSuchSession) {
+		t.Errorf("expected error %q when deleting a deleted session, got %v", types.ErrNoSuchSession, err)
+	}
+
+	if _, err := store.Load("../newer"); !errors.Is(err, types.ErrInvalidSessionName) {
+		t.Errorf("expected error %q when loading ../newer, got %v", types.ErrInvalidSessionName, err)
+	}
+
+	if err := store.Save(&session.Session{Name: "a/b"}); !errors.Is(err, types.ErrInvalidSessionName) {
+		t.Errorf("expected error %q when saving a/b, got %v", types.ErrInvalidSessionName, err)
+	}
+
+	if _, err := store.Open(""); !errors.Is(err, types.ErrInvalidSessionName) {
+		t.Errorf("expected error %q when opening an unnamed session, got %v", types.ErrInvalidSessionName, err)
+	}
+}
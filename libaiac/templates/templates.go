@@ -0,0 +1,250 @@
+// Package templates implements reusable prompt templates with named
+// variables. Templates are written in the syntax of Go's text/template
+// package, and are either stored as files in a templates directory (by
+// default under the user's configuration directory based on the XDG
+// specification), or declared inline in the configuration file.
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/adrg/xdg"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// Extension is the file extension of templates stored in a templates
+// directory.
+const Extension = ".tmpl"
+
+// Template is a parsed prompt template.
+type Template struct {
+	// Name is the name of the template.
+	Name string
+
+	// Source is the path of the file the template was loaded from, or an
+	// empty string for templates declared inline.
+	Source string
+
+	// Text is the unparsed text of the template.
+	Text string
+
+	tmpl *template.Template
+}
+
+// funcs are the functions available in templates, in addition to the
+// built-in functions of the text/template package. The "required" function is
+// redefined on rendering, as it depends on the variables provided (see
+// Template.Render).
+var funcs = template.FuncMap{
+	"required": func(string) (string, error) { return "", nil },
+	"default": func(def string, val interface{}) interface{} {
+		if val == nil || val == "" {
+			return def
+		}
+		return val
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"split": strings.Split,
+	"join": func(sep string, items []string) string {
+		return strings.Join(items, sep)
+	},
+}
+
+// Parse parses the text of a template with the provided name.
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing template %s: %w", name, err)
+	}
+
+	return &Template{Name: name, Text: text, tmpl: tmpl}, nil
+}
+
+// Render renders the template with the provided variables, which are
+// available in the template as fields of the dot, e.g. {{ .cloud }}. Missing
+// variables are rendered as empty strings, allowing templates to provide
+// default values, e.g. {{ .region | default "us-east-1" }}. Variables that
+// are required can be checked with the "required" function, e.g.
+// {{ required "cloud" }}, which fails rendering with an error wrapping
+// types.ErrMissingVariable if the variable is not provided.
+func (tmpl *Template) Render(vars map[string]string) (string, error) {
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+
+	t, err := tmpl.tmpl.Clone()
+	if err != nil {
+		return "", fmt.Errorf("failed rendering template %s: %w", tmpl.Name, err)
+	}
+
+	var missing string
+	t.Funcs(template.FuncMap{
+		"required": func(name string) (string, error) {
+			val, ok := vars[name]
+			if !ok || val == "" {
+				missing = name
+				return "", fmt.Errorf("%w %q", types.ErrMissingVariable, name)
+			}
+			return val, nil
+		},
+	})
+
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		if missing != "" {
+			// report missing variables without text/template's details
+			return "", fmt.Errorf(
+				"failed rendering template %s: %w %q",
+				tmpl.Name, types.ErrMissingVariable, missing,
+			)
+		}
+
+		return "", fmt.Errorf("failed rendering template %s: %w", tmpl.Name, err)
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// ParseVars parses variables provided in the format "name=value", as accepted
+// by the command line tool. Returns an error wrapping types.ErrInvalidVariable
+// if a variable is not in this format.
+func ParseVars(list []string) (map[string]string, error) {
+	vars := make(map[string]string, len(list))
+	for _, item := range list {
+		name, val, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%w %q, expected name=value", types.ErrInvalidVariable, item)
+		}
+
+		vars[strings.TrimSpace(name)] = val
+	}
+
+	return vars, nil
+}
+
+// Store is a collection of templates, stored in a directory or declared
+// inline.
+type Store struct {
+	dir    string
+	inline map[string]string
+}
+
+// Options is a struct containing all the parameters accepted by the New
+// constructor.
+type Options struct {
+	// Dir is the directory in which template files are stored, with the
+	// ".tmpl" extension (e.g. "tf-module.tmpl" for the template "tf-module").
+	// Defaults to "aiac/templates" under the XDG configuration directory. On
+	// Unix-like operating systems, this will be ~/.config/aiac/templates.
+	Dir string
+
+	// Inline is a map of template names to template texts, e.g. as declared
+	// in the configuration file. Inline templates take precedence over
+	// template files of the same name.
+	Inline map[string]string
+}
+
+// New creates a new instance of the Store struct, with the provided input
+// options.
+func New(opts *Options) *Store {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(xdg.ConfigHome, "aiac", "templates")
+	}
+
+	return &Store{dir: opts.Dir, inline: opts.Inline}
+}
+
+// Dir returns the directory in which template files are stored.
+func (store *Store) Dir() string {
+	return store.dir
+}
+
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Load loads and parses the template with the provided name. If the template
+// does not exist, an error wrapping types.ErrNoSuchTemplate is returned.
+func (store *Store) Load(name string) (*Template, error) {
+	if text, ok := store.inline[name]; ok {
+		return Parse(name, text)
+	}
+
+	if !nameRegex.MatchString(name) {
+		return nil, fmt.Errorf("%w %s", types.ErrNoSuchTemplate, name)
+	}
+
+	path := filepath.Join(store.dir, name+Extension)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w %s", types.ErrNoSuchTemplate, name)
+		}
+		return nil, fmt.Errorf("failed reading template %s: %w", name, err)
+	}
+
+	tmpl, err := Parse(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.Source = path
+
+	return tmpl, nil
+}
+
+// Render is a shortcut for loading the template with the provided name and
+// rendering it with the provided variables.
+func (store *Store) Render(name string, vars map[string]string) (string, error) {
+	tmpl, err := store.Load(name)
+	if err != nil {
+		return "", err
+	}
+
+	return tmpl.Render(vars)
+}
+
+// List returns the names of all templates in the store, sorted
+// alphabetically. If the store's directory does not exist, only inline
+// templates are returned.
+func (store *Store) List() (names []string, err error) {
+	seen := make(map[string]bool)
+	for name := range store.inline {
+		seen[name] = true
+	}
+
+	entries, err := os.ReadDir(store.dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed reading templates directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), Extension)
+		if entry.Type().IsRegular() && name != entry.Name() && nameRegex.MatchString(name) {
+			seen[name] = true
+		}
+	}
+
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,216 @@
+package templates_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/templates"
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "variables",
+			text: "generate {{ .tool }} for {{ .cloud }}",
+			vars: map[string]string{"tool": "terraform", "cloud": "aws"},
+			want: "generate terraform for aws",
+		},
+		{
+			name: "missing variable",
+			text: "generate terraform for {{ .cloud }}",
+			want: "generate terraform for",
+		},
+		{
+			name: "default value",
+			text: `region {{ .region | default "us-east-1" }}`,
+			want: "region us-east-1",
+		},
+		{
+			name: "default value overridden",
+			text: `region {{ .region | default "us-east-1" }}`,
+			vars: map[string]string{"region": "eu-west-1"},
+			want: "region eu-west-1",
+		},
+		{
+			name: "required variable",
+			text: `generate terraform for {{ required "cloud" }}`,
+			vars: map[string]string{"cloud": "gcp"},
+			want: "generate terraform for gcp",
+		},
+		{
+			name:    "required variable missing",
+			text:    `generate terraform for {{ required "cloud" }}`,
+			wantErr: types.ErrMissingVariable,
+		},
+		{
+			name:    "required variable empty",
+			text:    `generate terraform for {{ required "cloud" }}`,
+			vars:    map[string]string{"cloud": ""},
+			wantErr: types.ErrMissingVariable,
+		},
+		{
+			name: "functions",
+			text: `{{ upper .a }} {{ lower .b }} {{ trim .c }} {{ split .d "," | join "+" }}`,
+			vars: map[string]string{"a": "x", "b": "Y", "c": "  z  ", "d": "1,2"},
+			want: "X y z 1+2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := templates.Parse(tt.name, tt.text)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			got, err := tmpl.Render(tt.vars)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := templates.Parse("broken", "{{ .cloud "); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    []string
+		want    map[string]string
+		wantErr error
+	}{
+		{
+			name: "valid",
+			list: []string{"cloud=aws", " region =us-east-1", "empty=", "expr=a=b"},
+			want: map[string]string{
+				"cloud":  "aws",
+				"region": "us-east-1",
+				"empty":  "",
+				"expr":   "a=b",
+			},
+		},
+		{
+			name:    "missing separator",
+			list:    []string{"cloud"},
+			wantErr: types.ErrInvalidVariable,
+		},
+		{
+			name:    "missing name",
+			list:    []string{"=aws"},
+			wantErr: types.ErrInvalidVariable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := templates.ParseVars(tt.list)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"tf-module" + templates.Extension: "module for {{ .cloud }}",
+		"shared" + templates.Extension:    "from file",
+		"notes.txt":                       "ignored",
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := templates.New(&templates.Options{
+		Dir: dir,
+		Inline: map[string]string{
+			"shared": "from configuration",
+			"inline": "inline {{ .cloud }}",
+		},
+	})
+
+	names, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if want := []string{"inline", "shared", "tf-module"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected templates %v, got %v", want, names)
+	}
+
+	tests := []struct {
+		name       string
+		want       string
+		wantSource string
+		wantErr    error
+	}{
+		{name: "tf-module", want: "module for aws", wantSource: filepath.Join(dir, "tf-module.tmpl")},
+		{name: "inline", want: "inline aws"},
+		{name: "shared", want: "from configuration"},
+		{name: "missing", wantErr: types.ErrNoSuchTemplate},
+		{name: "../tf-module", wantErr: types.ErrNoSuchTemplate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Render(tt.name, map[string]string{"cloud": "aws"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+
+			if tt.wantErr == nil {
+				tmpl, _ := store.Load(tt.name)
+				if tmpl.Source != tt.wantSource {
+					t.Errorf("expected source %q, got %q", tt.wantSource, tmpl.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreMissingDir(t *testing.T) {
+	store := templates.New(&templates.Options{
+		Dir:    filepath.Join(t.TempDir(), "missing"),
+		Inline: map[string]string{"inline": "text"},
+	})
+
+	names, err := store.List()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"inline"}) {
+		t.Errorf("expected only inline templates, got %v", names)
+	}
+}
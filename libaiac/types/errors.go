@@ -1,6 +1,11 @@
 package types
 
-import "errors"
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
 
 var (
 	// ErrNoSuchBackend is returned when the user provides a backend name that
@@ -26,4 +31,141 @@ var (
 	// ErrRequestFailed is returned when the LLM provider API returned an error
 	// for the request.
 	ErrRequestFailed = errors.New("request failed")
+
+	// ErrNoSuchSession is returned when the user provides a session name that
+	// does not exist in the session store.
+	ErrNoSuchSession = errors.New("no such session")
+
+	// ErrInvalidSessionName is returned when the user provides a session name
+	// that cannot be safely used as a file name.
+	ErrInvalidSessionName = errors.New("invalid session name")
+
+	// ErrValidationFailed is returned when generated code still fails
+	// validation after the maximum number of repair attempts.
+	ErrValidationFailed = errors.New("generated code failed validation")
+
+	// ErrInvalidSeverity is returned when the user provides an unknown
+	// severity level for security findings.
+	ErrInvalidSeverity = errors.New("invalid severity")
+
+	// ErrUnsupportedReportFormat is returned when the user requests a report
+	// in a format that is not supported.
+	ErrUnsupportedReportFormat = errors.New("unsupported report format")
+
+	// ErrNoContextFiles is returned when a path or glob pattern provided as
+	// context does not match any files.
+	ErrNoContextFiles = errors.New("no files found")
+
+	// ErrContextTooLarge is returned when the files provided as context exceed
+	// the maximum context size, and truncation was not requested.
+	ErrContextTooLarge = errors.New("context files too large")
+
+	// ErrNoSuchTemplate is returned when the user provides a template name
+	// that does not exist in the templates directory or configuration.
+	ErrNoSuchTemplate = errors.New("no such template")
+
+	// ErrMissingVariable is returned when rendering a template that requires
+	// a variable which was not provided.
+	ErrMissingVariable = errors.New("missing template variable")
+
+	// ErrInvalidVariable is returned when a template variable is provided in
+	// an invalid format.
+	ErrInvalidVariable = errors.New("invalid template variable")
+
+	// ErrInvalidManifest is returned when a batch manifest is invalid, e.g.
+	// it defines no jobs.
+	ErrInvalidManifest = errors.New("invalid manifest")
+
+	// ErrInvalidSuite is returned when an evaluation suite is invalid, e.g.
+	// it uses an unknown assertion type.
+	ErrInvalidSuite = errors.New("invalid suite")
+
+	// ErrNoCodeBlocks is returned when no code could be extracted from a
+	// response that is expected to contain code.
+	ErrNoCodeBlocks = errors.New("no code blocks found in output")
+
+	// ErrUnsafeFilename is returned when a code block's file name is absolute
+	// or would escape the directory it is saved to.
+	ErrUnsafeFilename = errors.New("unsafe file name")
+
+	// ErrResponseTruncated is returned when a response that is expected to
+	// be complete was truncated due to the token limit.
+	ErrResponseTruncated = errors.New("response was truncated")
+
+	// ErrNoFixture is returned by the mock backend when no fixture matches
+	// the prompt it received.
+	ErrNoFixture = errors.New("no fixture matches prompt")
+
+	// ErrFileExists is returned when generated code would overwrite an
+	// existing file, and overwriting was not allowed.
+	ErrFileExists = errors.New("file already exists")
+
+	// ErrInvalidFixtures is returned when the mock backend's fixtures file or
+	// one of its fixtures is invalid.
+	ErrInvalidFixtures = errors.New("invalid fixtures")
+
+	// ErrInvalidCassette is returned when a cassette file of recorded HTTP
+	// exchanges is invalid.
+	ErrInvalidCassette = errors.New("invalid cassette")
+
+	// ErrNoInteraction is returned when replaying a cassette, and no
+	// recorded HTTP exchange matches a request.
+	ErrNoInteraction = errors.New("no recorded interaction matches request")
 )
+
+// RetryableError wraps errors returned by LLM providers for requests that may
+// succeed if retried, for example due to rate limiting or temporary service
+// unavailability.
+type RetryableError struct {
+	// Err is the underlying error.
+	Err error
+
+	// RetryAfter is the duration the provider asked to wait before retrying
+	// the request, if any (e.g. via the Retry-After HTTP header).
+	RetryAfter time.Duration
+}
+
+// Error returns the error message of the underlying error.
+func (err *RetryableError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (err *RetryableError) Unwrap() error {
+	return err.Err
+}
+
+// IsRetryableStatus returns true if requests answered with the provided HTTP
+// status may succeed if retried.
+func IsRetryableStatus(httpStatus int) bool {
+	switch httpStatus {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		529: // used by Anthropic when its API is overloaded
+		return true
+	default:
+		return false
+	}
+}
+
+// WithRetryAfter sets the RetryAfter duration of a RetryableError wrapped by
+// err from the value of a Retry-After HTTP header, which may either be a
+// number of seconds or an HTTP date. If err does not wrap a RetryableError,
+// or the header is empty or invalid, err is returned unchanged.
+func WithRetryAfter(err error, header string) error {
+	var retryable *RetryableError
+	if header == "" || !errors.As(err, &retryable) {
+		return err
+	}
+
+	if secs, convErr := strconv.Atoi(header); convErr == nil {
+		retryable.RetryAfter = time.Duration(secs) * time.Second
+	} else if date, parseErr := http.ParseTime(header); parseErr == nil {
+		retryable.RetryAfter = time.Until(date)
+	}
+
+	return err
+}
@@ -0,0 +1,219 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// CodeBlock is a single fenced code block extracted from a model's output.
+type CodeBlock struct {
+	// Language is the language tag of the code block (e.g. "hcl", "yaml"), if
+	// any.
+	Language string `json:"language,omitempty"`
+
+	// Filename is the name of the file the code block is meant to be saved
+	// to, if the output included a hint for it.
+	Filename string `json:"filename,omitempty"`
+
+	// Code is the content of the code block.
+	Code string `json:"code"`
+}
+
+var (
+	// fileRegex matches strings that look like file names or paths, e.g.
+	// "main.tf", "k8s/deployment.yaml" or "Dockerfile".
+	fileRegex = regexp.MustCompile(
+		`^(?:[\w.-]+/)*(?:\w[\w.-]*\.[A-Za-z][A-Za-z0-9]*|(?:Docker|Make|Jenkins|Vagrant|Proc|Gem)file)$`,
+	)
+
+	// infoFileRegex matches filename attributes in a code block's info string,
+	// e.g. "title=main.tf" or `filename="main.tf"`.
+	infoFileRegex = regexp.MustCompile(`\b(?:title|file|filename|name|path)=["']?([^"'\s]+)["']?`)
+
+	// commentFileRegex matches comments on the first line of a code block
+	// that provide the file name, e.g. "// file: main.tf" or "# main.tf".
+	commentFileRegex = regexp.MustCompile(
+		`^(?://|#|--|;|/\*|<!--)\s*(?:(?:file|filename|path)\s*:\s*)?([^\s*]+?)\s*(?:\*/|-->)?$`,
+	)
+
+	// headingFileRegex matches file names in the line preceding a code block,
+	// e.g. "### main.tf", "**variables.tf**", "1. `outputs.tf`:" or
+	// "File: main.tf".
+	headingFileRegex = regexp.MustCompile(
+		"^(?:#+\\s*|\\d+\\.\\s*|[-*]\\s+)?(?:\\*\\*|__)?(?:(?i:file(?:name)?)\\s*:\\s*)?`?([^`*\\s:]+)`?(?:\\*\\*|__)?:?$",
+	)
+)
+
+// ExtractFiles receives the full output string from an LLM provider and
+// extracts all fenced code blocks from it, in order. For every block, the
+// language tag and a filename hint are extracted if available. Filename hints
+// are taken from the block's info string (e.g. "```hcl title=main.tf"), from a
+// comment in the first line of the block (e.g. "// file: main.tf"), or from a
+// heading or line immediately preceding the block (e.g. "### main.tf"), in
+// that order of precedence. Blocks without content are ignored.
+func ExtractFiles(output string) (blocks []CodeBlock) {
+	lines := strings.Split(output, "\n")
+
+	var prev string
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		trimmed := strings.TrimSpace(line)
+
+		if !strings.HasPrefix(trimmed, "```") {
+			if trimmed != "" {
+				prev = trimmed
+			}
+			continue
+		}
+
+		// find the closing fence
+		end := i + 1
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "```" {
+			end++
+		}
+
+		block := parseInfoString(strings.TrimPrefix(trimmed, "```"))
+		block.Code = strings.TrimRight(
+			strings.Join(lines[i+1:end], "\n"),
+			"\r\n",
+		)
+
+		if block.Filename == "" {
+			block.Filename = filenameFromComment(block.Code)
+		}
+
+		if block.Filename == "" {
+			block.Filename = filenameFromHeading(prev)
+		}
+
+		if strings.TrimSpace(block.Code) != "" {
+			blocks = append(blocks, block)
+		}
+
+		prev = ""
+		i = end
+	}
+
+	return blocks
+}
+
+// parseInfoString parses the info string of a fenced code block, i.e. the text
+// following the opening fence, for the language tag and a filename hint.
+// Besides attributes such as "title=main.tf", a language tag in the format
+// "hcl:main.tf" is supported as well.
+func parseInfoString(info string) (block CodeBlock) {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return block
+	}
+
+	if !strings.Contains(fields[0], "=") {
+		block.Language = fields[0]
+		if lang, file, ok := strings.Cut(fields[0], ":"); ok && fileRegex.MatchString(file) {
+			block.Language = lang
+			block.Filename = file
+		}
+	}
+
+	if m := infoFileRegex.FindStringSubmatch(info); m != nil {
+		block.Filename = m[1]
+	}
+
+	return block
+}
+
+func filenameFromComment(code string) string {
+	first, _, _ := strings.Cut(code, "\n")
+	m := commentFileRegex.FindStringSubmatch(strings.TrimSpace(first))
+	if m == nil || !fileRegex.MatchString(m[1]) {
+		return ""
+	}
+
+	return m[1]
+}
+
+func filenameFromHeading(line string) string {
+	m := headingFileRegex.FindStringSubmatch(line)
+	if m == nil || !fileRegex.MatchString(m[1]) {
+		return ""
+	}
+
+	return m[1]
+}
+
+// fileExtensions maps code block language tags to file extensions, used for
+// naming files for code blocks without a file name hint.
+var fileExtensions = map[string]string{
+	"hcl":        ".tf",
+	"terraform":  ".tf",
+	"tf":         ".tf",
+	"yaml":       ".yaml",
+	"yml":        ".yaml",
+	"json":       ".json",
+	"toml":       ".toml",
+	"python":     ".py",
+	"py":         ".py",
+	"bash":       ".sh",
+	"sh":         ".sh",
+	"shell":      ".sh",
+	"powershell": ".ps1",
+	"go":         ".go",
+	"javascript": ".js",
+	"js":         ".js",
+	"typescript": ".ts",
+	"ts":         ".ts",
+	"rego":       ".rego",
+	"sql":        ".sql",
+	"bicep":      ".bicep",
+	"groovy":     ".groovy",
+	"dockerfile": ".dockerfile",
+}
+
+// FileExtension returns the file extension (including the leading dot) for
+// code in the provided language, e.g. ".tf" for "hcl". Unknown languages use
+// ".txt".
+func FileExtension(language string) string {
+	if ext, ok := fileExtensions[strings.ToLower(language)]; ok {
+		return ext
+	}
+
+	return ".txt"
+}
+
+// FileNames returns a relative, slash-separated file name for every code
+// block, in the same order as the blocks. Blocks without a file name hint are
+// named after their position and language (e.g. "file-2.tf"). When multiple
+// blocks have the same name, the later ones are numbered (e.g. "main-2.tf")
+// so that no block is lost. An error wrapping ErrUnsafeFilename is returned
+// if a file name is absolute or would escape the directory the files are
+// saved to, e.g. "../main.tf".
+func FileNames(blocks []CodeBlock) (names []string, err error) {
+	names = make([]string, len(blocks))
+	seen := make(map[string]bool, len(blocks))
+
+	for i, block := range blocks {
+		name := block.Filename
+		if name == "" {
+			name = fmt.Sprintf("file-%d%s", i+1, FileExtension(block.Language))
+		}
+
+		clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") ||
+			(len(clean) > 1 && clean[1] == ':') {
+			return nil, fmt.Errorf("%w: %s", ErrUnsafeFilename, name)
+		}
+
+		ext := path.Ext(clean)
+		base := strings.TrimSuffix(clean, ext)
+		for n := 2; seen[clean]; n++ {
+			clean = fmt.Sprintf("%s-%d%s", base, n, ext)
+		}
+
+		seen[clean] = true
+		names[i] = clean
+	}
+
+	return names, nil
+}
@@ -0,0 +1,149 @@
+package types_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+func TestExtractFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []types.CodeBlock
+	}{
+		{
+			name:   "filename comment in block",
+			output: "Here you go:\n```hcl\n# file: main.tf\nresource \"a\" \"b\" {}\n```",
+			want: []types.CodeBlock{{
+				Language: "hcl",
+				Filename: "main.tf",
+				Code:     "# file: main.tf\nresource \"a\" \"b\" {}",
+			}},
+		},
+		{
+			name:   "heading before fence",
+			output: "### variables.tf\n\n```hcl\nvariable \"a\" {}\n```",
+			want: []types.CodeBlock{{
+				Language: "hcl",
+				Filename: "variables.tf",
+				Code:     "variable \"a\" {}",
+			}},
+		},
+		{
+			name:   "backtick filename before fence",
+			output: "1. `k8s/deployment.yaml`:\n```yaml\nkind: Deployment\n```",
+			want: []types.CodeBlock{{
+				Language: "yaml",
+				Filename: "k8s/deployment.yaml",
+				Code:     "kind: Deployment",
+			}},
+		},
+		{
+			name:   "info string",
+			output: "```hcl title=\"outputs.tf\"\noutput \"a\" {}\n```",
+			want: []types.CodeBlock{{
+				Language: "hcl",
+				Filename: "outputs.tf",
+				Code:     "output \"a\" {}",
+			}},
+		},
+		{
+			name:   "heading does not apply to later blocks",
+			output: "### main.tf\n```hcl\na = 1\n```\n```hcl\nb = 2\n```",
+			want: []types.CodeBlock{
+				{Language: "hcl", Filename: "main.tf", Code: "a = 1"},
+				{Language: "hcl", Code: "b = 2"},
+			},
+		},
+		{
+			name:   "no hint",
+			output: "Some text.\n```\necho hi\n```",
+			want:   []types.CodeBlock{{Code: "echo hi"}},
+		},
+		{
+			name:   "empty block",
+			output: "```hcl\n\n```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := types.ExtractFiles(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFileNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		blocks  []types.CodeBlock
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "fallback from language",
+			blocks: []types.CodeBlock{
+				{Filename: "main.tf", Language: "hcl"},
+				{Language: "HCL"},
+				{Language: "yaml"},
+				{Language: "cobol"},
+				{},
+			},
+			want: []string{"main.tf", "file-2.tf", "file-3.yaml", "file-4.txt", "file-5.txt"},
+		},
+		{
+			name: "same name",
+			blocks: []types.CodeBlock{
+				{Filename: "main.tf"},
+				{Filename: "main.tf"},
+				{Filename: "./main.tf"},
+				{Filename: "Dockerfile"},
+				{Filename: "Dockerfile"},
+			},
+			want: []string{"main.tf", "main-2.tf", "main-3.tf", "Dockerfile", "Dockerfile-2"},
+		},
+		{
+			name:   "nested paths are cleaned",
+			blocks: []types.CodeBlock{{Filename: "modules/vpc/../vpc/main.tf"}},
+			want:   []string{"modules/vpc/main.tf"},
+		},
+		{
+			name:    "parent directory",
+			blocks:  []types.CodeBlock{{Filename: "main.tf"}, {Filename: "../x.tf"}},
+			wantErr: types.ErrUnsafeFilename,
+		},
+		{
+			name:    "escapes through subdirectory",
+			blocks:  []types.CodeBlock{{Filename: "modules/../../x.tf"}},
+			wantErr: types.ErrUnsafeFilename,
+		},
+		{
+			name:    "absolute path",
+			blocks:  []types.CodeBlock{{Filename: "/etc/x.tf"}},
+			wantErr: types.ErrUnsafeFilename,
+		},
+		{
+			name:    "windows path",
+			blocks:  []types.CodeBlock{{Filename: "..\\x.tf"}},
+			wantErr: types.ErrUnsafeFilename,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := types.FileNames(tt.blocks)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package types
+
+// DefaultTemperature is the temperature used when generating responses, unless
+// a different one is set via InferenceParams.
+const DefaultTemperature = 0.2
+
+// InferenceParams holds parameters that control how a model generates its
+// responses. All parameters are optional; nil (or empty) values mean the
+// provider's default will be used, except for Temperature, which defaults to
+// DefaultTemperature. Not all providers support all parameters; unsupported
+// parameters are ignored.
+type InferenceParams struct {
+	// Temperature controls the randomness of the output.
+	Temperature *float64 `toml:"temperature" json:"temperature,omitempty"`
+
+	// MaxTokens is the maximum number of tokens to generate.
+	MaxTokens *int `toml:"max_tokens" json:"max_tokens,omitempty"`
+
+	// TopP controls nucleus sampling.
+	TopP *float64 `toml:"top_p" json:"top_p,omitempty"`
+
+	// StopSequences is a list of sequences that will cause the model to stop
+	// generating further tokens.
+	StopSequences []string `toml:"stop_sequences" json:"stop_sequences,omitempty"`
+
+	// Seed is used for deterministic sampling, where supported. Amazon Bedrock
+	// and Anthropic do not support this parameter.
+	Seed *int64 `toml:"seed" json:"seed,omitempty"`
+}
+
+// Merge returns a copy of the parameters, with any parameters set in the
+// provided overrides taking precedence.
+func (params InferenceParams) Merge(overrides InferenceParams) InferenceParams {
+	if overrides.Temperature != nil {
+		params.Temperature = overrides.Temperature
+	}
+
+	if overrides.MaxTokens != nil {
+		params.MaxTokens = overrides.MaxTokens
+	}
+
+	if overrides.TopP != nil {
+		params.TopP = overrides.TopP
+	}
+
+	if len(overrides.StopSequences) > 0 {
+		params.StopSequences = overrides.StopSequences
+	}
+
+	if overrides.Seed != nil {
+		params.Seed = overrides.Seed
+	}
+
+	return params
+}
+
+// GetTemperature returns the temperature to use, which is DefaultTemperature
+// if one was not set.
+func (params InferenceParams) GetTemperature() float64 {
+	if params.Temperature == nil {
+		return DefaultTemperature
+	}
+
+	return *params.Temperature
+}
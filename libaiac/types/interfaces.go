@@ -23,6 +23,12 @@ type Conversation interface {
 	// Send sends a message to the model and returns the response.
 	Send(context.Context, string) (Response, error)
 
+	// SendStream is the same as Send, but streams the response as it is
+	// being generated. The provided function is called with every chunk of
+	// text received from the model, in order. Once the model has finished, the
+	// complete response is returned, just like with Send.
+	SendStream(context.Context, string, func(string)) (Response, error)
+
 	// Messages returns all the messages that have been exchanged between the
 	// user and the assistant up to this point.
 	Messages() []Message
@@ -33,4 +39,8 @@ type Conversation interface {
 	// take precedence over them. Not all providers may support this
 	// (specifically, bedrock doesn't).
 	AddHeader(string, string)
+
+	// SetInferenceParams sets the parameters that control how the model
+	// generates responses for all subsequent messages in this conversation.
+	SetInferenceParams(InferenceParams)
 }
@@ -6,8 +6,9 @@ import "regexp"
 // AI model, either as part of a chat or a single completion request.
 type Message struct {
 	// Role is the type of the participant. The user is named "user" (in Amazon
-	// Bedrock, this is equivalent to the "Human" identifier). Anything else is
-	// considered the AI model.
+	// Bedrock, this is equivalent to the "Human" identifier). The "system" role
+	// is used for system prompts that steer the model's behavior. Anything else
+	// is considered the AI model.
 	Role string `json:"role"`
 
 	// Content is the text content of the message.
@@ -20,22 +21,67 @@ type Response struct {
 	// FullOutput is the complete output returned by the API. This is generally
 	// a Markdown-formatted Message that contains the generated code, plus
 	// explanations, if any.
-	FullOutput string
+	FullOutput string `json:"full_output"`
 
 	// Code is the extracted code section from the complete output. If code was
 	// not found or extraction otherwise failed, this will be the same as
 	// FullOutput.
-	Code string
+	Code string `json:"code"`
 
-	// APIKeyUsed is the API key used when making the request.
-	APIKeyUsed string
+	// Files are all the code blocks extracted from the complete output, with
+	// their language and file name, if available. This is useful when the
+	// output contains multiple files (e.g. main.tf, variables.tf and
+	// outputs.tf). See ExtractFiles for more information.
+	Files []CodeBlock `json:"files,omitempty"`
+
+	// APIKeyUsed is the API key used when making the request. It is never
+	// serialized, so that responses can be safely persisted.
+	APIKeyUsed string `json:"-"`
+
+	// Backend is the name of the backend that generated the response. When a
+	// fallback chain is configured, this may differ from the backend that was
+	// initially selected.
+	Backend string `json:"backend,omitempty"`
+
+	// Model is the name of the model that generated the response.
+	Model string `json:"model,omitempty"`
+
+	// Fallback is true if the response was generated by a fallback backend,
+	// because the backend initially selected failed.
+	Fallback bool `json:"fallback,omitempty"`
 
 	// TokensUsed is the number of tokens utilized by the request. This is
 	// the "usage.total_tokens" value returned from the API.
-	TokensUsed int64
+	TokensUsed int64 `json:"tokens_used"`
+
+	// StopReason is the reason the model stopped generating output, as
+	// returned by the LLM provider (e.g. "stop", "length", "max_tokens").
+	StopReason string `json:"stop_reason,omitempty"`
+
+	// Continuations is the number of times the model was asked to continue a
+	// response that was truncated due to the token limit. This is only
+	// relevant when automatic continuation is enabled.
+	Continuations int `json:"continuations,omitempty"`
+
+	// Repairs is the number of times the model was asked to fix problems
+	// found when validating its output. This is only relevant when automatic
+	// repair is enabled.
+	Repairs int `json:"repairs,omitempty"`
+}
+
+// truncationStopReasons are the stop reasons used by the different LLM
+// providers to signify a response was truncated due to the token limit.
+var truncationStopReasons = map[string]bool{
+	"length":     true, // OpenAI, Ollama
+	"truncated":  true, // Ollama (older versions)
+	"max_tokens": true, // Amazon Bedrock, Anthropic
+	"MAX_TOKENS": true, // Gemini
+}
 
-	// StopReason
-	StopReason string
+// IsTruncated returns true if the provided stop reason signifies the response
+// was truncated due to the token limit.
+func IsTruncated(stopReason string) bool {
+	return truncationStopReasons[stopReason]
 }
 
 var codeRegex = regexp.MustCompile("(?ms)^```(?:[^\n]*)\n(.*?)\n```$")
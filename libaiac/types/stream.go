@@ -0,0 +1,141 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxStreamLineSize is the maximum size of a single line in a streamed
+// response.
+const maxStreamLineSize = 1024 * 1024
+
+// StreamRequest describes an HTTP request to an LLM provider API whose
+// response is streamed line by line, e.g. as server-sent events or
+// newline-delimited JSON.
+type StreamRequest struct {
+	// Client is the HTTP client used to send the request. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	// URL is the full URL of the request.
+	URL string
+
+	// Headers are HTTP headers to send with the request.
+	Headers map[string]string
+
+	// ExtraHeaders are additional HTTP headers to send with the request, e.g.
+	// those added to a specific conversation. They take precedence over
+	// Headers.
+	ExtraHeaders map[string]string
+
+	// Body is the request body, which is encoded to JSON.
+	Body interface{}
+
+	// ErrorHandler creates the error returned when the API responds with an
+	// unsuccessful status code.
+	ErrorHandler func(httpStatus int, contentType string, body io.Reader) error
+}
+
+// Stream is a streamed response from an LLM provider API. It is read line by
+// line, similar to a bufio.Scanner. Empty lines are skipped. The stream must
+// be closed once it is no longer needed.
+type Stream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// OpenStream sends the provided request and returns the streamed response.
+// The request is bound to the provided context, which allows canceling the
+// stream while it is being read. If the API responds with an unsuccessful
+// status code, the request's ErrorHandler is used to create the returned
+// error, taking the Retry-After header into account (see WithRetryAfter).
+func OpenStream(ctx context.Context, req StreamRequest) (*Stream, error) {
+	body, err := json.Marshal(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding request body: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		req.URL,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	for key, val := range req.Headers {
+		httpReq.Header.Set(key, val)
+	}
+	for key, val := range req.ExtraHeaders {
+		httpReq.Header.Set(key, val)
+	}
+
+	client := req.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		defer res.Body.Close()
+
+		err = fmt.Errorf("%w %s", ErrUnexpectedStatus, http.StatusText(res.StatusCode))
+		if req.ErrorHandler != nil {
+			err = req.ErrorHandler(
+				res.StatusCode,
+				res.Header.Get("Content-Type"),
+				res.Body,
+			)
+		}
+
+		return nil, WithRetryAfter(err, res.Header.Get("Retry-After"))
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxStreamLineSize)
+
+	return &Stream{body: res.Body, scanner: scanner}, nil
+}
+
+// Scan advances the stream to the next non-empty line, which will then be
+// available through the Bytes method. It returns false when the stream ends,
+// either by reaching the end of the response or an error.
+func (stream *Stream) Scan() bool {
+	for stream.scanner.Scan() {
+		if len(bytes.TrimSpace(stream.scanner.Bytes())) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bytes returns the most recent line read by Scan, with surrounding
+// whitespace removed. The underlying array may be overwritten by subsequent
+// calls to Scan.
+func (stream *Stream) Bytes() []byte {
+	return bytes.TrimSpace(stream.scanner.Bytes())
+}
+
+// Err returns the first error encountered while reading the stream, if any.
+func (stream *Stream) Err() error {
+	return stream.scanner.Err()
+}
+
+// Close closes the stream.
+func (stream *Stream) Close() error {
+	return stream.body.Close()
+}
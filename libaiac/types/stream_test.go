@@ -0,0 +1,190 @@
+package types_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// countingTransport is an HTTP transport that counts the requests sent
+// through it.
+type countingTransport struct {
+	requests int
+}
+
+func (transport *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOpenStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["prompt"] != "hi" {
+			t.Errorf("unexpected request body %v (%v)", body, err)
+		}
+
+		for header, want := range map[string]string{
+			"Content-Type": "application/json",
+			"Accept":       "text/event-stream",
+			"X-Api-Key":    "key",
+			"X-Extra":      "conversation",
+		} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("expected header %s to be %q, got %q", header, want, got)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: one\n\n  \ndata: two  \r\n\r\n")
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+
+	stream, err := types.OpenStream(context.Background(), types.StreamRequest{
+		Client:       &http.Client{Transport: transport},
+		URL:          srv.URL,
+		Headers:      map[string]string{"X-Api-Key": "key", "X-Extra": "backend"},
+		ExtraHeaders: map[string]string{"X-Extra": "conversation"},
+		Body:         map[string]string{"prompt": "hi"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer stream.Close()
+
+	var lines []string
+	for stream.Scan() {
+		lines = append(lines, string(stream.Bytes()))
+	}
+
+	if err := stream.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if strings.Join(lines, "|") != "data: one|data: two" {
+		t.Errorf("expected empty lines to be skipped, got %q", lines)
+	}
+
+	if transport.requests != 1 {
+		t.Errorf("expected the provided client to be used, got %d requests", transport.requests)
+	}
+}
+
+func TestOpenStreamErrors(t *testing.T) {
+	errAPI := errors.New("api error")
+
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     string
+		handler        func(int, string, io.Reader) error
+		wantErr        error
+		wantRetryAfter time.Duration
+	}{
+		{
+			name:    "without error handler",
+			status:  http.StatusBadRequest,
+			wantErr: types.ErrUnexpectedStatus,
+		},
+		{
+			name:   "with error handler",
+			status: http.StatusBadRequest,
+			handler: func(status int, contentType string, body io.Reader) error {
+				data, _ := io.ReadAll(body)
+				if status != http.StatusBadRequest || contentType != "application/json" ||
+					string(data) != `{"error": "bad"}` {
+					t.Errorf("unexpected error response %d %s %q", status, contentType, data)
+				}
+				return errAPI
+			},
+			wantErr: errAPI,
+		},
+		{
+			name:       "retryable with retry after",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "3",
+			handler: func(int, string, io.Reader) error {
+				return &types.RetryableError{Err: errAPI}
+			},
+			wantErr:        errAPI,
+			wantRetryAfter: 3 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"error": "bad"}`)
+			}))
+			defer srv.Close()
+
+			_, err := types.OpenStream(context.Background(), types.StreamRequest{
+				URL:          srv.URL,
+				ErrorHandler: tt.handler,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+
+			var retryable *types.RetryableError
+			if errors.As(err, &retryable) && retryable.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("expected retry after %s, got %s", tt.wantRetryAfter, retryable.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestOpenStreamCanceled(t *testing.T) {
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := types.OpenStream(ctx, types.StreamRequest{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer stream.Close()
+
+	if !stream.Scan() || string(stream.Bytes()) != "data: first" {
+		t.Fatalf("expected first line, got %q (%v)", stream.Bytes(), stream.Err())
+	}
+
+	cancel()
+
+	if stream.Scan() {
+		t.Fatalf("expected stream to end after cancellation, got %q", stream.Bytes())
+	}
+
+	if !errors.Is(stream.Err(), context.Canceled) {
+		t.Errorf("expected error %q, got %v", context.Canceled, stream.Err())
+	}
+}
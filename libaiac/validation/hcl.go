@@ -0,0 +1,127 @@
+package validation
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// terraformSchema describes the top-level blocks allowed in Terraform files,
+// along with their labels.
+var terraformSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "terraform"},
+		{Type: "locals"},
+		{Type: "provider", LabelNames: []string{"name"}},
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "resource", LabelNames: []string{"type", "name"}},
+		{Type: "data", LabelNames: []string{"type", "name"}},
+		{Type: "ephemeral", LabelNames: []string{"type", "name"}},
+		{Type: "moved"},
+		{Type: "import"},
+		{Type: "removed"},
+		{Type: "check", LabelNames: []string{"name"}},
+	},
+}
+
+// terraformBlockTypes are block types that identify an HCL file as Terraform
+// code, when the language or file name does not.
+var terraformBlockTypes = map[string]bool{
+	"terraform": true,
+	"provider":  true,
+	"resource":  true,
+	"data":      true,
+	"module":    true,
+}
+
+// IsHCL returns true if the provided code block contains HCL code, based on its
+// language tag or file name.
+func IsHCL(block types.CodeBlock) bool {
+	switch strings.ToLower(block.Language) {
+	case "hcl", "terraform", "tf", "tfvars":
+		return true
+	}
+
+	switch filepath.Ext(block.Filename) {
+	case ".tf", ".hcl", ".tfvars":
+		return true
+	}
+
+	return false
+}
+
+// IsTerraform returns true if the provided code block contains Terraform
+// configuration (as opposed to generic HCL or Terraform variable definitions),
+// based on its language tag or file name.
+func IsTerraform(block types.CodeBlock) bool {
+	lang := strings.ToLower(block.Language)
+	return lang == "terraform" || lang == "tf" || filepath.Ext(block.Filename) == ".tf"
+}
+
+// ValidateHCL parses the provided HCL code and returns diagnostics for all
+// syntax errors found. If terraform is true, or the code contains top-level
+// blocks that are specific to Terraform (e.g. "resource"), the top-level
+// structure of the code is validated against Terraform's configuration
+// language as well, e.g. to find resources with missing labels.
+func ValidateHCL(filename string, code []byte, terraform bool) (diags []Diagnostic) {
+	file, hclDiags := hclsyntax.ParseConfig(code, filename, hcl.InitialPos)
+	diags = append(diags, convertDiagnostics(filename, "hcl-syntax", hclDiags)...)
+	if hclDiags.HasErrors() {
+		return diags
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return diags
+	}
+
+	if !terraform {
+		for _, block := range body.Blocks {
+			if terraformBlockTypes[block.Type] {
+				terraform = true
+				break
+			}
+		}
+	}
+
+	if terraform {
+		_, hclDiags = file.Body.Content(terraformSchema)
+		diags = append(diags, convertDiagnostics(filename, "terraform-structure", hclDiags)...)
+	}
+
+	return diags
+}
+
+func convertDiagnostics(filename, rule string, hclDiags hcl.Diagnostics) (diags []Diagnostic) {
+	for _, hclDiag := range hclDiags {
+		diag := Diagnostic{
+			File:     filename,
+			Severity: SeverityError,
+			Message:  hclDiag.Summary,
+			Rule:     rule,
+		}
+
+		if hclDiag.Severity == hcl.DiagWarning {
+			diag.Severity = SeverityWarning
+		}
+
+		if hclDiag.Detail != "" {
+			diag.Message = fmt.Sprintf("%s; %s", hclDiag.Summary, hclDiag.Detail)
+		}
+
+		if hclDiag.Subject != nil {
+			diag.Line = hclDiag.Subject.Start.Line
+			diag.Column = hclDiag.Subject.Start.Column
+		}
+
+		diags = append(diags, diag)
+	}
+
+	return diags
+}
@@ -0,0 +1,106 @@
+package validation_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+func TestIsHCL(t *testing.T) {
+	tests := []struct {
+		block         types.CodeBlock
+		wantHCL       bool
+		wantTerraform bool
+	}{
+		{block: types.CodeBlock{Language: "hcl"}, wantHCL: true},
+		{block: types.CodeBlock{Language: "Terraform"}, wantHCL: true, wantTerraform: true},
+		{block: types.CodeBlock{Language: "tf"}, wantHCL: true, wantTerraform: true},
+		{block: types.CodeBlock{Language: "tfvars"}, wantHCL: true},
+		{block: types.CodeBlock{Filename: "main.tf"}, wantHCL: true, wantTerraform: true},
+		{block: types.CodeBlock{Filename: "prod.tfvars"}, wantHCL: true},
+		{block: types.CodeBlock{Filename: "config.hcl"}, wantHCL: true},
+		{block: types.CodeBlock{Language: "yaml"}},
+		{block: types.CodeBlock{Filename: "main.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s%s", tt.block.Language, tt.block.Filename), func(t *testing.T) {
+			if got := validation.IsHCL(tt.block); got != tt.wantHCL {
+				t.Errorf("expected IsHCL to be %t, got %t", tt.wantHCL, got)
+			}
+
+			if got := validation.IsTerraform(tt.block); got != tt.wantTerraform {
+				t.Errorf("expected IsTerraform to be %t, got %t", tt.wantTerraform, got)
+			}
+		})
+	}
+}
+
+func TestValidateHCL(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		terraform bool
+		want      []string
+	}{
+		{
+			name: "valid terraform",
+			code: "resource \"aws_s3_bucket\" \"b\" {\n  bucket = \"b\"\n}\n",
+		},
+		{
+			name: "valid generic hcl",
+			code: "service \"web\" {\n  port = 80\n}\n",
+		},
+		{
+			name: "unclosed block",
+			code: "resource \"aws_s3_bucket\" \"b\" {\n  bucket = \"b\"\n",
+			want: []string{"main.tf:1:30: error: Unclosed configuration block"},
+		},
+		{
+			name: "missing value",
+			code: "locals {\n  a = \n}\n",
+			want: []string{"main.tf:2:7: error: Invalid expression"},
+		},
+		{
+			name: "missing resource label",
+			code: "resource \"aws_s3_bucket\" {}\n",
+			want: []string{"main.tf:1:26: error: Missing name for resource"},
+		},
+		{
+			name:      "unknown top-level block",
+			code:      "service \"web\" {}\n",
+			terraform: true,
+			want:      []string{"main.tf:1:1: error: Unsupported block type"},
+		},
+		{
+			name: "unknown block detected as terraform",
+			code: "provider \"aws\" {}\nservice \"web\" {}\n",
+			want: []string{"main.tf:2:1: error: Unsupported block type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := validation.ValidateHCL("main.tf", []byte(tt.code), tt.terraform)
+			assertDiagnostics(t, diags, tt.want)
+		})
+	}
+}
+
+// assertDiagnostics verifies that every diagnostic starts with the
+// corresponding prefix in want, in order.
+func assertDiagnostics(t *testing.T, diags []validation.Diagnostic, want []string) {
+	t.Helper()
+
+	if len(diags) != len(want) {
+		t.Fatalf("expected %d diagnostic(s), got %d: %v", len(want), len(diags), diags)
+	}
+
+	for i, diag := range diags {
+		if got := diag.String(); len(got) < len(want[i]) || got[:len(want[i])] != want[i] {
+			t.Errorf("expected diagnostic %d to start with %q, got %q", i+1, want[i], got)
+		}
+	}
+}
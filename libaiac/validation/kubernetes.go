@@ -0,0 +1,537 @@
+package validation
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"gopkg.in/yaml.v3"
+)
+
+// kubernetesSchemasJSON is a compact, hand-maintained description of a subset
+// of the core Kubernetes resource kinds. It only covers the kinds and fields
+// commonly found in generated manifests, so fields missing from it are not
+// necessarily invalid in the Kubernetes API. Parts of the API that are deeply
+// nested (e.g. affinity rules) are described with the "any" type and are not
+// validated.
+//
+//go:embed schemas/kubernetes.json
+var kubernetesSchemasJSON []byte
+
+// schemaNode describes the expected structure of a value in a Kubernetes
+// manifest. Type is one of "object", "array", "string", "integer", "number",
+// "boolean", "int-or-string", "quantity" or "any". Ref refers to a node in the
+// definitions section of the schemas file, and replaces all other fields.
+type schemaNode struct {
+	Type                 string                 `json:"type"`
+	Ref                  string                 `json:"ref"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	Required             []string               `json:"required"`
+	Items                *schemaNode            `json:"items"`
+	AdditionalProperties *schemaNode            `json:"additionalProperties"`
+}
+
+// kindSchema describes a Kubernetes resource kind in a specific API version.
+// Properties and Required describe the top-level fields of the resource, in
+// addition to the apiVersion, kind, metadata and status fields shared by all
+// kinds.
+type kindSchema struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Properties map[string]*schemaNode `json:"properties"`
+	Required   []string               `json:"required"`
+}
+
+// kubernetesSchemas holds the bundled schemas. Kinds that are served in
+// multiple API versions with different fields (e.g. HorizontalPodAutoscaler)
+// have a schema per version, listed in order of preference.
+type kubernetesSchemas struct {
+	Definitions map[string]*schemaNode `json:"definitions"`
+	Schemas     []*kindSchema          `json:"schemas"`
+
+	// kinds maps every kind to its schemas, in order of preference.
+	kinds map[string][]*kindSchema
+}
+
+var (
+	loadKubernetesSchemas sync.Once
+	k8sSchemas            kubernetesSchemas
+)
+
+// yamlErrorRegex extracts the line number from errors returned by the YAML
+// parser.
+var yamlErrorRegex = regexp.MustCompile(`^yaml: line (\d+): (.+)$`)
+
+// IsYAML returns true if the provided code block contains YAML code, based on
+// its language tag or file name.
+func IsYAML(block types.CodeBlock) bool {
+	switch strings.ToLower(block.Language) {
+	case "yaml", "yml":
+		return true
+	}
+
+	switch filepath.Ext(block.Filename) {
+	case ".yaml", ".yml":
+		return true
+	}
+
+	return false
+}
+
+// KubernetesKinds returns the names of all Kubernetes resource kinds that
+// ValidateKubernetes has schemas for, sorted alphabetically.
+func KubernetesKinds() []string {
+	schemas := kubernetesSchema()
+
+	kinds := make([]string, 0, len(schemas.kinds))
+	for kind := range schemas.kinds {
+		kinds = append(kinds, kind)
+	}
+
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+// ValidateKubernetes parses the provided YAML code, which may contain multiple
+// documents, and validates every document that is a Kubernetes manifest of a
+// known kind (see KubernetesKinds) against the bundled schemas. Diagnostics are
+// returned for YAML syntax errors, API versions that do not match the kind,
+// unknown fields, missing required fields and values of the wrong type.
+// Documents that are not Kubernetes manifests (i.e. have neither an apiVersion
+// nor a kind), or whose kind is unknown (e.g. custom resources), are ignored.
+func ValidateKubernetes(filename string, code []byte) []Diagnostic {
+	validator := &k8sValidator{
+		file:    filename,
+		schemas: kubernetesSchema(),
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(code)))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			validator.syntaxError(err)
+			break
+		}
+
+		if len(doc.Content) > 0 {
+			validator.validateDocument(doc.Content[0])
+		}
+	}
+
+	return validator.diags
+}
+
+func kubernetesSchema() *kubernetesSchemas {
+	loadKubernetesSchemas.Do(func() {
+		if err := json.Unmarshal(kubernetesSchemasJSON, &k8sSchemas); err != nil {
+			panic(fmt.Sprintf("invalid embedded Kubernetes schemas: %s", err))
+		}
+
+		if err := k8sSchemas.checkRefs(); err != nil {
+			panic(fmt.Sprintf("invalid embedded Kubernetes schemas: %s", err))
+		}
+
+		k8sSchemas.kinds = make(map[string][]*kindSchema)
+		for _, schema := range k8sSchemas.Schemas {
+			k8sSchemas.kinds[schema.Kind] = append(k8sSchemas.kinds[schema.Kind], schema)
+		}
+	})
+
+	return &k8sSchemas
+}
+
+// checkRefs verifies that every reference in the schemas refers to an
+// existing definition, and that no definition refers to itself through
+// references alone, so that references can always be resolved.
+func (schemas *kubernetesSchemas) checkRefs() error {
+	var check func(node *schemaNode) error
+	check = func(node *schemaNode) error {
+		if node == nil {
+			return nil
+		}
+
+		seen := make(map[string]bool)
+		for ref := node.Ref; ref != ""; ref = schemas.Definitions[ref].Ref {
+			if _, ok := schemas.Definitions[ref]; !ok {
+				return fmt.Errorf("unknown definition %q", ref)
+			}
+			if seen[ref] {
+				return fmt.Errorf("circular definition %q", ref)
+			}
+			seen[ref] = true
+		}
+
+		for _, prop := range node.Properties {
+			if err := check(prop); err != nil {
+				return err
+			}
+		}
+
+		if err := check(node.Items); err != nil {
+			return err
+		}
+
+		return check(node.AdditionalProperties)
+	}
+
+	for _, def := range schemas.Definitions {
+		if err := check(def); err != nil {
+			return err
+		}
+	}
+
+	for _, schema := range schemas.Schemas {
+		for _, prop := range schema.Properties {
+			if err := check(prop); err != nil {
+				return fmt.Errorf("%s %s: %w", schema.APIVersion, schema.Kind, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// k8sValidator accumulates diagnostics while validating the documents of a
+// YAML file.
+type k8sValidator struct {
+	file    string
+	schemas *kubernetesSchemas
+	diags   []Diagnostic
+}
+
+func (v *k8sValidator) report(node *yaml.Node, format string, args ...interface{}) {
+	v.diags = append(v.diags, Diagnostic{
+		File:     v.file,
+		Line:     node.Line,
+		Column:   node.Column,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+		Rule:     "k8s-schema",
+	})
+}
+
+func (v *k8sValidator) syntaxError(err error) {
+	diag := Diagnostic{
+		File:     v.file,
+		Severity: SeverityError,
+		Message:  err.Error(),
+		Rule:     "yaml-syntax",
+	}
+
+	if match := yamlErrorRegex.FindStringSubmatch(err.Error()); match != nil {
+		diag.Line, _ = strconv.Atoi(match[1])
+		diag.Message = match[2]
+	}
+
+	v.diags = append(v.diags, diag)
+}
+
+func (v *k8sValidator) validateDocument(doc *yaml.Node) {
+	doc = resolveAlias(doc)
+	if doc.Kind != yaml.MappingNode {
+		return
+	}
+
+	apiVersion, kind := mappingValue(doc, "apiVersion"), mappingValue(doc, "kind")
+	if apiVersion == nil && kind == nil {
+		return
+	}
+
+	if kind == nil {
+		v.report(doc, `missing required field "kind"`)
+		return
+	}
+
+	schemas, ok := v.schemas.kinds[kind.Value]
+	if !ok {
+		return
+	}
+
+	// the schema of the manifest's API version is used; if it is missing or
+	// invalid, the schema of the preferred version is used instead
+	schema := schemas[0]
+	if apiVersion != nil {
+		if match := findSchema(schemas, apiVersion.Value); match != nil {
+			schema = match
+		} else {
+			v.report(
+				apiVersion,
+				"apiVersion %q is not valid for kind %s, use %q",
+				apiVersion.Value,
+				kind.Value,
+				schema.APIVersion,
+			)
+		}
+	}
+
+	envelope := &schemaNode{
+		Type: "object",
+		Properties: map[string]*schemaNode{
+			"apiVersion": {Type: "string"},
+			"kind":       {Type: "string"},
+			"metadata":   {Ref: "ObjectMeta"},
+			"status":     {Type: "any"},
+		},
+		Required: append([]string{"apiVersion", "kind"}, schema.Required...),
+	}
+
+	for name, prop := range schema.Properties {
+		envelope.Properties[name] = prop
+	}
+
+	v.validate(doc, envelope, kind.Value)
+}
+
+func (v *k8sValidator) validate(node *yaml.Node, schema *schemaNode, path string) {
+	node = resolveAlias(node)
+	schema = v.resolve(schema)
+
+	if node.ShortTag() == "!!null" || schema.Type == "any" {
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			v.report(node, "%s must be an object, got %s", path, describeNode(node))
+			return
+		}
+
+		v.validateObject(node, schema, path)
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			v.report(node, "%s must be an array, got %s", path, describeNode(node))
+			return
+		}
+
+		if schema.Items != nil {
+			for i, item := range node.Content {
+				v.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	default:
+		if !scalarMatches(node, schema.Type) {
+			v.report(node, "%s must be %s, got %s", path, describeType(schema.Type), describeNode(node))
+		}
+	}
+}
+
+func (v *k8sValidator) validateObject(node *yaml.Node, schema *schemaNode, path string) {
+	seen := make(map[string]bool, len(node.Content)/2)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Value == "<<" {
+			// merge keys are not validated
+			continue
+		}
+
+		seen[key.Value] = true
+		fieldPath := fmt.Sprintf("%s.%s", path, key.Value)
+
+		if prop, ok := schema.Properties[key.Value]; ok {
+			v.validate(value, prop, fieldPath)
+			continue
+		}
+
+		if schema.AdditionalProperties != nil {
+			v.validate(value, schema.AdditionalProperties, fieldPath)
+			continue
+		}
+
+		if suggestion := suggestField(key.Value, schema.Properties); suggestion != "" {
+			v.report(key, "unknown field %q in %s (did you mean %q?)", key.Value, path, suggestion)
+		} else {
+			v.report(key, "unknown field %q in %s", key.Value, path)
+		}
+	}
+
+	for _, name := range schema.Required {
+		if !seen[name] {
+			v.report(node, "missing required field %q in %s", name, path)
+		}
+	}
+}
+
+func (v *k8sValidator) resolve(schema *schemaNode) *schemaNode {
+	// References are verified when the schemas are loaded (see checkRefs),
+	// but unknown ones are treated as "any" rather than panicking
+	for schema.Ref != "" {
+		def, ok := v.schemas.Definitions[schema.Ref]
+		if !ok {
+			return &schemaNode{Type: "any"}
+		}
+
+		schema = def
+	}
+
+	return schema
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolveAlias(node.Content[i+1])
+		}
+	}
+
+	return nil
+}
+
+func scalarMatches(node *yaml.Node, typ string) bool {
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+
+	tag := node.ShortTag()
+
+	switch typ {
+	case "string":
+		return tag == "!!str"
+	case "integer":
+		return tag == "!!int"
+	case "number":
+		return tag == "!!int" || tag == "!!float"
+	case "boolean":
+		return tag == "!!bool"
+	case "int-or-string":
+		return tag == "!!int" || tag == "!!str"
+	case "quantity":
+		return tag == "!!int" || tag == "!!float" || tag == "!!str"
+	}
+
+	return true
+}
+
+func describeType(typ string) string {
+	switch typ {
+	case "integer":
+		return "an integer"
+	case "int-or-string":
+		return "an integer or a string"
+	case "quantity":
+		return "a quantity"
+	}
+
+	return "a " + typ
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "an object"
+	case yaml.SequenceNode:
+		return "an array"
+	}
+
+	switch node.ShortTag() {
+	case "!!int":
+		return fmt.Sprintf("integer %s", node.Value)
+	case "!!float":
+		return fmt.Sprintf("number %s", node.Value)
+	case "!!bool":
+		return fmt.Sprintf("boolean %s", node.Value)
+	}
+
+	return fmt.Sprintf("string %q", node.Value)
+}
+
+// suggestField returns the name of the known field closest to the provided
+// unknown field name, if one is close enough to be a likely typo.
+func suggestField(name string, properties map[string]*schemaNode) string {
+	candidates := make([]string, 0, len(properties))
+	for candidate := range properties {
+		candidates = append(candidates, candidate)
+	}
+
+	sort.Strings(candidates)
+
+	// only suggest fields that are at most a third of the name's length away
+	var (
+		best     string
+		bestDist = len(name)/3 + 1
+	)
+
+	for _, candidate := range candidates {
+		if strings.EqualFold(candidate, name) {
+			return candidate
+		}
+
+		if dist := editDistance(name, candidate); dist < bestDist {
+			best, bestDist = candidate, dist
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
+
+// findSchema returns the schema of the provided API version, or nil if there
+// is none.
+func findSchema(schemas []*kindSchema, apiVersion string) *kindSchema {
+	for _, schema := range schemas {
+		if schema.APIVersion == apiVersion {
+			return schema
+		}
+	}
+
+	return nil
+}
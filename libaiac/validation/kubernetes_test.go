@@ -0,0 +1,201 @@
+package validation_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+func TestKubernetesKinds(t *testing.T) {
+	kinds := validation.KubernetesKinds()
+	if !sort.StringsAreSorted(kinds) {
+		t.Errorf("expected kinds to be sorted, got %v", kinds)
+	}
+
+	seen := make(map[string]bool)
+	for _, kind := range kinds {
+		if seen[kind] {
+			t.Errorf("kind %s listed more than once", kind)
+		}
+		seen[kind] = true
+	}
+
+	for _, kind := range []string{"Deployment", "Service", "HorizontalPodAutoscaler"} {
+		if !seen[kind] {
+			t.Errorf("expected kind %s to be supported", kind)
+		}
+	}
+}
+
+func TestValidateKubernetes(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{
+			name: "valid deployment",
+			code: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  selector:
+    matchLabels: {app: web}
+  template:
+    metadata:
+      labels: {app: web}
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          ports:
+            - containerPort: 80
+`,
+		},
+		{
+			name: "multiple documents",
+			code: `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+data:
+  key: value
+`,
+		},
+		{
+			name: "not a manifest",
+			code: "key: value\nlist: [1, 2]\n",
+		},
+		{
+			name: "unknown kind",
+			code: "apiVersion: example.com/v1\nkind: Widget\nspec:\n  anything: true\n",
+		},
+		{
+			name: "syntax error",
+			code: "apiVersion: v1\nkind: Service\nmetadata: [\n",
+			want: []string{"deploy.yaml:3: error: did not find expected node content [yaml-syntax]"},
+		},
+		{
+			name: "missing kind",
+			code: "apiVersion: v1\nmetadata:\n  name: web\n",
+			want: []string{`deploy.yaml:1:1: error: missing required field "kind"`},
+		},
+		{
+			name: "wrong api version",
+			code: "apiVersion: v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  selector: {}\n  template: {}\n",
+			want: []string{`deploy.yaml:1:13: error: apiVersion "v1" is not valid for kind Deployment, use "apps/v1"`},
+		},
+		{
+			name: "unknown field with suggestion",
+			code: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  selectr: {app: web}\n",
+			want: []string{`deploy.yaml:6:3: error: unknown field "selectr" in Service.spec (did you mean "selector"?)`},
+		},
+		{
+			name: "missing required field",
+			code: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n    - image: nginx\n",
+			want: []string{`deploy.yaml:7:7: error: missing required field "name" in Pod.spec.containers[0]`},
+		},
+		{
+			name: "wrong type",
+			code: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: two\n  selector: {}\n  template: {}\n",
+			want: []string{`deploy.yaml:6:13: error: Deployment.spec.replicas must be an integer, got string "two"`},
+		},
+		{
+			name: "hpa v2",
+			code: `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: web}
+  maxReplicas: 5
+  metrics:
+    - type: Resource
+      resource:
+        name: cpu
+        target: {type: Utilization, averageUtilization: 80}
+`,
+		},
+		{
+			name: "hpa v1",
+			code: `apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: web}
+  maxReplicas: 5
+  targetCPUUtilizationPercentage: 80
+`,
+		},
+		{
+			name: "hpa v1 field in v2",
+			code: `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: web}
+  maxReplicas: 5
+  targetCPUUtilizationPercentage: 80
+`,
+			want: []string{`deploy.yaml:8:3: error: unknown field "targetCPUUtilizationPercentage" in HorizontalPodAutoscaler.spec`},
+		},
+		{
+			name: "hpa v2 field in v1",
+			code: `apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: web}
+  maxReplicas: 5
+  metrics: []
+`,
+			want: []string{`deploy.yaml:8:3: error: unknown field "metrics" in HorizontalPodAutoscaler.spec`},
+		},
+		{
+			name: "hpa unknown version",
+			code: `apiVersion: autoscaling/v3
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  scaleTargetRef: {apiVersion: apps/v1, kind: Deployment, name: web}
+  maxReplicas: 5
+`,
+			want: []string{`deploy.yaml:1:13: error: apiVersion "autoscaling/v3" is not valid for kind HorizontalPodAutoscaler, use "autoscaling/v2"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := validation.ValidateKubernetes("deploy.yaml", []byte(tt.code))
+			assertDiagnostics(t, diags, tt.want)
+		})
+	}
+}
+
+func TestValidateManifestBlocks(t *testing.T) {
+	output := "```yaml\n# deploy.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\ndatas: {}\n```"
+
+	diags := validation.Validate(types.Response{
+		FullOutput: output,
+		Files:      types.ExtractFiles(output),
+	})
+	if len(diags) != 1 || diags[0].File != "deploy.yaml" || diags[0].Rule != "k8s-schema" {
+		t.Errorf("expected a k8s-schema problem in deploy.yaml, got %v", diags)
+	}
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		schemas kubernetesSchemas
+		wantErr string
+	}{
+		{
+			name: "valid",
+			schemas: kubernetesSchemas{
+				Definitions: map[string]*schemaNode{
+					"alias": {Ref: "container"},
+					"container": {Type: "object", Properties: map[string]*schemaNode{
+						"name": {Type: "string"},
+					}},
+				},
+				Schemas: []*kindSchema{{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Properties: map[string]*schemaNode{
+						"containers": {Type: "array", Items: &schemaNode{Ref: "alias"}},
+					},
+				}},
+			},
+		},
+		{
+			name: "unknown in definition",
+			schemas: kubernetesSchemas{
+				Definitions: map[string]*schemaNode{
+					"spec": {Type: "object", AdditionalProperties: &schemaNode{Ref: "missing"}},
+				},
+			},
+			wantErr: `unknown definition "missing"`,
+		},
+		{
+			name: "unknown in kind",
+			schemas: kubernetesSchemas{
+				Schemas: []*kindSchema{{
+					APIVersion: "v1",
+					Kind:       "Pod",
+					Properties: map[string]*schemaNode{"spec": {Ref: "podSpec"}},
+				}},
+			},
+			wantErr: `v1 Pod: unknown definition "podSpec"`,
+		},
+		{
+			name: "circular",
+			schemas: kubernetesSchemas{
+				Definitions: map[string]*schemaNode{
+					"a": {Ref: "b"},
+					"b": {Ref: "a"},
+				},
+			},
+			wantErr: "circular definition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schemas.checkRefs()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestResolveUnknownRef(t *testing.T) {
+	v := &k8sValidator{schemas: &kubernetesSchemas{}}
+
+	if got := v.resolve(&schemaNode{Ref: "missing"}); got.Type != "any" {
+		t.Errorf("expected unknown reference to resolve to any, got %+v", got)
+	}
+}
+
+func TestEmbeddedSchemas(t *testing.T) {
+	// Loading the embedded schemas panics if they are invalid
+	if schemas := kubernetesSchema(); len(schemas.kinds) == 0 {
+		t.Errorf("expected embedded schemas to define kinds")
+	}
+}
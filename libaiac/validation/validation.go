@@ -0,0 +1,139 @@
+// Package validation implements validation of code generated by LLM
+// providers, allowing problems to be found (and possibly fixed by the model)
+// before the code is used.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+)
+
+// Severity is the severity of a diagnostic.
+type Severity string
+
+const (
+	// SeverityWarning is used for problems that do not prevent the code from
+	// being used, but probably should be fixed.
+	SeverityWarning Severity = "warning"
+
+	// SeverityError is used for problems that prevent the code from being
+	// used.
+	SeverityError Severity = "error"
+)
+
+// Diagnostic is a single problem found in generated code.
+type Diagnostic struct {
+	// File is the name of the file (or code block) the problem was found in.
+	File string `json:"file"`
+
+	// Line is the line number of the problem, starting at 1. Zero if unknown.
+	Line int `json:"line,omitempty"`
+
+	// Column is the column number of the problem, starting at 1. Zero if
+	// unknown.
+	Column int `json:"column,omitempty"`
+
+	// Severity is the severity of the problem.
+	Severity Severity `json:"severity"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+
+	// Rule is an identifier of the check that found the problem, e.g.
+	// "hcl-syntax".
+	Rule string `json:"rule"`
+}
+
+// String returns a textual representation of the diagnostic in the common
+// "file:line:column: severity: message" format.
+func (diag Diagnostic) String() string {
+	var loc strings.Builder
+	loc.WriteString(diag.File)
+	if diag.Line > 0 {
+		fmt.Fprintf(&loc, ":%d", diag.Line)
+		if diag.Column > 0 {
+			fmt.Fprintf(&loc, ":%d", diag.Column)
+		}
+	}
+
+	return fmt.Sprintf("%s: %s: %s [%s]", loc.String(), diag.Severity, diag.Message, diag.Rule)
+}
+
+// Validator is an interface for validating responses from LLM providers.
+// Implementations return diagnostics for all problems found in the response;
+// an empty result means the response is valid.
+type Validator interface {
+	Validate(res types.Response) []Diagnostic
+}
+
+// ValidatorFunc is an adapter allowing ordinary functions to be used as
+// validators.
+type ValidatorFunc func(res types.Response) []Diagnostic
+
+// Validate calls fn(res).
+func (fn ValidatorFunc) Validate(res types.Response) []Diagnostic {
+	return fn(res)
+}
+
+// Validators combines multiple validators into one, returning the
+// diagnostics of all of them, in order.
+type Validators []Validator
+
+// Validate runs all validators on the response.
+func (validators Validators) Validate(res types.Response) (diags []Diagnostic) {
+	for _, validator := range validators {
+		diags = append(diags, validator.Validate(res)...)
+	}
+
+	return diags
+}
+
+// HasErrors returns true if any of the provided diagnostics is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, diag := range diags {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate validates all code blocks in the provided response that are of a
+// supported language, and returns all diagnostics found. Code blocks of
+// unsupported languages are ignored. Currently, HCL/Terraform code blocks and
+// Kubernetes manifests in YAML code blocks are supported.
+func Validate(res types.Response) (diags []Diagnostic) {
+	for i, block := range res.Files {
+		file := block.Filename
+		if file == "" {
+			file = fmt.Sprintf("code block %d", i+1)
+		}
+
+		if IsHCL(block) {
+			diags = append(diags, ValidateHCL(file, []byte(block.Code), IsTerraform(block))...)
+		} else if IsYAML(block) {
+			diags = append(diags, ValidateKubernetes(file, []byte(block.Code))...)
+		}
+	}
+
+	return diags
+}
+
+// FixPrompt returns a prompt asking the model to fix the problems described by
+// the provided diagnostics.
+func FixPrompt(diags []Diagnostic) string {
+	var prompt strings.Builder
+	prompt.WriteString(
+		"The code you generated has the following problems. Please fix them, " +
+			"and return the complete fixed code:\n\n",
+	)
+
+	for _, diag := range diags {
+		fmt.Fprintf(&prompt, "- %s\n", diag)
+	}
+
+	return prompt.String()
+}
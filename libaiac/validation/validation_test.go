@@ -0,0 +1,139 @@
+package validation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
+)
+
+func TestDiagnosticString(t *testing.T) {
+	tests := []struct {
+		name string
+		diag validation.Diagnostic
+		want string
+	}{
+		{
+			name: "file only",
+			diag: validation.Diagnostic{File: "main.tf", Severity: validation.SeverityError, Message: "bad", Rule: "r"},
+			want: "main.tf: error: bad [r]",
+		},
+		{
+			name: "line",
+			diag: validation.Diagnostic{File: "main.tf", Line: 3, Severity: validation.SeverityWarning, Message: "meh", Rule: "r"},
+			want: "main.tf:3: warning: meh [r]",
+		},
+		{
+			name: "line and column",
+			diag: validation.Diagnostic{File: "main.tf", Line: 3, Column: 7, Severity: validation.SeverityError, Message: "bad", Rule: "r"},
+			want: "main.tf:3:7: error: bad [r]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.diag.String(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		wantFiles []string
+		wantRules []string
+	}{
+		{
+			name:   "valid terraform",
+			output: "```hcl\nresource \"aws_s3_bucket\" \"b\" {}\n```",
+		},
+		{
+			name:      "invalid terraform",
+			output:    "```hcl\nresource \"aws_s3_bucket\" \"b\" {\n```",
+			wantFiles: []string{"code block 1"},
+			wantRules: []string{"hcl-syntax"},
+		},
+		{
+			name: "named files",
+			output: "```hcl\n// main.tf\nresource \"aws_s3_bucket\" {}\n```\n" +
+				"```hcl\n// variables.tf\nvariable \"name\" {\n```",
+			wantFiles: []string{"main.tf", "variables.tf"},
+			wantRules: []string{"terraform-structure", "hcl-syntax"},
+		},
+		{
+			name:   "unsupported language",
+			output: "```python\nprint(\n```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := types.Response{FullOutput: tt.output, Files: types.ExtractFiles(tt.output)}
+
+			diags := validation.Validate(res)
+
+			var files, rules []string
+			for _, diag := range diags {
+				if len(files) == 0 || files[len(files)-1] != diag.File {
+					files = append(files, diag.File)
+					rules = append(rules, diag.Rule)
+				}
+			}
+
+			if strings.Join(files, ",") != strings.Join(tt.wantFiles, ",") ||
+				strings.Join(rules, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf(
+					"expected problems in %v (%v), got %v",
+					tt.wantFiles, tt.wantRules, diags,
+				)
+			}
+
+			if got := validation.HasErrors(diags); got != (len(tt.wantFiles) > 0) {
+				t.Errorf("expected HasErrors to be %t, got %t", len(tt.wantFiles) > 0, got)
+			}
+		})
+	}
+}
+
+func TestFixPrompt(t *testing.T) {
+	prompt := validation.FixPrompt([]validation.Diagnostic{
+		{File: "main.tf", Line: 1, Severity: validation.SeverityError, Message: "bad", Rule: "hcl-syntax"},
+		{File: "deploy.yaml", Severity: validation.SeverityWarning, Message: "meh", Rule: "k8s-schema"},
+	})
+
+	for _, want := range []string{
+		"Please fix them",
+		"- main.tf:1: error: bad [hcl-syntax]\n",
+		"- deploy.yaml: warning: meh [k8s-schema]\n",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected prompt to contain %q, got %q", want, prompt)
+		}
+	}
+}
+
+func TestValidators(t *testing.T) {
+	warn := validation.ValidatorFunc(func(types.Response) []validation.Diagnostic {
+		return []validation.Diagnostic{{Severity: validation.SeverityWarning, Rule: "a"}}
+	})
+	fail := validation.ValidatorFunc(func(types.Response) []validation.Diagnostic {
+		return []validation.Diagnostic{{Severity: validation.SeverityError, Rule: "b"}}
+	})
+
+	diags := validation.Validators{warn, fail}.Validate(types.Response{})
+	if len(diags) != 2 || diags[0].Rule != "a" || diags[1].Rule != "b" {
+		t.Fatalf("expected diagnostics of both validators in order, got %v", diags)
+	}
+
+	if validation.HasErrors(diags[:1]) {
+		t.Errorf("expected warnings not to count as errors")
+	}
+
+	if !validation.HasErrors(diags) {
+		t.Errorf("expected errors to be found")
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,23 +16,62 @@ import (
 	"github.com/briandowns/spinner"
 	"github.com/fatih/color"
 	"github.com/gofireflyio/aiac/v5/libaiac"
+	"github.com/gofireflyio/aiac/v5/libaiac/cassette"
+	"github.com/gofireflyio/aiac/v5/libaiac/report"
+	"github.com/gofireflyio/aiac/v5/libaiac/security"
+	"github.com/gofireflyio/aiac/v5/libaiac/session"
+	"github.com/gofireflyio/aiac/v5/libaiac/templates"
 	"github.com/gofireflyio/aiac/v5/libaiac/types"
+	"github.com/gofireflyio/aiac/v5/libaiac/validation"
 	"github.com/manifoldco/promptui"
 )
 
 type flags struct {
-	Config     string   `help:"Configuration file path" type:"path" short:"c"`
-	Backend    string   `help:"Backend to use" short:"b"`
-	OutputFile string   `help:"Output file to push resulting code to" optional:"" type:"path" short:"o"`         //nolint: lll
-	ReadmeFile string   `help:"Readme file to push entire Markdown output to" optional:"" type:"path" short:"r"` //nolint: lll
-	Quiet      bool     `help:"Non-interactive mode, print/save output and exit" default:"false" short:"q"`      //nolint: lll
-	Full       bool     `help:"Print full Markdown output to stdout" default:"false" short:"f"`                  //nolint: lll
-	Model      string   `help:"Model to use" short:"m"`
-	What       []string `arg:"" optional:"" help:"Which IaC template to generate"`
-	Clipboard  bool     `help:"Copy generated code to clipboard (in --quiet mode)"`
-	ListModels bool     `help:"List supported models and exit"`
-	Timeout    int      `help:"Timeout to generate code, in seconds" default:"60"`
-	Version    bool     `help:"Print aiac version and exit"`
+	Config   string        `help:"Configuration file path" type:"path" short:"c"`
+	Version  bool          `help:"Print aiac version and exit"`
+	Record   string        `help:"Record HTTP exchanges with OpenAI and Ollama backends to a cassette file" type:"path" xor:"cassette"`              //nolint: lll
+	Replay   string        `help:"Replay HTTP exchanges from a cassette file instead of contacting the backends" type:"existingfile" xor:"cassette"` //nolint: lll
+	Generate generateFlags `cmd:"" default:"withargs" help:"Generate IaC code (default command)"`
+	Edit     editFlags     `cmd:"" help:"Modify an existing file"`
+	Batch    batchFlags    `cmd:"" help:"Generate code for multiple prompts listed in a manifest file"`
+	Compare  compareFlags  `cmd:"" help:"Compare the code generated by multiple backends and models"`
+	Eval     evalFlags     `cmd:"" help:"Evaluate a suite of prompts against multiple backends and models"`
+	Sessions sessionsFlags `cmd:"" help:"Manage saved sessions"`
+}
+
+type generateFlags struct {
+	Backend      string   `help:"Backend to use" short:"b"`
+	OutputFile   string   `help:"Output file to push resulting code to" optional:"" type:"path" short:"o"`                                //nolint: lll
+	OutputDir    string   `help:"Directory to save every code block in the output to, as separate files" type:"path"`                     //nolint: lll
+	ReadmeFile   string   `help:"Readme file to push entire Markdown output to" optional:"" type:"path" short:"r"`                        //nolint: lll
+	ReportFile   string   `help:"File to write a report of the problems found in the output to" type:"path"`                              //nolint: lll
+	ReportFormat string   `help:"Format of the report file: sarif or json" enum:"sarif,json" default:"sarif"`                             //nolint: lll
+	Quiet        bool     `help:"Non-interactive mode, print/save output and exit" default:"false" short:"q"`                             //nolint: lll
+	OutputFormat string   `help:"Format of the output printed to stdout: text or json (implies --quiet)" enum:"text,json" default:"text"` //nolint: lll
+	Full         bool     `help:"Print full Markdown output to stdout" default:"false" short:"f"`                                         //nolint: lll
+	Stream       bool     `help:"Stream full Markdown output to stdout as it is generated" default:"false"`                               //nolint: lll
+	Model        string   `help:"Model to use" short:"m"`
+	System       string   `help:"System prompt to send to the model, overrides the backend's system_prompt"` //nolint: lll
+	Temperature  *float64 `help:"Sampling temperature, overrides the backend's configuration"`
+	MaxTokens    *int     `help:"Maximum number of tokens to generate, overrides the backend's configuration"` //nolint: lll
+	TopP         *float64 `help:"Nucleus sampling probability, overrides the backend's configuration"`
+	Stop         []string `help:"Sequence at which the model stops generating (may be repeated)" sep:"none"`
+	Seed         *int64   `help:"Seed for deterministic sampling, where supported by the provider"`
+	AutoContinue int      `help:"Automatically continue truncated responses, up to this many times" default:"0"`             //nolint: lll
+	Repair       int      `help:"Automatically ask the model to fix validation problems, up to this many times" default:"0"` //nolint: lll
+	What         []string `arg:"" optional:"" help:"Which IaC template to generate"`
+	PromptFile   string   `help:"File to read the prompt from (\"-\" for standard input)" short:"p"`
+	Template     string   `help:"Name of a prompt template to build the prompt from" short:"t"`
+	Var          []string `help:"Template variable in the format name=value (may be repeated)" sep:"none"`
+	Context      []string `help:"File, directory or glob pattern to include as context (may be repeated)" short:"i" sep:"none"`                    //nolint: lll
+	ContextSize  int      `help:"Maximum total size of context files, in bytes, overrides the configuration"`                                      //nolint: lll
+	TruncContext bool     `help:"Truncate context files exceeding the maximum size, rather than failing" name:"truncate-context"`                  //nolint: lll
+	Sensitive    bool     `help:"Include context files that may contain secrets (e.g. .tfvars, .tfstate and .env files)" name:"include-sensitive"` //nolint: lll
+	Clipboard    bool     `help:"Copy generated code to clipboard (in --quiet mode)"`
+	FailOn       string   `help:"Exit with an error if security checks find problems of this severity or higher: low, medium, high or critical (in --quiet mode)"` //nolint: lll
+	ListModels   bool     `help:"List supported models and exit"`
+	Timeout      int      `help:"Timeout to generate code, in seconds" default:"60"`
+	Session      string   `help:"Name of a session to save the conversation to, or resume it from if it exists"` //nolint: lll
 }
 
 func main() {
@@ -44,7 +85,7 @@ func main() {
 		}),
 	)
 
-	_, err := parser.Parse(os.Args[1:])
+	ctx, err := parser.Parse(os.Args[1:])
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -55,14 +96,70 @@ func main() {
 		os.Exit(0)
 	}
 
+	if strings.HasPrefix(ctx.Command(), "sessions") {
+		err = runSessions(ctx.Command(), cli.Sessions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
 	aiac, err := libaiac.New(cli.Config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed loading aiac client: %s\n", err)
 		os.Exit(1)
 	}
 
-	if cli.ListModels {
-		err := printModels(aiac, cli)
+	aiac.Cassette, err = loadCassette(cli.Record, cli.Replay)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed loading cassette: %s\n", err)
+		os.Exit(1)
+	}
+
+	if strings.HasPrefix(ctx.Command(), "eval") {
+		err = runEval(aiac, cli.Eval)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if strings.HasPrefix(ctx.Command(), "compare") {
+		err = runCompare(aiac, cli.Compare)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if strings.HasPrefix(ctx.Command(), "batch") {
+		err = runBatch(aiac, cli.Batch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if strings.HasPrefix(ctx.Command(), "edit") {
+		err = editFile(aiac, cli.Edit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if cli.Generate.ListModels {
+		err := printModels(aiac, cli.Generate)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed listing models: %s\n", err)
 			os.Exit(1)
@@ -71,7 +168,7 @@ func main() {
 		os.Exit(0)
 	}
 
-	err = generateCode(aiac, cli)
+	err = generateCode(aiac, cli.Generate)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
@@ -79,7 +176,7 @@ func main() {
 	os.Exit(0)
 }
 
-func printModels(aiac *libaiac.Aiac, cli flags) error {
+func printModels(aiac *libaiac.Aiac, cli generateFlags) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -95,12 +192,41 @@ func printModels(aiac *libaiac.Aiac, cli flags) error {
 	return nil
 }
 
-var errInvalidInput = errors.New("invalid input, please try again")
+var (
+	errInvalidInput  = errors.New("invalid input, please try again")
+	errMissingPrompt = errors.New(
+		"no prompt provided, pass it as arguments, with --prompt-file, or via standard input with \"-\"",
+	)
+	errConflictingPrompt = errors.New("cannot read the prompt from both standard input and --prompt-file")
+	errInsecureCode      = errors.New("security checks failed")
+)
 
-func generateCode(aiac *libaiac.Aiac, cli flags) error { //nolint: funlen, cyclop
+func generateCode(aiac *libaiac.Aiac, cli generateFlags) error { //nolint: funlen, cyclop, gocognit
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cli.Timeout)*time.Second)
 	defer cancel()
 
+	if cli.OutputFormat == "json" {
+		// JSON output is a single document describing the final response, so
+		// it is only supported in non-interactive mode, without streaming
+		cli.Quiet = true
+		cli.Stream = false
+	}
+
+	if len(cli.What) == 1 && cli.What[0] == "-" {
+		if cli.PromptFile != "" {
+			return errConflictingPrompt
+		}
+
+		cli.PromptFile = "-"
+		cli.What = nil
+	}
+
+	if cli.PromptFile == "-" {
+		// standard input is consumed by the prompt, so the interactive menu
+		// cannot be used
+		cli.Quiet = true
+	}
+
 	spin := spinner.New(
 		spinner.CharSets[11],
 		100*time.Millisecond, //nolint: gomnd
@@ -113,40 +239,110 @@ func generateCode(aiac *libaiac.Aiac, cli flags) error { //nolint: funlen, cyclo
 		}
 	}()
 
-	// If the prompt starts with the word "get" or "generate", remove it. This
-	// is here for backwards compatibility purposes, as previous versions used
-	// these words as command names (that weren't truly part of the prompt), so
-	// people may be used to adding them and we don't want them to actually be
-	// in the prompt.
-	if strings.ToLower(cli.What[0]) == "get" ||
-		strings.ToLower(cli.What[0]) == "generate" {
-		cli.What = cli.What[1:]
+	var (
+		store  *session.Store
+		sess   *session.Session
+		failOn security.Severity
+		err    error
+	)
+
+	if cli.FailOn != "" {
+		failOn, err = security.ParseSeverity(cli.FailOn)
+		if err != nil {
+			return fmt.Errorf("invalid --fail-on value: %w", err)
+		}
 	}
 
-	// NOTE: we are prepending the string "generate sample code for a..."
-	// to the prompt, this is meant to ensure that the language model
-	// actually generates code.
-	prompt := fmt.Sprintf("Generate sample code for a %s", strings.Join(cli.What, " "))
+	if cli.Session != "" {
+		store = session.New(nil)
+		sess, err = store.Open(cli.Session)
+		if err != nil {
+			return fmt.Errorf("failed loading session: %w", err)
+		}
 
-	if cli.ReadmeFile != "" || cli.Full {
-		prompt = fmt.Sprintf(
-			"Generate sample code for a %s. Include explanations.",
-			strings.Join(cli.What, " "),
-		)
+		// Resume the session with the same backend and model, unless the
+		// user explicitly selected a different backend
+		if cli.Backend == "" {
+			cli.Backend = sess.Backend
+			if cli.Model == "" {
+				cli.Model = sess.Model
+			}
+		}
+	}
+
+	prompt, err := buildPrompt(aiac, cli, sess)
+	if err != nil {
+		return err
+	}
+
+	if len(cli.Context) > 0 {
+		prompt, err = withContext(aiac, cli, prompt)
+		if err != nil {
+			return err
+		}
 	}
 
 	var res types.Response
 
-	chat, err := aiac.Chat(ctx, cli.Backend, cli.Model)
+	var history []types.Message
+	if sess != nil {
+		history = sess.Messages
+	}
+
+	chat, err := aiac.ChatWithOptions(ctx, cli.Backend, cli.Model, libaiac.ChatOptions{
+		Messages:     history,
+		SystemPrompt: cli.System,
+		Inference: types.InferenceParams{
+			Temperature:   cli.Temperature,
+			MaxTokens:     cli.MaxTokens,
+			TopP:          cli.TopP,
+			StopSequences: cli.Stop,
+			Seed:          cli.Seed,
+		},
+		MaxContinuations: cli.AutoContinue,
+		MaxRepairs:       cli.Repair,
+		OnRepair: func(attempt libaiac.RepairAttempt) {
+			if spin.Active() {
+				spin.Stop()
+			}
+
+			if cli.Stream {
+				fmt.Fprintln(os.Stdout)
+			}
+
+			fmt.Fprintf(
+				os.Stderr,
+				"Validation found %d problem(s), asking the model to fix them.\n",
+				len(attempt.Diagnostics),
+			)
+
+			spin.Start()
+		},
+	})
 	if err != nil {
 		return fmt.Errorf("failed starting chat: %w", err)
 	}
 
+	var (
+		diags    []validation.Diagnostic
+		findings []security.Finding
+	)
+
 ATTEMPTS:
 	for {
 		spin.Start()
+		startedAt := time.Now()
 
-		res, err = chat.Send(ctx, prompt)
+		if cli.Stream {
+			res, err = chat.SendStream(ctx, prompt, func(chunk string) {
+				if spin.Active() {
+					spin.Stop()
+				}
+				fmt.Fprint(os.Stdout, chunk)
+			})
+		} else {
+			res, err = chat.Send(ctx, prompt)
+		}
 
 		options := [][2]string{
 			{"r", "retry same prompt"},
@@ -154,26 +350,134 @@ ATTEMPTS:
 			{"q", "quit"},
 		}
 
+		var repairErr *libaiac.RepairError
+		if errors.As(err, &repairErr) {
+			spin.Stop()
+
+			if cli.Quiet {
+				fmt.Fprint(os.Stderr, libaiac.FormatRepairHistory(repairErr.Attempts))
+				return fmt.Errorf("failed generating code: %w", err)
+			}
+
+			// In interactive mode, the last response is shown together with
+			// its problems, allowing the user to decide how to proceed.
+			fmt.Fprintf(os.Stderr, "Automatic repair failed: %s\n", err)
+			err = nil
+		}
+
 		if err != nil {
 			spin.Stop()
+
+			if cli.Quiet {
+				return fmt.Errorf("failed generating code: %w", err)
+			}
+
 			fmt.Fprintf(os.Stderr, "Failed generating code: %s\n", err)
 		} else {
 			spin.Stop()
 
+			if sess != nil {
+				sess.Record(chat.Messages(), res)
+				if err := store.Save(sess); err != nil {
+					return fmt.Errorf("failed saving session: %w", err)
+				}
+			}
+
 			stdoutOutput := res.Code
 			if cli.Full {
 				stdoutOutput = res.FullOutput
 			}
 
-			fmt.Fprintln(os.Stdout, stdoutOutput)
+			switch {
+			case cli.OutputFormat == "json":
+				err = printJSON(prompt, res, startedAt)
+				if err != nil {
+					return fmt.Errorf("failed printing output: %w", err)
+				}
+			case cli.Stream:
+				// output was already printed as it was received
+				fmt.Fprintln(os.Stdout)
+			default:
+				fmt.Fprintln(os.Stdout, stdoutOutput)
+			}
+
+			if res.Fallback {
+				fmt.Fprintf(
+					os.Stderr,
+					"Response generated by fallback backend %s (model %s).\n",
+					res.Backend, res.Model,
+				)
+			}
+
+			if res.Continuations > 0 {
+				fmt.Fprintf(
+					os.Stderr,
+					"Response was truncated, completed after %d continuation round(s).\n",
+					res.Continuations,
+				)
+			}
+
+			if res.Repairs > 0 {
+				fmt.Fprintf(
+					os.Stderr,
+					"Response was repaired after %d round(s).\n",
+					res.Repairs,
+				)
+			}
+
+			if types.IsTruncated(res.StopReason) {
+				fmt.Fprintf(
+					os.Stderr,
+					"Warning: response was truncated due to the token limit (%s).\n",
+					res.StopReason,
+				)
+			}
+
+			diags = validation.Validate(res)
+			printDiagnostics(diags)
+
+			findings = security.Scan(res)
+			printFindings(findings)
 
 			if cli.Quiet {
 				if cli.Clipboard {
 					clipboard.WriteAll(stdoutOutput)
 				}
+
+				var paths []string
+				if cli.OutputFile != "" || cli.OutputDir != "" || cli.ReadmeFile != "" {
+					paths, err = saveOutput(cli, res)
+					if err != nil {
+						return fmt.Errorf("failed saving output: %w", err)
+					}
+				}
+
+				if cli.ReportFile != "" {
+					err = writeReport(cli, prompt, res, diags, findings, paths)
+					if err != nil {
+						return fmt.Errorf("failed writing report: %w", err)
+					}
+				}
+
+				if failOn > 0 {
+					if failed := security.AtLeast(findings, failOn); len(failed) > 0 {
+						return fmt.Errorf(
+							"%w: %d problem(s) of severity %s or higher",
+							errInsecureCode, len(failed), failOn,
+						)
+					}
+				}
+
 				break ATTEMPTS
 			}
 
+			if cli.ReportFile != "" {
+				err = writeReport(cli, prompt, res, diags, findings, nil)
+				if err != nil {
+					return fmt.Errorf("failed writing report: %w", err)
+				}
+			}
+
 			options = append(
 				[][2]string{
 					{"s", "save and exit"},
@@ -182,6 +486,13 @@ ATTEMPTS:
 				},
 				options...,
 			)
+
+			if len(diags) > 0 {
+				options = append(
+					[][2]string{{"f", "send validation problems to the model for a fix"}},
+					options...,
+				)
+			}
 		}
 
 	PROMPT:
@@ -234,12 +545,24 @@ ATTEMPTS:
 				// continue chatting
 				prompt = newMessage()
 				continue ATTEMPTS
+			case "f":
+				// ask the model to fix validation problems
+				prompt = validation.FixPrompt(diags)
+				continue ATTEMPTS
 			case "s", "w":
-				err = saveOutput(cli, res)
+				paths, err := saveOutput(cli, res)
 				if err != nil {
 					return fmt.Errorf("failed saving output: %w", err)
 				}
 
+				if cli.ReportFile != "" && len(paths) > 0 {
+					// update the report with the paths the code was saved to
+					err = writeReport(cli, prompt, res, diags, findings, paths)
+					if err != nil {
+						return fmt.Errorf("failed writing report: %w", err)
+					}
+				}
+
 				if choice == "w" {
 					prompt = newMessage()
 					continue ATTEMPTS
@@ -253,6 +576,218 @@ ATTEMPTS:
 	return nil
 }
 
+// buildPrompt builds the prompt to send to the model from the command line
+// arguments and the contents of the prompt file (if any), or from the selected
+// prompt template. When resuming a session, these are sent as-is, as a new
+// message in the existing conversation; if none were provided, the user is
+// asked for a new message.
+func buildPrompt(aiac *libaiac.Aiac, cli generateFlags, sess *session.Session) (string, error) {
+	doc, err := readPromptFile(cli.PromptFile)
+	if err != nil {
+		return "", err
+	}
+
+	if cli.Template != "" {
+		prompt, err := renderTemplate(aiac, cli)
+		if err != nil {
+			return "", err
+		}
+
+		return joinPrompt(prompt, doc), nil
+	}
+
+	if sess != nil && len(sess.Messages) > 0 {
+		if msg := joinPrompt(strings.Join(cli.What, " "), doc); msg != "" {
+			return msg, nil
+		}
+
+		if cli.Quiet {
+			return "", errMissingPrompt
+		}
+
+		fmt.Fprintf(
+			os.Stderr,
+			"Resuming session %s (%d messages).\n",
+			sess.Name, len(sess.Messages),
+		)
+
+		return newMessage(), nil
+	}
+
+	// If the prompt starts with the word "get" or "generate", remove it. This
+	// is here for backwards compatibility purposes, as previous versions used
+	// these words as command names (that weren't truly part of the prompt), so
+	// people may be used to adding them and we don't want them to actually be
+	// in the prompt.
+	if len(cli.What) > 0 && (strings.ToLower(cli.What[0]) == "get" ||
+		strings.ToLower(cli.What[0]) == "generate") {
+		cli.What = cli.What[1:]
+	}
+
+	if len(cli.Context) > 0 {
+		// Requests to modify existing files make no sense with the
+		// "generate sample code" prefix, so they are sent as-is
+		if msg := joinPrompt(strings.Join(cli.What, " "), doc); msg != "" {
+			return msg, nil
+		}
+
+		return "", errMissingPrompt
+	}
+
+	if len(cli.What) == 0 {
+		// Prompts read from files are usually complete requirement
+		// documents, so they are sent as-is
+		if doc == "" {
+			return "", errMissingPrompt
+		}
+
+		return doc, nil
+	}
+
+	prompt := codePrompt(cli.What, cli.ReadmeFile != "" || cli.Full)
+
+	return joinPrompt(prompt, doc), nil
+}
+
+// codePrompt builds a prompt asking the model to generate code from the words
+// provided as command line arguments, optionally with explanations.
+func codePrompt(words []string, explain bool) string {
+	// NOTE: we are prepending the string "generate sample code for a..."
+	// to the prompt, this is meant to ensure that the language model
+	// actually generates code.
+	if explain {
+		return fmt.Sprintf(
+			"Generate sample code for a %s. Include explanations.",
+			strings.Join(words, " "),
+		)
+	}
+
+	return fmt.Sprintf("Generate sample code for a %s", strings.Join(words, " "))
+}
+
+// renderTemplate renders the prompt template selected with --template, with
+// the variables provided with --var. The command line arguments, if any, are
+// available to the template as the "prompt" variable.
+func renderTemplate(aiac *libaiac.Aiac, cli generateFlags) (string, error) {
+	vars, err := templates.ParseVars(cli.Var)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := vars["prompt"]; !ok && len(cli.What) > 0 {
+		vars["prompt"] = strings.Join(cli.What, " ")
+	}
+
+	store := aiac.Templates()
+
+	prompt, err := store.Render(cli.Template, vars)
+	if errors.Is(err, types.ErrNoSuchTemplate) {
+		names, _ := store.List()
+		if len(names) > 0 {
+			return "", fmt.Errorf("%w, available templates: %s", err, strings.Join(names, ", "))
+		}
+
+		return "", fmt.Errorf("%w, no templates found in %s or the configuration", err, store.Dir())
+	}
+
+	return prompt, err
+}
+
+// withContext adds the contents of the files selected with --context to the
+// prompt.
+func withContext(aiac *libaiac.Aiac, cli generateFlags, prompt string) (string, error) {
+	msg, files, err := aiac.ContextMessage(prompt, libaiac.ContextOptions{
+		Files:            cli.Context,
+		MaxSize:          cli.ContextSize,
+		Truncate:         cli.TruncContext,
+		IncludeSensitive: cli.Sensitive,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed loading context: %w", err)
+	}
+
+	var count, included int
+	for _, file := range files {
+		if file.Skipped {
+			color.New(color.FgYellow).Fprintf(
+				os.Stderr,
+				"Context file %s was skipped as it may contain secrets (use --include-sensitive to include it)\n",
+				file.Path,
+			)
+			continue
+		}
+
+		count++
+		included += file.Included
+
+		if file.Included < file.Size {
+			color.New(color.FgYellow).Fprintf(
+				os.Stderr,
+				"Context file %s was truncated (%d of %d bytes included)\n",
+				file.Path, file.Included, file.Size,
+			)
+		}
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"Including %d file(s) as context (%d bytes).\n",
+		count, included,
+	)
+
+	return msg, nil
+}
+
+// loadCassette creates a cassette recording HTTP exchanges to the record
+// file, or replaying them from the replay file. It returns nil if neither
+// file is provided.
+func loadCassette(record, replay string) (*cassette.Cassette, error) {
+	switch {
+	case record != "":
+		return cassette.New(&cassette.Options{Path: record, Mode: cassette.ModeRecord})
+	case replay != "":
+		return cassette.New(&cassette.Options{Path: replay, Mode: cassette.ModeReplay})
+	default:
+		return nil, nil
+	}
+}
+
+// readPromptFile reads a prompt from the provided file, or from standard input
+// if the file is "-". An empty string is returned if no file is provided.
+func readPromptFile(path string) (string, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch path {
+	case "":
+		return "", nil
+	case "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(path)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed reading prompt: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// joinPrompt joins the non-empty parts of a prompt with empty lines.
+func joinPrompt(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+
+	return strings.Join(nonEmpty, "\n\n")
+}
+
 func newMessage() string {
 	input := promptui.Prompt{
 		Label: "New message",
@@ -267,33 +802,49 @@ func newMessage() string {
 	return prompt
 }
 
-func saveOutput(cli flags, res types.Response) (err error) {
-	if !cli.Quiet && cli.OutputFile == "" {
+// saveOutput saves the generated code and full output to the files selected
+// by the user. In interactive mode, the user is asked for file paths if none
+// were provided, and changes to existing files must be confirmed (see
+// writeFile). Returns the paths of the files containing the code blocks of
+// the response, in the same order as the response's Files, with empty paths
+// for blocks that were not saved.
+func saveOutput(cli generateFlags, res types.Response) (paths []string, err error) {
+	if !cli.Quiet && cli.OutputFile == "" && cli.OutputDir == "" {
 		input := promptui.Prompt{
 			Label: "Enter file path for generated code",
 		}
 
 		cli.OutputFile, err = input.Run()
 		if err != nil {
-			return fmt.Errorf("prompt failed: %w", err)
+			return nil, fmt.Errorf("prompt failed: %w", err)
 		}
 	}
 
-	var codeSaved, fullSaved bool
+	var (
+		codeSaved, fullSaved bool
+		filesSaved           []string
+	)
 
-	if cli.OutputFile != "" {
-		f, err := os.Create(cli.OutputFile)
+	paths = make([]string, len(res.Files))
+
+	if cli.OutputDir != "" {
+		paths, filesSaved, err = saveFiles(cli.OutputDir, res.Files, !cli.Quiet)
 		if err != nil {
-			return fmt.Errorf(
-				"failed creating output file %s: %w",
-				cli.OutputFile, err,
-			)
+			return nil, err
 		}
+	}
 
-		fmt.Fprintln(f, res.Code)
-		f.Close()
+	if cli.OutputFile != "" {
+		codeSaved, err = writeFile(cli.OutputFile, res.Code+"\n", !cli.Quiet, false)
+		if err != nil {
+			return nil, err
+		}
 
-		codeSaved = true
+		// the code is that of the first code block
+		if len(paths) > 0 && paths[0] == "" &&
+			(codeSaved || hasContent(cli.OutputFile, res.Code+"\n")) {
+			paths[0] = cli.OutputFile
+		}
 	}
 
 	if !cli.Quiet && cli.ReadmeFile == "" {
@@ -303,31 +854,181 @@ func saveOutput(cli flags, res types.Response) (err error) {
 
 		cli.ReadmeFile, err = input.Run()
 		if err != nil {
-			return fmt.Errorf("prompt failed: %w", err)
+			return nil, fmt.Errorf("prompt failed: %w", err)
 		}
 	}
 
 	if cli.ReadmeFile != "" {
-		f, err := os.Create(cli.ReadmeFile)
+		fullSaved, err = writeFile(cli.ReadmeFile, res.FullOutput+"\n", !cli.Quiet, false)
 		if err != nil {
-			return fmt.Errorf(
-				"failed creating readme file %s: %w",
-				cli.ReadmeFile, err,
-			)
+			return nil, err
 		}
-
-		fmt.Fprintln(f, res.FullOutput)
-		f.Close()
-
-		fullSaved = true
 	}
 
 	if codeSaved {
 		fmt.Fprintf(os.Stderr, "Code saved successfully to %s\n", cli.OutputFile)
 	}
+	for _, path := range filesSaved {
+		fmt.Fprintf(os.Stderr, "Code saved successfully to %s\n", path)
+	}
 	if fullSaved {
 		fmt.Fprintf(os.Stderr, "Full output saved successfully to %s\n", cli.ReadmeFile)
 	}
 
-	return nil
+	return paths, nil
+}
+
+// jsonOutput is the document printed to standard output when using
+// --output-format json.
+type jsonOutput struct {
+	Prompt string `json:"prompt"`
+	types.Response
+	StartedAt time.Time `json:"started_at"`
+	Duration  float64   `json:"duration_seconds"`
+}
+
+// printJSON prints the response to standard output as a JSON document,
+// together with the prompt and timing information.
+func printJSON(prompt string, res types.Response, startedAt time.Time) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(jsonOutput{
+		Prompt:    prompt,
+		Response:  res,
+		StartedAt: startedAt.UTC(),
+		Duration:  time.Since(startedAt).Seconds(),
+	})
+}
+
+// writeReport writes a report of the problems already found in the response
+// to the report file, in the selected format. Code blocks are referred to by
+// the paths they were saved to, if any, relative to the working directory
+// when they are inside it (as expected by code scanning dashboards).
+func writeReport(
+	cli generateFlags,
+	prompt string,
+	res types.Response,
+	diags []validation.Diagnostic,
+	findings []security.Finding,
+	paths []string,
+) error {
+	f, err := os.Create(cli.ReportFile)
+	if err != nil {
+		return fmt.Errorf("failed creating report file %s: %w", cli.ReportFile, err)
+	}
+	defer f.Close()
+
+	if wd, err := os.Getwd(); err == nil {
+		paths = append([]string(nil), paths...)
+		for i, path := range paths {
+			rel, err := filepath.Rel(wd, path)
+			if path != "" && err == nil && rel != ".." &&
+				!strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				paths[i] = rel
+			}
+		}
+	}
+
+	rep := report.New(res, &report.Options{
+		Prompt:           prompt,
+		Version:          libaiac.Version,
+		Checked:          true,
+		Diagnostics:      diags,
+		SecurityFindings: findings,
+		Paths:            paths,
+	})
+
+	return rep.Write(f, report.Format(cli.ReportFormat))
+}
+
+// saveFiles saves every code block to a separate file in the provided
+// directory, creating it if necessary. Files are named as described in
+// types.FileNames, which rejects names that would escape the directory.
+// Existing files are overwritten as described in writeFile. Returns the paths
+// of the files containing the blocks, in the same order as the blocks, with
+// empty paths for blocks whose changes were discarded, and the paths of the
+// files that were written.
+func saveFiles(dir string, files []types.CodeBlock, confirm bool) (
+	paths []string,
+	written []string,
+	err error,
+) {
+	if len(files) == 0 {
+		return nil, nil, types.ErrNoCodeBlocks
+	}
+
+	names, err := types.FileNames(files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("refusing to save code to %s: %w", dir, err)
+	}
+
+	paths = make([]string, len(files))
+
+	for i, file := range files {
+		path := filepath.Join(dir, filepath.FromSlash(names[i]))
+
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return paths, written, fmt.Errorf("failed creating directory for %s: %w", path, err)
+		}
+
+		content := file.Code + "\n"
+
+		saved, err := writeFile(path, content, confirm, false)
+		if err != nil {
+			return paths, written, err
+		}
+
+		if saved {
+			written = append(written, path)
+		}
+
+		if saved || hasContent(path, content) {
+			paths[i] = path
+		}
+	}
+
+	return paths, written, nil
+}
+
+// printDiagnostics prints validation diagnostics to standard error, errors in
+// red and warnings in yellow.
+func printDiagnostics(diags []validation.Diagnostic) {
+	if len(diags) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nValidation found %d problem(s):\n", len(diags))
+	for _, diag := range diags {
+		c := color.New(color.FgYellow)
+		if diag.Severity == validation.SeverityError {
+			c = color.New(color.FgRed)
+		}
+
+		c.Fprintf(os.Stderr, "  %s\n", diag)
+	}
+}
+
+// printFindings prints security findings to standard error, colored by their
+// severity.
+func printFindings(findings []security.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nSecurity checks found %d problem(s):\n", len(findings))
+	for _, finding := range findings {
+		var c *color.Color
+		switch finding.Severity {
+		case security.SeverityCritical, security.SeverityHigh:
+			c = color.New(color.FgRed)
+		case security.SeverityMedium:
+			c = color.New(color.FgYellow)
+		default:
+			c = color.New(color.FgCyan)
+		}
+
+		c.Fprintf(os.Stderr, "  %s\n", finding)
+	}
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/gofireflyio/aiac/v5/libaiac/session"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+type sessionsFlags struct {
+	List struct{} `cmd:"" default:"1" help:"List saved sessions (default command)"`
+	Show struct {
+		Name string `arg:"" help:"Name of the session"`
+	} `cmd:"" help:"Print the messages of a saved session"`
+	Delete struct {
+		Name string `arg:"" help:"Name of the session"`
+	} `cmd:"" help:"Delete a saved session"`
+}
+
+func runSessions(command string, cli sessionsFlags) error {
+	store := session.New(nil)
+
+	switch command {
+	case "sessions list", "sessions":
+		return listSessions(store)
+	case "sessions show <name>":
+		return showSession(store, cli.Show.Name)
+	case "sessions delete <name>":
+		err := store.Delete(cli.Delete.Name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Session %s deleted.\n", cli.Delete.Name)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %s", command)
+	}
+}
+
+func listSessions(store *session.Store) error {
+	sessions, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	if len(sessions) == 0 {
+		fmt.Fprintf(os.Stderr, "No sessions found in %s\n", store.Dir())
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint: gomnd
+	fmt.Fprintln(w, "NAME\tBACKEND\tMODEL\tMESSAGES\tUPDATED")
+	for _, sess := range sessions {
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%d\t%s\n",
+			sess.Name, sess.Backend, sess.Model, len(sess.Messages),
+			sess.UpdatedAt.Local().Format(timeFormat),
+		)
+	}
+
+	return w.Flush()
+}
+
+func showSession(store *session.Store, name string) error {
+	sess, err := store.Load(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Session:  %s\n", sess.Name)
+	fmt.Printf("Backend:  %s\n", sess.Backend)
+	fmt.Printf("Model:    %s\n", sess.Model)
+	fmt.Printf("Created:  %s\n", sess.CreatedAt.Local().Format(timeFormat))
+	fmt.Printf("Updated:  %s\n", sess.UpdatedAt.Local().Format(timeFormat))
+
+	for _, msg := range sess.Messages {
+		fmt.Printf("\n[%s]\n%s\n", msg.Role, msg.Content)
+	}
+
+	return nil
+}